@@ -13,6 +13,8 @@ import (
 	pb "github.com/cuongpiger/golang/ecommerce"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/svcconfig"
 )
 
 const (
@@ -20,8 +22,23 @@ const (
 )
 
 func main() {
+	// Declare the deadlines and retries of every method once, in the service
+	// config, instead of at every call site. getProduct is an idempotent read,
+	// so a slow attempt is hedged; addProduct is only bounded by a timeout.
+	serviceConfig, err := svcconfig.New().
+		Method("ecommerce.ProductInfo", "getProduct").
+		Timeout(time.Second).
+		Hedge(svcconfig.DefaultHedgingPolicy).
+		Method("ecommerce.ProductInfo", "addProduct").
+		Timeout(2 * time.Second).
+		Build()
+	if err != nil {
+		log.Fatalf("invalid service config: %v", err)
+	}
+
 	// Set up a connection to the server.
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(address, append(serviceConfig.DialOptions(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -32,8 +49,7 @@ func main() {
 	name := "Apple iPhone 11"
 	description := "Meet Apple iPhone 11. All-new dual-camera system with Ultra Wide and Night mode."
 	price := float32(699.00)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+	ctx := context.Background()
 	r, err := c.AddProduct(ctx, &pb.Product{Name: name, Description: description, Price: price})
 	if err != nil {
 		log.Fatalf("Could not add product: %v", err)
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net"
+	"net/http"
 
 	pb "github.com/cuongpiger/golang/ecommerce"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/ratelimit"
 	"github.com/gofrs/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -16,6 +21,11 @@ const (
 	port = ":50051"
 )
 
+var (
+	rateLimits = flag.String("ratelimit", "ratelimit.yaml", "rate and concurrency limits, in JSON or YAML")
+	adminAddr  = flag.String("admin-addr", "localhost:7778", "serve the rate limits at http://<addr>/ratelimit, GET to read and PUT to replace them (empty disables)")
+)
+
 // server is used to implement ecommerce/product_info.
 type server struct {
 	productMap map[string]*pb.Product
@@ -48,17 +58,41 @@ func (s *server) GetProduct(ctx context.Context, in *pb.ProductID) (*pb.Product,
 }
 
 func main() {
+	flag.Parse()
+	limits, err := ratelimit.Load(*rateLimits)
+	if err != nil {
+		log.Fatalf("failed to load rate limits: %v", err)
+	}
+	limiter, err := ratelimit.New(limits, nil)
+	if err != nil {
+		log.Fatalf("invalid rate limits: %v", err)
+	}
+
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.StreamServerInterceptor()))
 	pb.RegisterProductInfoServer(s, &server{})
 
 	log.Println("gRPC server is running on port " + port)
 
-	if err := s.Serve(lis); err != nil {
+	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+	if *adminAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/ratelimit", limiter.Handler())
+		adminServer := &http.Server{Addr: *adminAddr, Handler: mux}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin server stopped: %v", err)
+			}
+		}()
+		runner.OnShutdown("admin server", adminServer.Shutdown)
+	}
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
@@ -3,6 +3,7 @@ module github.com/cuongpiger/golang
 go 1.23.4
 
 require (
+	github.com/cuongpiger/grpc-up-and-running/common v0.0.0
 	github.com/golang/protobuf v1.5.4
 	google.golang.org/grpc v1.73.0
 	google.golang.org/protobuf v1.36.6
@@ -13,4 +14,7 @@ require (
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/cuongpiger/grpc-up-and-running/common => ../../common
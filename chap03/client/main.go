@@ -2,31 +2,42 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	pb "github.com/cuongpiger/golang/ecommerce"
-	"time"
 
 	"google.golang.org/grpc/credentials/insecure"
 
 	"google.golang.org/grpc"
 
 	"github.com/cuongpiger/golang/order"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/svcconfig"
 )
 
 const (
 	address = "localhost:50051"
 )
 
+var serviceConfigPath = flag.String("service-config", "service_config.yaml", "service config file declaring per-method timeouts, retries and hedging")
+
 func main() {
+	flag.Parse()
+	serviceConfig, err := svcconfig.Load(*serviceConfigPath)
+	if err != nil {
+		log.Fatalf("failed to load service config: %v", err)
+	}
+
 	// Setting up a connection to the server.
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(address, append(serviceConfig.DialOptions(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
 	client := pb.NewOrderManagementClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+	// Deadlines come from the service config.
+	ctx := context.Background()
 
 	// Get Order
 	order.GetOrder(ctx, client)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"github.com/golang/protobuf/ptypes/wrappers"
 	"google.golang.org/grpc"
@@ -14,7 +15,11 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/http"
 	pb "github.com/cuongpiger/golang/ecommerce"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/ratelimit"
 	"strings"
 )
 
@@ -25,6 +30,11 @@ const (
 
 var orderMap = make(map[string]pb.Order)
 
+var (
+	rateLimits = flag.String("ratelimit", "ratelimit.yaml", "rate and concurrency limits, in JSON or YAML")
+	adminAddr  = flag.String("admin-addr", "localhost:7778", "serve the rate limits at http://<addr>/ratelimit, GET to read and PUT to replace them (empty disables)")
+)
+
 type server struct {
 	orderMap map[string]*pb.Order
 	pb.UnimplementedOrderManagementServer
@@ -146,18 +156,41 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 }
 
 func main() {
+	flag.Parse()
+	limits, err := ratelimit.Load(*rateLimits)
+	if err != nil {
+		log.Fatalf("failed to load rate limits: %v", err)
+	}
+	limiter, err := ratelimit.New(limits, nil)
+	if err != nil {
+		log.Fatalf("invalid rate limits: %v", err)
+	}
 	initSampleData()
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.StreamServerInterceptor()))
 	pb.RegisterOrderManagementServer(s, &server{})
 
 	log.Println("gRPC server is running on port " + port)
 	// Register reflection service on gRPC server.
 	// reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+	if *adminAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/ratelimit", limiter.Handler())
+		adminServer := &http.Server{Addr: *adminAddr, Handler: mux}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin server stopped: %v", err)
+			}
+		}()
+		runner.OnShutdown("admin server", adminServer.Shutdown)
+	}
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
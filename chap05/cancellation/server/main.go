@@ -12,6 +12,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -149,7 +152,7 @@ func main() {
 
 	log.Printf("Server is listening on port %s\n", port)
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+	if err := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
@@ -16,6 +16,9 @@ import (
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -160,7 +163,7 @@ func main() {
 	pb.RegisterOrderManagementServer(s, &server{})
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+	if err := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"io"
 	"log"
 	"net"
@@ -13,6 +14,10 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/audit"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -21,7 +26,10 @@ const (
 	orderBatchSize = 3
 )
 
-var orderMap = make(map[string]pb.Order)
+var (
+	orderMap = make(map[string]pb.Order)
+	auditLog = flag.String("audit-log", "audit.log", "file recording the order mutating calls")
+)
 
 type server struct {
 	orderMap map[string]*pb.Order
@@ -176,20 +184,34 @@ func orderServerStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *g
 }
 
 func main() {
+	flag.Parse()
 	initSampleData()
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
+
+	// addOrder, updateOrders and processOrders are recorded in a hash-chained
+	// audit log. Check it with: go run ../../../common/cmd/auditverify audit.log
+	auditTrail, err := audit.Open(*auditLog)
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	auditor := audit.New(auditTrail, audit.DefaultMethods, nil)
+
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(orderUnaryServerInterceptor),
-		grpc.StreamInterceptor(orderServerStreamInterceptor))
+		grpc.ChainUnaryInterceptor(auditor.UnaryServerInterceptor(), orderUnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(auditor.StreamServerInterceptor(), orderServerStreamInterceptor))
 	pb.RegisterOrderManagementServer(s, &server{})
 	// Register reflection service on gRPC server.
 
 	log.Println("gRPC server is starting on port", port)
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+
+	// The audit log is closed only after the last calls have been recorded.
+	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+	runner.OnShutdown("audit log", func(context.Context) error { return auditTrail.Close() })
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
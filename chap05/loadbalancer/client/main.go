@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	_ "google.golang.org/grpc/health" // Registers the client-side health checking function.
 	"google.golang.org/grpc/resolver"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/channelz"
+	_ "github.com/cuongpiger/grpc-up-and-running/common/discovery" // Registers the file and dnssrv resolvers.
+	"github.com/cuongpiger/grpc-up-and-running/common/lb"
 )
 
 const (
@@ -19,6 +27,21 @@ const (
 
 var addrs = []string{"localhost:50051", "localhost:50052"}
 
+var (
+	target         = flag.String("target", exampleScheme+":///"+exampleServiceName, "target to resolve, e.g. file:endpoints.yaml or dnssrv://127.0.0.1:8600/_grpc._tcp.echo.service.consul")
+	channelzAddr   = flag.String("channelz-addr", "", "serve channelz on this address (e.g. localhost:50100) and keep running after the RPCs")
+	healthDuration = flag.Duration("health-duration", 0, "after the pick_first and round_robin demos, call a health-checked round_robin channel once per second for this long")
+	localZone      = flag.String("local-zone", "", "zone of this client for the weighted_locality policy, e.g. zone-a")
+)
+
+// healthCheckedConfig enables client-side health checking: the channel opens a
+// grpc.health.v1.Health/Watch stream to every backend and round_robin only
+// picks backends currently reporting SERVING for the echo service.
+const healthCheckedConfig = `{
+	"loadBalancingPolicy": "round_robin",
+	"healthCheckConfig": {"serviceName": "grpc.examples.echo.Echo"}
+}`
+
 func callUnaryEcho(c ecpb.EchoClient, message string) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -37,7 +60,16 @@ func makeRPCs(cc *grpc.ClientConn, n int) {
 }
 
 func main() {
-	pickfirstConn, err := grpc.NewClient(fmt.Sprintf("%s:///%s", exampleScheme, exampleServiceName), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	flag.Parse()
+	if *channelzAddr != "" {
+		stop, err := channelz.Serve(*channelzAddr)
+		if err != nil {
+			log.Fatalf("failed to serve channelz: %v", err)
+		}
+		defer stop()
+	}
+
+	pickfirstConn, err := grpc.NewClient(*target, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -48,7 +80,7 @@ func main() {
 
 	// Make another ClientConn with round_robin policy.
 	roundrobinConn, err := grpc.NewClient(
-		fmt.Sprintf("%s:///%s", exampleScheme, exampleServiceName),
+		*target,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
 	)
@@ -59,6 +91,61 @@ func main() {
 
 	log.Println("==== Calling helloworld.Greeter/SayHello with round_robin ====")
 	makeRPCs(roundrobinConn, 10)
+
+	// The custom policies of the lb package are selected by name in the
+	// service config, like the built-in ones.
+	weightedConn, err := grpc.NewClient(
+		*target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {"localZone": %q}}]}`, lb.WeightedLocality, *localZone)),
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer weightedConn.Close()
+
+	log.Printf("==== Calling helloworld.Greeter/SayHello with %s (local zone %q) ====", lb.WeightedLocality, *localZone)
+	makeRPCs(weightedConn, 10)
+
+	leastConn, err := grpc.NewClient(
+		*target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, lb.LeastOutstanding)),
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer leastConn.Close()
+
+	log.Printf("==== Calling helloworld.Greeter/SayHello with %s ====", lb.LeastOutstanding)
+	makeRPCs(leastConn, 10)
+
+	if *healthDuration > 0 {
+		healthConn, err := grpc.NewClient(
+			*target,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultServiceConfig(healthCheckedConfig),
+		)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer healthConn.Close()
+
+		log.Println("==== Calling helloworld.Greeter/SayHello with health-checked round_robin ====")
+		hwc := ecpb.NewEchoClient(healthConn)
+		for deadline := time.Now().Add(*healthDuration); time.Now().Before(deadline); time.Sleep(time.Second) {
+			callUnaryEcho(hwc, "this is examples/load_balancing with health checking")
+		}
+	}
+
+	if *channelzAddr != "" {
+		// Keep both connections open so their channels and subchannels can be
+		// inspected with the channelz command.
+		log.Printf("Inspect the connections from the repository root with: cd common && go run ./cmd/channelz -addr %s (Ctrl+C to exit)", *channelzAddr)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+	}
 }
 
 // Name resolver implementation
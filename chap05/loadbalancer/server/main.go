@@ -2,21 +2,34 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/channelz"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
 )
 
 var (
 	addrs = []string{":50051", ":50052"}
+
+	enableChannelz = flag.Bool("channelz", false, "register the channelz service on every server")
+	flipInterval   = flag.Duration("flip-interval", 0, "toggle the health of the second server between SERVING and NOT_SERVING at this interval (0 disables)")
 )
 
+// echoService is the service name clients watch through the health service.
+const echoService = "grpc.examples.echo.Echo"
+
 type ecServer struct {
 	addr string
 
@@ -36,27 +49,53 @@ func (s *ecServer) BidirectionalStreamingEcho(ecpb.Echo_BidirectionalStreamingEc
 	return status.Errorf(codes.Unimplemented, "not implemented")
 }
 
-func startServer(addr string) {
+func startServer(addr string, healthServer *health.Server) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	s := grpc.NewServer()
 	ecpb.RegisterEchoServer(s, &ecServer{addr: addr})
+	healthpb.RegisterHealthServer(s, healthServer)
+	if *enableChannelz {
+		channelz.Register(s)
+	}
 	log.Printf("serving on %s\n", addr)
-	if err := s.Serve(lis); err != nil {
+	if err := lifecycle.New(s, lifecycle.Options{Health: healthServer}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
 
+// flipHealth toggles the serving status of the echo service of healthServer
+// every interval, simulating a backend that keeps failing and recovering.
+func flipHealth(addr string, healthServer *health.Server, interval time.Duration) {
+	serving := true
+	for range time.Tick(interval) {
+		serving = !serving
+		st := healthpb.HealthCheckResponse_SERVING
+		if !serving {
+			st = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		log.Printf("%s: setting %s to %v", addr, echoService, st)
+		healthServer.SetServingStatus(echoService, st)
+	}
+}
+
 func main() {
+	flag.Parse()
 	var wg sync.WaitGroup
-	for _, addr := range addrs {
+	for i, addr := range addrs {
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus(echoService, healthpb.HealthCheckResponse_SERVING)
+		if i == 1 && *flipInterval > 0 {
+			go flipHealth(addr, healthServer, *flipInterval)
+		}
+
 		wg.Add(1)
 		go func(addr string) {
 			defer wg.Done()
-			startServer(addr)
+			startServer(addr, healthServer)
 		}(addr)
 	}
 	wg.Wait()
-}
\ No newline at end of file
+}
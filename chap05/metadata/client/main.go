@@ -12,6 +12,8 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -21,7 +23,9 @@ const (
 
 func main() {
 	// Setting up a connection to the server.
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(requestid.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(requestid.StreamClientInterceptor()))
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -40,6 +44,11 @@ func main() {
 	)
 	mdCtx := metadata.NewOutgoingContext(context.Background(), md)
 
+	// ****** Metadata : Request ID *****
+	// Every call made with this context carries the same "x-request-id", so the
+	// whole session can be found in the server logs.
+	mdCtx = requestid.NewContext(mdCtx, requestid.New())
+
 	ctxA := metadata.AppendToOutgoingContext(mdCtx, "k1", "v1", "k1", "v2", "k2", "v3")
 
 
@@ -70,6 +79,9 @@ func main() {
 	} else {
 		log.Fatal("location expected but doesn't exist in header")
 	}
+	if id := header.Get(requestid.HeaderKey); len(id) > 0 {
+		log.Printf("request id from header: %s", id[0])
+	}
 
 
 	// Search Order
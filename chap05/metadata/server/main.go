@@ -18,6 +18,10 @@ import (
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 
 )
@@ -38,7 +42,8 @@ type server struct {
 // Simple RPC
 func (s *server) AddOrder(ctx context.Context, orderReq *pb.Order) (*wrappers.StringValue, error) {
 	orderMap[orderReq.Id] = *orderReq
-	log.Println("Order : ", orderReq.Id, " -> Added")
+	requestID, _ := requestid.FromContext(ctx)
+	log.Println("Order : ", orderReq.Id, " -> Added", "[request-id:", requestID+"]")
 
 	// ***** Reading Metadata from Client *****
 	md, metadataAvailable := metadata.FromIncomingContext(ctx)
@@ -166,11 +171,15 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	// The request ID interceptors accept or generate the "x-request-id" of every
+	// call and echo it back in the response header and trailer.
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(requestid.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(requestid.StreamServerInterceptor()))
 	pb.RegisterOrderManagementServer(s, &server{})
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+	if err := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"io"
 	"log"
 	"net"
@@ -13,14 +14,23 @@ import (
 	hello_pb "google.golang.org/grpc/examples/helloworld/helloworld"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/recording"
+
 	ordermgt_pb "github.com/cuongpiger/golang/ecommerce"
 )
 
 const (
-	port           = ":50051"
 	orderBatchSize = 3
 )
 
+var (
+	port     = flag.String("port", ":50051", "address to serve on")
+	services = flag.String("services", "greeter,orders", "comma-separated services to host: greeter, orders or both, for running them behind the proxy in separate processes")
+	record   = flag.String("record", "", "append every call served to this recording, for replaying against another server version")
+)
+
 var orderMap = make(map[string]ordermgt_pb.Order)
 
 type helloServer struct {
@@ -143,22 +153,42 @@ func (s *orderMgtServer) ProcessOrders(stream ordermgt_pb.OrderManagement_Proces
 }
 
 func main() {
+	flag.Parse()
 	initSampleData()
-	lis, err := net.Listen("tcp", port)
+	lis, err := net.Listen("tcp", *port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer()
-
-	// Register Order Management service on gRPC orderMgtServer
-	ordermgt_pb.RegisterOrderManagementServer(grpcServer, &orderMgtServer{})
-
-	// Register Greeter Service on gRPC orderMgtServer
-	hello_pb.RegisterGreeterServer(grpcServer, &helloServer{})
+	var opts []grpc.ServerOption
+	if *record != "" {
+		f, err := recording.Create(*record)
+		if err != nil {
+			log.Fatalf("failed to open recording: %v", err)
+		}
+		defer f.Close()
+		rec := recording.NewRecorder(f, recording.Options{})
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(rec.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(rec.StreamServerInterceptor()))
+	}
+	grpcServer := grpc.NewServer(opts...)
+
+	for _, name := range strings.Split(*services, ",") {
+		switch name {
+		case "orders":
+			// Register Order Management service on gRPC orderMgtServer
+			ordermgt_pb.RegisterOrderManagementServer(grpcServer, &orderMgtServer{})
+		case "greeter":
+			// Register Greeter Service on gRPC orderMgtServer
+			hello_pb.RegisterGreeterServer(grpcServer, &helloServer{})
+		default:
+			log.Fatalf("unknown service %q", name)
+		}
+	}
 
 	// Register reflection service on gRPC orderMgtServer.
 	reflection.Register(grpcServer)
-	if err := grpcServer.Serve(lis); err != nil {
+	if err := lifecycle.New(grpcServer, lifecycle.Options{Health: stdhealth.Register(grpcServer)}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
@@ -1,17 +1,21 @@
 module github.com/cuongpiger/golang
 
-go 1.23.1
+go 1.23.4
 
 require (
-	github.com/golang/protobuf v1.5.4
+	github.com/cuongpiger/grpc-up-and-running/common v0.0.0
 	github.com/google/uuid v1.6.0
 	google.golang.org/grpc v1.73.0
 	google.golang.org/protobuf v1.36.6
 )
 
 require (
+	go.opentelemetry.io/otel v1.35.0 // indirect
+	go.opentelemetry.io/otel/trace v1.35.0 // indirect
 	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
 )
+
+replace github.com/cuongpiger/grpc-up-and-running/common => ../../../common
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"errors"
+	"flag"
 	"log"
 	"net"
 	"os"
@@ -18,6 +19,10 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/audit"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -30,6 +35,7 @@ type server struct {
 
 var (
 	port               = ":50051"
+	auditLog           = flag.String("audit-log", "audit.log", "file recording AddProduct calls")
 	errMissingMetadata = status.Errorf(codes.InvalidArgument, "missing metadata")
 	errInvalidToken    = status.Errorf(codes.Unauthenticated, "invalid credentials")
 )
@@ -58,6 +64,7 @@ func (s *server) GetProduct(ctx context.Context, in *pb.ProductID) (*pb.Product,
 }
 
 func main() {
+	flag.Parse()
 	wd, _ := os.Getwd()
 	serverCert := filepath.Join(wd, "..", "certs", "server.crt")
 	serverKey := filepath.Join(wd, "..", "certs", "server.key")
@@ -66,11 +73,20 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load key pair: %s", err)
 	}
+
+	// Record every AddProduct call, including rejected ones, in a hash-chained
+	// audit log. Check it with: go run ../../../common/cmd/auditverify audit.log
+	auditTrail, err := audit.Open(*auditLog)
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	auditor := audit.New(auditTrail, audit.DefaultMethods, nil)
+
 	opts := []grpc.ServerOption{
 		// Enable TLS for all incoming connections.
 		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
 
-		grpc.UnaryInterceptor(ensureValidBasicCredentials),
+		grpc.ChainUnaryInterceptor(auditor.UnaryServerInterceptor(), ensureValidBasicCredentials),
 	}
 
 	s := grpc.NewServer(opts...)
@@ -83,7 +99,10 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	if err := s.Serve(lis); err != nil {
+	// The audit log is closed only after the last calls have been recorded.
+	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+	runner.OnShutdown("audit log", func(context.Context) error { return auditTrail.Close() })
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
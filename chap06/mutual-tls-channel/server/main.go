@@ -14,6 +14,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -94,7 +97,7 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	if err := s.Serve(lis); err != nil {
+	if err := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
@@ -18,6 +18,11 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/debugz"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
 
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
@@ -95,15 +100,8 @@ func initTracer(zsp *zpages.SpanProcessor) (*sdktrace.TracerProvider, error) {
 }
 
 func main() {
-	ctx := context.Background()
-
 	// Setup OpenTelemetry tracing
 	shutdown := setupTracing()
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatalf("error shutting down tracing: %v", err)
-		}
-	}()
 
 	// Set up zPages for tracing visualization/debugging
 	zsp := zpages.NewSpanProcessor()
@@ -112,35 +110,46 @@ func main() {
 		log.Fatal(err)
 	}
 
-	go func() {
-		http.Handle("/debug/zpages/tracez", zpages.NewTracezHandler(zsp))
-		log.Println("View tracez at http://localhost:7777/debug/zpages/tracez, public API at http://localhost:7777/hello")
-		err = http.ListenAndServe("localhost:7777", nil)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}()
-
-	// Create a gRPC Server with OpenTelemetry interceptors
+	// Create a gRPC Server with OpenTelemetry interceptors. The debug monitor
+	// records active RPCs, latencies and errors for the debug pages.
+	monitor := debugz.NewMonitor()
 	grpcServer := grpc.NewServer(
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(monitor.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(monitor.StreamServerInterceptor()),
 	)
 
 	pb.RegisterProductInfoServer(grpcServer, &server{})
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	healthServer.SetServingStatus("ecommerce.ProductInfo", healthpb.HealthCheckResponse_SERVING)
+
+	// All debug pages share one admin mux: rpcz, servicez, healthz and
+	// channelz from debugz, plus the OpenTelemetry tracez page.
+	mux := debugz.NewMux(debugz.Options{Monitor: monitor, Server: grpcServer, Health: healthServer})
+	mux.Handle("/debug/zpages/tracez", zpages.NewTracezHandler(zsp))
+	debugServer := &http.Server{Addr: "localhost:7777", Handler: mux}
+	go func() {
+		log.Println("View debug pages at http://localhost:7777/debug/ and tracez at http://localhost:7777/debug/zpages/tracez")
+		if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
+	// On SIGTERM the health service reports NOT_SERVING, in-flight calls are
+	// drained, then the spans still buffered by the exporters are flushed.
+	runner := lifecycle.New(grpcServer, lifecycle.Options{Health: healthServer})
+	runner.OnShutdown("stdout tracing", shutdown)
+	runner.OnShutdown("tracer provider", tp.Shutdown)
+	runner.OnShutdown("debug pages", debugServer.Shutdown)
+
 	log.Printf("🚀 gRPC Server running on port %v\n", port)
-	if err := grpcServer.Serve(lis); err != nil {
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
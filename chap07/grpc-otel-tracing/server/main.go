@@ -17,6 +17,9 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -67,7 +70,6 @@ func (s *server) GetProduct(ctx context.Context, in *pb.ProductID) (*pb.Product,
 
 func main() {
 	shutdown := initTracing()
-	defer shutdown()
 
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
@@ -81,12 +83,16 @@ func main() {
 	pb.RegisterProductInfoServer(grpcServer, &server{})
 	log.Printf("🚀 gRPC Server running on port %v\n", port)
 
-	if err := grpcServer.Serve(lis); err != nil {
+	// The tracer provider is shut down once the server has drained, so the
+	// spans of the last calls are still exported.
+	runner := lifecycle.New(grpcServer, lifecycle.Options{Health: stdhealth.Register(grpcServer)})
+	runner.OnShutdown("tracer provider", shutdown)
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
 
-func initTracing() func() {
+func initTracing() func(context.Context) error {
 	exp, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpointURL("http://localhost:14268/api/traces"))
 	if err != nil {
 		log.Fatalf("failed to initialize OTLP exporter: %v", err)
@@ -103,9 +109,5 @@ func initTracing() func() {
 
 	otel.SetTracerProvider(tp)
 
-	return func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down tracing: %v", err)
-		}
-	}
+	return tp.Shutdown
 }
@@ -14,6 +14,8 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	pb "github.com/cuongpiger/golang/ecommerce"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/breaker"
 )
 
 const (
@@ -28,11 +30,25 @@ func main() {
 	// Register client metrics to registry.
 	reg.MustRegister(grpcMetrics)
 
+	// Stop calling the server while it is degraded: after 5 failures out of
+	// at least 10 calls in 30s, calls fail fast with Unavailable for 10s.
+	breakerMetrics, err := breaker.NewMetrics(reg)
+	if err != nil {
+		log.Fatalf("failed to register circuit breaker metrics: %v", err)
+	}
+	breakers := breaker.New(breaker.Options{
+		Window:      30 * time.Second,
+		MinCalls:    10,
+		SlowCall:    500 * time.Millisecond,
+		OpenTimeout: 10 * time.Second,
+		Metrics:     breakerMetrics,
+	})
+
 	// Set up a connection to the server.
 	conn, err := grpc.NewClient(address,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(grpcMetrics.UnaryClientInterceptor()),
-		grpc.WithStreamInterceptor(grpcMetrics.StreamClientInterceptor()),
+		grpc.WithChainUnaryInterceptor(breakers.UnaryClientInterceptor(), grpcMetrics.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(breakers.StreamClientInterceptor(), grpcMetrics.StreamClientInterceptor()),
 	)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
@@ -60,13 +76,18 @@ func main() {
 		defer cancel()
 		r, err := c.AddProduct(ctx, &pb.Product{Name: name, Description: description, Price: price})
 		if err != nil {
-			log.Fatalf("Could not add product: %v", err)
+			// Keep going: the circuit breaker fails calls fast while the
+			// server is down and lets trial calls through once it is back.
+			log.Printf("Could not add product: %v", err)
+			time.Sleep(time.Second)
+			continue
 		}
 		log.Printf("Product ID: %s added successfully", r.Value)
 
 		product, err := c.GetProduct(ctx, &pb.ProductID{Value: r.Value})
 		if err != nil {
-			log.Fatalf("Could not get product: %v", err)
+			log.Printf("Could not get product: %v", err)
+			continue
 		}
 		log.Printf("Product: ", product.String())
 		time.Sleep(3 * time.Second)
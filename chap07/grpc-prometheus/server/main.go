@@ -19,6 +19,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/shed"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -84,10 +88,20 @@ func main() {
 	// Create a HTTP server for prometheus.
 	httpServer := &http.Server{Handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), Addr: fmt.Sprintf("0.0.0.0:%d", 9092)}
 
-	// Create a gRPC Server with gRPC interceptor.
+	// Shed load adaptively: the concurrency limit follows the handler
+	// latency and calls with a low x-priority header are rejected first.
+	// Callers are not authenticated, so higher claims count as normal.
+	shedMetrics, err := shed.NewMetrics(reg)
+	if err != nil {
+		log.Fatalf("failed to register load shedding metrics: %v", err)
+	}
+	shedder := shed.New(shed.Options{Metrics: shedMetrics})
+
+	// Create a gRPC Server with gRPC interceptor. Shed calls are counted by
+	// grpcMetrics as UNAVAILABLE.
 	grpcServer := grpc.NewServer(
-		grpc.StreamInterceptor(grpcMetrics.StreamServerInterceptor()),
-		grpc.UnaryInterceptor(grpcMetrics.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(grpcMetrics.StreamServerInterceptor(), shedder.StreamServerInterceptor()),
+		grpc.ChainUnaryInterceptor(grpcMetrics.UnaryServerInterceptor(), shedder.UnaryServerInterceptor()),
 	)
 
 	pb.RegisterProductInfoServer(grpcServer, &server{})
@@ -96,12 +110,16 @@ func main() {
 
 	// Start your http server for prometheus.
 	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal("Unable to start a http server.")
 		}
 	}()
 
-	if err := grpcServer.Serve(lis); err != nil {
+	// The metrics endpoint stays up until the gRPC server has drained, so the
+	// last scrape sees the final counters.
+	runner := lifecycle.New(grpcServer, lifecycle.Options{Health: stdhealth.Register(grpcServer)})
+	runner.OnShutdown("metrics server", httpServer.Shutdown)
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
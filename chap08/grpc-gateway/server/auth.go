@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The credentials of chap06: basic admin:admin, or the bearer token
+// some-secret-token.
+var (
+	validBasic  = "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:admin"))
+	validBearer = "Bearer some-secret-token"
+)
+
+// authenticated reports whether the call carries valid credentials in its
+// authorization metadata, as sent by gRPC clients or forwarded from the
+// Authorization header by the gateway.
+func authenticated(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if auth == validBasic || auth == validBearer {
+			return true
+		}
+	}
+	return false
+}
+
+// requiresAuth reports whether method belongs to the ecommerce services;
+// health and reflection stay open.
+func requiresAuth(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/ecommerce.")
+}
+
+var errUnauthenticated = status.Error(codes.Unauthenticated, "missing or invalid credentials")
+
+func authUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if requiresAuth(info.FullMethod) && !authenticated(ctx) {
+		return nil, errUnauthenticated
+	}
+	return handler(ctx, req)
+}
+
+func authStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if requiresAuth(info.FullMethod) && !authenticated(ss.Context()) {
+		return errUnauthenticated
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/yaml.v3"
+)
+
+// gatewayConfig configures what crosses the gateway besides the messages.
+type gatewayConfig struct {
+	// ForwardHeaders are the request headers sent to the services as
+	// metadata under their lower case name, e.g. Authorization or Cookie.
+	// Other headers are only sent prefixed with grpcgateway-, as the
+	// runtime does, or not at all.
+	ForwardHeaders []string `yaml:"forwardHeaders"`
+
+	// ResponseHeaders are the response metadata keys written as HTTP
+	// response headers under the same name, e.g. location. Other keys are
+	// written prefixed with Grpc-Metadata-.
+	ResponseHeaders []string `yaml:"responseHeaders"`
+
+	CORS corsPolicy `yaml:"cors"`
+}
+
+// corsPolicy is the CORS policy of the port, for REST and gRPC-Web calls
+// made by browsers.
+type corsPolicy struct {
+	// AllowedOrigins are the origins allowed to call, "*" for any, which
+	// cannot be combined with AllowCredentials and does not apply to the
+	// WebSocket.
+	AllowedOrigins   []string `yaml:"allowedOrigins"`
+	AllowedMethods   []string `yaml:"allowedMethods"`
+	AllowedHeaders   []string `yaml:"allowedHeaders"`
+	ExposedHeaders   []string `yaml:"exposedHeaders"`
+	AllowCredentials bool     `yaml:"allowCredentials"`
+	// MaxAge is how long, in seconds, browsers may cache a preflight.
+	MaxAge int `yaml:"maxAge"`
+}
+
+// defaultGatewayConfig forwards the credentials and request ID and allows no
+// cross-origin calls.
+func defaultGatewayConfig() gatewayConfig {
+	return gatewayConfig{
+		ForwardHeaders:  []string{"Authorization", "Cookie", "X-Request-Id"},
+		ResponseHeaders: []string{"location"},
+	}
+}
+
+// loadGatewayConfig reads a YAML gateway configuration. An empty path
+// returns defaultGatewayConfig.
+func loadGatewayConfig(path string) (gatewayConfig, error) {
+	if path == "" {
+		return defaultGatewayConfig(), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return gatewayConfig{}, err
+	}
+	var c gatewayConfig
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		return gatewayConfig{}, err
+	}
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		return gatewayConfig{}, fmt.Errorf("%s: cors: allowedOrigins cannot include \"*\" with allowCredentials, as any site could call with the cookies of its visitors", path)
+	}
+	return c, nil
+}
+
+func headerSet(keys []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, k := range keys {
+		set[textproto.CanonicalMIMEHeaderKey(k)] = true
+	}
+	return set
+}
+
+// serveMuxOptions returns the header matchers of the gateway mux.
+func (c gatewayConfig) serveMuxOptions() []runtime.ServeMuxOption {
+	forward := headerSet(c.ForwardHeaders)
+	response := headerSet(c.ResponseHeaders)
+	return []runtime.ServeMuxOption{
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			// The runtime always forwards Authorization itself; stripHeaders
+			// removes it when it is not configured.
+			if key == "Authorization" {
+				return "", false
+			}
+			if forward[key] {
+				return strings.ToLower(key), true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+		runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			key = textproto.CanonicalMIMEHeaderKey(key)
+			switch {
+			case response[key]:
+				return key, true
+			case key == "Content-Type" || key == "Trailer":
+				// Set by the gRPC transport, not by the services.
+				return "", false
+			}
+			return runtime.MetadataHeaderPrefix + key, true
+		}),
+	}
+}
+
+// stripHeaders removes the Authorization header, which the runtime forwards
+// unconditionally, when it is not configured.
+func (c gatewayConfig) stripHeaders(h http.Handler) http.Handler {
+	if headerSet(c.ForwardHeaders)["Authorization"] {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Authorization")
+		h.ServeHTTP(w, r)
+	})
+}
+
+// outgoingMetadata returns the forwarded headers of r as metadata, for the
+// calls the gateway makes outside of the runtime.
+func (c gatewayConfig) outgoingMetadata(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for _, k := range c.ForwardHeaders {
+		if vv := r.Header.Values(k); len(vv) > 0 {
+			md.Append(strings.ToLower(k), vv...)
+		}
+	}
+	return md
+}
+
+// handler applies the policy: preflight requests from allowed origins are
+// answered, other requests from allowed origins get the CORS response
+// headers, and preflight requests from other origins are refused.
+func (p corsPolicy) handler(h http.Handler) http.Handler {
+	origins := make(map[string]bool)
+	for _, o := range p.AllowedOrigins {
+		origins[o] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed := origins[origin] || origins["*"]
+		hdr := w.Header()
+		hdr.Add("Vary", "Origin")
+		if !allowed {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if origins["*"] && !p.AllowCredentials {
+			hdr.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			hdr.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.AllowCredentials {
+			hdr.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if len(p.ExposedHeaders) > 0 {
+				hdr.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		hdr.Add("Vary", "Access-Control-Request-Method")
+		hdr.Add("Vary", "Access-Control-Request-Headers")
+		if len(p.AllowedMethods) > 0 {
+			hdr.Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+		}
+		if len(p.AllowedHeaders) > 0 {
+			hdr.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+		}
+		if p.MaxAge > 0 {
+			hdr.Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
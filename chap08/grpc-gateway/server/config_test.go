@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLoadGatewayConfig(t *testing.T) {
+	cfg, err := loadGatewayConfig("gateway.yaml")
+	if err != nil {
+		t.Fatalf("loading gateway.yaml: %v", err)
+	}
+	if !headerSet(cfg.ForwardHeaders)["Authorization"] || len(cfg.CORS.AllowedOrigins) == 0 {
+		t.Errorf("gateway.yaml = %+v", cfg)
+	}
+
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	if err := os.WriteFile(path, []byte("cors:\n  allowedOrigins: [\"*\"]\n  allowCredentials: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadGatewayConfig(path); err == nil {
+		t.Error("loading any origin with credentials succeeded")
+	}
+}
+
+func get(t *testing.T, url string, header map[string]string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return res
+}
+
+func TestAuthThroughGateway(t *testing.T) {
+	addr := startServerWith(t, defaultGatewayConfig(),
+		grpc.ChainUnaryInterceptor(authUnaryInterceptor),
+		grpc.ChainStreamInterceptor(authStreamInterceptor))
+	url := "http://" + addr + "/v1/orders/102"
+
+	res := get(t, url, nil)
+	if res.StatusCode != http.StatusUnauthorized || !strings.Contains(res.Header.Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("without credentials: %d, WWW-Authenticate %q; want 401 with a challenge", res.StatusCode, res.Header.Get("WWW-Authenticate"))
+	}
+	for _, auth := range []string{
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("admin:admin")),
+		"Bearer some-secret-token",
+	} {
+		if res := get(t, url, map[string]string{"Authorization": auth}); res.StatusCode != http.StatusOK {
+			t.Errorf("with %q: %d, want 200", auth, res.StatusCode)
+		}
+	}
+
+	// Without Authorization among the forwarded headers, the credentials
+	// stay at the gateway.
+	cfg := defaultGatewayConfig()
+	cfg.ForwardHeaders = []string{"Cookie"}
+	addr = startServerWith(t, cfg, grpc.ChainUnaryInterceptor(authUnaryInterceptor))
+	if res := get(t, "http://"+addr+"/v1/orders/102", map[string]string{"Authorization": "Bearer some-secret-token"}); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("with Authorization not forwarded: %d, want 401", res.StatusCode)
+	}
+}
+
+func TestAuthThroughWebSocket(t *testing.T) {
+	addr := startServerWith(t, defaultGatewayConfig(), grpc.ChainStreamInterceptor(authStreamInterceptor))
+	for _, tc := range []struct {
+		auth string
+		want string
+	}{
+		{"", `{"error":{"title":"Unauthorized","status":401,`},
+		{"Bearer some-secret-token", `"cmb - San Jose, CA"`},
+	} {
+		cfg, err := websocket.NewConfig("ws://"+addr+"/v1/orders/process", "http://"+addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.auth != "" {
+			cfg.Header.Set("Authorization", tc.auth)
+		}
+		ws, err := websocket.DialConfig(cfg)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		websocket.Message.Send(ws, "103")
+		websocket.Message.Send(ws, "")
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil || !strings.Contains(msg, tc.want) {
+			t.Errorf("Authorization %q: received %q, %v; want %s", tc.auth, msg, err, tc.want)
+		}
+		ws.Close()
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	cfg := defaultGatewayConfig()
+	cfg.CORS.AllowedOrigins = []string{"http://localhost:3000", "*"}
+	addr := startServerWith(t, cfg)
+	for _, tc := range []struct {
+		origin string
+		ok     bool
+	}{
+		{"http://" + addr, true},
+		{"http://localhost:3000", true},
+		{"http://evil.example", false},
+	} {
+		wsCfg, err := websocket.NewConfig("ws://"+addr+"/v1/orders/process", tc.origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wsCfg.Header.Set("Cookie", "session=abc")
+		ws, err := websocket.DialConfig(wsCfg)
+		if (err == nil) != tc.ok {
+			t.Errorf("Origin %s: Dial error %v, want allowed %v", tc.origin, err, tc.ok)
+		}
+		if err == nil {
+			ws.Close()
+		}
+	}
+}
+
+func TestHeaderForwarding(t *testing.T) {
+	seen := make(chan metadata.MD, 1)
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- md
+		return handler(ctx, req)
+	}
+	addr := startServerWith(t, defaultGatewayConfig(), grpc.ChainUnaryInterceptor(record))
+
+	req, _ := http.NewRequest("POST", "http://"+addr+"/v1/product", strings.NewReader(`{"name": "Pixel"}`))
+	req.Header.Set("Authorization", "Bearer some-secret-token")
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("X-Request-Id", "req-7")
+	req.Header.Set("X-Debug", "1")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	json.NewDecoder(res.Body).Decode(&id)
+	res.Body.Close()
+
+	md := <-seen
+	for k, want := range map[string]string{"authorization": "Bearer some-secret-token", "cookie": "session=abc", "x-request-id": "req-7"} {
+		if got := md.Get(k); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s = %q, want [%q]", k, got, want)
+		}
+	}
+	if got := md.Get("x-debug"); len(got) != 0 {
+		t.Errorf("metadata x-debug = %q, want it not forwarded", got)
+	}
+
+	if loc := res.Header.Get("Location"); loc != "/v1/product/"+id {
+		t.Errorf("Location = %q, want /v1/product/%s", loc, id)
+	}
+	for _, h := range []string{"Grpc-Metadata-Content-Type", "Grpc-Metadata-Trailer"} {
+		if v := res.Header.Values(h); len(v) > 0 {
+			t.Errorf("%s = %q, want transport headers dropped", h, v)
+		}
+	}
+	if got := res.Header.Values("X-Request-Id"); len(got) != 1 || got[0] != "req-7" {
+		t.Errorf("X-Request-Id = %q, want [req-7]", got)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cfg, err := loadGatewayConfig("gateway.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startServerWith(t, cfg)
+
+	preflight := func(origin string) *http.Response {
+		req, _ := http.NewRequest("OPTIONS", "http://"+addr+"/ecommerce.OrderManagement/getOrder", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	res := preflight("http://localhost:3000")
+	if res.StatusCode != http.StatusNoContent || res.Header.Get("Access-Control-Allow-Origin") != "http://localhost:3000" ||
+		!strings.Contains(res.Header.Get("Access-Control-Allow-Headers"), "X-Grpc-Web") || res.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("preflight from an allowed origin = %d %v", res.StatusCode, res.Header)
+	}
+	if res := preflight("http://evil.example"); res.StatusCode != http.StatusForbidden || res.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight from another origin = %d %v, want 403", res.StatusCode, res.Header)
+	}
+
+	// Both the REST routes and gRPC-Web calls get the CORS headers.
+	res = get(t, "http://"+addr+"/v1/orders/102", map[string]string{"Origin": "http://localhost:3000"})
+	if res.Header.Get("Access-Control-Allow-Origin") != "http://localhost:3000" || !strings.Contains(res.Header.Get("Access-Control-Expose-Headers"), "X-Request-Id") {
+		t.Errorf("REST response headers = %v", res.Header)
+	}
+	req, _ := http.NewRequest("POST", "http://"+addr+"/ecommerce.OrderManagement/getOrder", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Origin", "http://localhost:3000")
+	grpcWeb, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcWeb.Body.Close()
+	if grpcWeb.Header.Get("Access-Control-Allow-Origin") != "http://localhost:3000" || grpcWeb.Header.Get("Content-Type") != "application/grpc-web+proto" {
+		t.Errorf("gRPC-Web response headers = %v", grpcWeb.Header)
+	}
+}
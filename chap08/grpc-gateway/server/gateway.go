@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/problem"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+
+	pb "github.com/cuongpiger/golang/proto"
+)
+
+// mimeNDJSON selects newline-delimited JSON, e.g. with
+// "Accept: application/x-ndjson" on GET /v1/orders/search/{value}. Streams
+// are delimited by newlines whatever the marshaler; this only sets the
+// matching content type.
+const mimeNDJSON = "application/x-ndjson"
+
+var jsonMarshaler = &runtime.JSONPb{OrigName: true}
+
+// streamErrorType is the type of the error chunk ending a failed stream,
+// which the runtime passes to the marshaler as its internal twin.
+var streamErrorType = reflect.TypeOf((*runtime.StreamError)(nil))
+
+// gatewayMarshaler is jsonMarshaler writing the chunk ending a failed stream
+// as {"error": <problem details>}, like the body of a failed unary call,
+// rather than as the runtime's own StreamError.
+type gatewayMarshaler struct {
+	*runtime.JSONPb
+}
+
+func (m gatewayMarshaler) Marshal(v interface{}) ([]byte, error) {
+	if chunk, ok := v.(map[string]proto.Message); ok && len(chunk) == 1 && chunk["error"] != nil {
+		if e := reflect.ValueOf(chunk["error"]); e.Type().ConvertibleTo(streamErrorType) {
+			serr := e.Convert(streamErrorType).Interface().(*runtime.StreamError)
+			return json.Marshal(map[string]*problem.Problem{"error": streamProblem(serr)})
+		}
+	}
+	return m.JSONPb.Marshal(v)
+}
+
+// ndjson is gatewayMarshaler advertising the NDJSON content type.
+type ndjson struct {
+	gatewayMarshaler
+}
+
+func (ndjson) ContentType() string { return mimeNDJSON }
+
+// streamErrorHandler describes a stream failing with err by its problem
+// details: the HTTP status, sent if no message was, follows the same mapping
+// as failed unary calls. The request ID is added as a RequestInfo detail for
+// gatewayMarshaler, which only sees the StreamError.
+func streamErrorHandler(ctx context.Context, err error) *runtime.StreamError {
+	st := status.Convert(err)
+	p := problem.FromStatus(st)
+	details := st.Proto().GetDetails()
+	if id, ok := requestid.FromContext(ctx); ok {
+		if a, err := anypb.New(&errdetails.RequestInfo{RequestId: id}); err == nil {
+			details = append(details, a)
+		}
+	}
+	return &runtime.StreamError{
+		GrpcCode:   int32(st.Code()),
+		HttpCode:   int32(p.Status),
+		Message:    st.Message(),
+		HttpStatus: p.Title,
+		Details:    details,
+	}
+}
+
+// streamProblem returns the problem details of serr, taking the request ID
+// out of its details.
+func streamProblem(serr *runtime.StreamError) *problem.Problem {
+	var id string
+	details := make([]*anypb.Any, 0, len(serr.Details))
+	for _, a := range serr.Details {
+		var info errdetails.RequestInfo
+		if a.MessageIs(&info) && a.UnmarshalTo(&info) == nil {
+			id = info.GetRequestId()
+			continue
+		}
+		details = append(details, a)
+	}
+	p := problem.FromStatus(status.FromProto(&spb.Status{Code: serr.GrpcCode, Message: serr.Message, Details: details}))
+	p.RequestID = id
+	return p
+}
+
+// dialGateway returns the connection the gateway calls the services
+// through, with creds, or in plaintext if nil. It sends the request ID of the
+// REST request with every call.
+func dialGateway(target string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	return grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(requestid.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(requestid.StreamClientInterceptor()))
+}
+
+// errorHandler writes failed calls as problem details, mapping the gRPC code
+// to the HTTP status and flattening the error details. Requests matching no
+// route fail with runtime.ErrUnknownURI, reported as 404 rather than the
+// UNIMPLEMENTED it carries.
+func errorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if err == runtime.ErrUnknownURI {
+		err = status.Errorf(codes.NotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+	if status.Code(err) == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ecommerce", Bearer realm="ecommerce"`)
+	}
+	problem.Write(w, r, err)
+}
+
+// newGateway returns the REST gateway of the ProductInfo and OrderManagement
+// services, calling them through conn:
+//
+//	POST /v1/product             addProduct
+//	GET  /v1/product/{value}     getProduct
+//	POST /v1/orders              addOrder
+//	GET  /v1/orders/{value}      getOrder
+//	GET  /v1/orders/search/{value}  searchOrders, one {"result": Order} per line
+//	POST /v1/orders/bulk         updateOrders, the body is a sequence of orders
+//	GET  /v1/orders/process      processOrders over a WebSocket
+//	GET  /openapi.json           the OpenAPI document of the routes above
+//	GET  /docs                   Swagger UI rendering it
+//
+// Every request gets a request ID, taken from its X-Request-Id header or
+// generated, which is sent to the services, echoed in the response and
+// included in the problem details of failed calls. A failed stream ends with
+// an {"error": <problem details>} chunk instead, after the messages already
+// sent. cfg selects the headers forwarded as metadata both ways.
+func newGateway(ctx context.Context, conn *grpc.ClientConn, cfg gatewayConfig) (http.Handler, error) {
+	gwmux := runtime.NewServeMux(append([]runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, gatewayMarshaler{jsonMarshaler}),
+		runtime.WithMarshalerOption(mimeNDJSON, ndjson{gatewayMarshaler{jsonMarshaler}}),
+		runtime.WithProtoErrorHandler(errorHandler),
+		runtime.WithStreamErrorHandler(streamErrorHandler),
+	}, cfg.serveMuxOptions()...)...)
+	if err := pb.RegisterProductInfoHandler(ctx, gwmux, conn); err != nil {
+		return nil, err
+	}
+	if err := pb.RegisterOrderManagementHandler(ctx, gwmux, conn); err != nil {
+		return nil, err
+	}
+
+	docs, err := docsHandler()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(processOrdersPath, processOrdersHandler(pb.NewOrderManagementClient(conn), cfg))
+	mux.Handle("/openapi.json", docs)
+	mux.Handle("/docs", docs)
+	mux.Handle("/", gwmux)
+	return requestid.Handler(cfg.stripHeaders(mux)), nil
+}
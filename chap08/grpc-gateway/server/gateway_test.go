@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	wrapper "github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/portmux"
+	"github.com/cuongpiger/grpc-up-and-running/common/problem"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+
+	pb "github.com/cuongpiger/golang/proto"
+)
+
+// startServer serves the services and their gateway on one port, as main
+// does, and returns its address.
+func startServer(t *testing.T) string {
+	return startServerWith(t, defaultGatewayConfig())
+}
+
+// startServerWith is startServer with a gateway configuration and extra
+// server options, e.g. interceptors running after the request ID ones.
+func startServerWith(t *testing.T, cfg gatewayConfig, opts ...grpc.ServerOption) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(requestid.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(requestid.StreamServerInterceptor()),
+	}, opts...)...)
+	pb.RegisterProductInfoServer(s, &server{})
+	pb.RegisterOrderManagementServer(s, newOrderServer())
+	conn, err := dialGateway(lis.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway, err := newGateway(context.Background(), conn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := portmux.NewServer(s, gateway, cfg.CORS.handler)
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Close()
+		s.Stop()
+		conn.Close()
+	})
+	return lis.Addr().String()
+}
+
+func TestSearchOrdersNDJSON(t *testing.T) {
+	addr := startServer(t)
+	req, _ := http.NewRequest("GET", "http://"+addr+"/v1/orders/search/Google", nil)
+	req.Header.Set("Accept", mimeNDJSON)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != mimeNDJSON {
+		t.Errorf("Content-Type = %q, want %q", ct, mimeNDJSON)
+	}
+	var ids []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var line struct {
+			Result *pb.Order `json:"result"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Result == nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, line.Result.Id)
+	}
+	sort.Strings(ids)
+	if got := strings.Join(ids, ","); got != "102,104" {
+		t.Errorf("search returned orders %s, want 102,104", got)
+	}
+}
+
+func TestUpdateOrdersBulk(t *testing.T) {
+	addr := startServer(t)
+	body := `{"id":"102","items":["Google Pixel 4"],"destination":"Mountain View, CA","price":900}
+{"id":"103","items":["Apple Watch S5"],"destination":"San Jose, CA","price":450}
+`
+	res, err := http.Post("http://"+addr+"/v1/orders/bulk", mimeNDJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(b), "102, 103, ") {
+		t.Fatalf("POST /v1/orders/bulk = %d %s", res.StatusCode, b)
+	}
+
+	// The update is visible over gRPC on the same port.
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	order, err := pb.NewOrderManagementClient(conn).GetOrder(context.Background(), &wrapper.StringValue{Value: "103"})
+	if err != nil || order.Items[0] != "Apple Watch S5" {
+		t.Errorf("GetOrder(103) = %v, %v; want the updated order", order, err)
+	}
+}
+
+func TestProcessOrdersWebSocket(t *testing.T) {
+	addr := startServer(t)
+	ws, err := websocket.Dial("ws://"+addr+"/v1/orders/process", "", "http://"+addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+	// Order IDs are sent bare or as JSON strings; the empty message ends
+	// the stream.
+	for _, id := range []string{"102", `"103"`, "104", ""} {
+		if err := websocket.Message.Send(ws, id); err != nil {
+			t.Fatalf("Send(%q): %v", id, err)
+		}
+	}
+
+	var shipments []string
+	for {
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+		var shipment pb.CombinedShipment
+		if err := jsonMarshaler.Unmarshal([]byte(msg), &shipment); err != nil || shipment.Id == "" {
+			t.Fatalf("message %s: %v", msg, err)
+		}
+		shipments = append(shipments, shipment.Id)
+	}
+	sort.Strings(shipments)
+	if got := strings.Join(shipments, "|"); got != "cmb - Mountain View, CA|cmb - San Jose, CA" {
+		t.Errorf("shipments = %s", got)
+	}
+}
+
+func TestErrorProblemDetails(t *testing.T) {
+	addr := startServer(t)
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+		code               string
+		violations         []string
+	}{
+		{"GET", "/v1/product/missing", "", http.StatusNotFound, "NOT_FOUND", nil},
+		{"POST", "/v1/product", `{"price": -1}`, http.StatusBadRequest, "INVALID_ARGUMENT", []string{"name", "price"}},
+		{"POST", "/v1/orders/bulk", `{"id": "102"}{"price": 10}`, http.StatusBadRequest, "INVALID_ARGUMENT", []string{"id"}},
+		{"GET", "/v1/unknown", "", http.StatusNotFound, "NOT_FOUND", nil},
+	} {
+		req, _ := http.NewRequest(tc.method, "http://"+addr+tc.path, strings.NewReader(tc.body))
+		req.Header.Set("X-Request-Id", "req-"+tc.code)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p problem.Problem
+		err = json.NewDecoder(res.Body).Decode(&p)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("%s %s: decoding problem: %v", tc.method, tc.path, err)
+		}
+		if res.StatusCode != tc.status || p.Status != tc.status || p.Code != tc.code || res.Header.Get("Content-Type") != problem.ContentType {
+			t.Errorf("%s %s = %d %+v, want %d %s", tc.method, tc.path, res.StatusCode, p, tc.status, tc.code)
+		}
+		if p.RequestID != "req-"+tc.code || res.Header.Get("X-Request-Id") != p.RequestID {
+			t.Errorf("%s %s: request ID %q, header %q, want the one sent", tc.method, tc.path, p.RequestID, res.Header.Get("X-Request-Id"))
+		}
+		var fields []string
+		for _, v := range p.FieldViolations {
+			fields = append(fields, v.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(tc.violations, ",") {
+			t.Errorf("%s %s: field violations %v, want %v", tc.method, tc.path, fields, tc.violations)
+		}
+	}
+}
+
+// failAfterFirst fails every stream once its handler has sent one message.
+func failAfterFirst(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &failingStream{ServerStream: ss})
+}
+
+type failingStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *failingStream) SendMsg(m interface{}) error {
+	if s.sent++; s.sent > 1 {
+		return status.Error(codes.Unavailable, "backend overloaded")
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func TestStreamErrorProblemDetails(t *testing.T) {
+	addr := startServerWith(t, defaultGatewayConfig(), grpc.ChainStreamInterceptor(failAfterFirst))
+	req, _ := http.NewRequest("GET", "http://"+addr+"/v1/orders/search/Google", nil)
+	req.Header.Set("Accept", mimeNDJSON)
+	req.Header.Set("X-Request-Id", "req-stream")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var lines []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if res.StatusCode != http.StatusOK || len(lines) != 2 || !strings.HasPrefix(lines[0], `{"result":`) {
+		t.Fatalf("GET /v1/orders/search/Google = %d %q, want a result then an error", res.StatusCode, lines)
+	}
+	var last struct {
+		Error *problem.Problem `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &last); err != nil || last.Error == nil {
+		t.Fatalf("last line %s: %v", lines[1], err)
+	}
+	want := problem.Problem{Title: "Service Unavailable", Status: 503, Detail: "backend overloaded", Code: "UNAVAILABLE", RequestID: "req-stream"}
+	if !reflect.DeepEqual(*last.Error, want) {
+		t.Errorf("stream error = %+v, want %+v", *last.Error, want)
+	}
+}
@@ -7,14 +7,24 @@ package main
 
 import (
 	"context"
-	"errors"
+	"crypto/tls"
+	"flag"
 	"log"
 	"net"
 
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/portmux"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
 
 	pb "github.com/cuongpiger/golang/proto"
 )
@@ -23,6 +33,14 @@ const (
 	port = ":50051"
 )
 
+var (
+	tlsCert = flag.String("tls-cert", "", "serve TLS with this certificate, which must be valid for localhost as the gateway calls back through the port (empty serves plaintext h2c and HTTP/1.1)")
+	tlsKey  = flag.String("tls-key", "", "private key of -tls-cert")
+
+	gatewayConfigPath = flag.String("gateway-config", "gateway.yaml", "headers forwarded by the gateway and CORS policy, in YAML (empty uses the defaults)")
+	requireAuth       = flag.Bool("require-auth", false, "require basic admin:admin or bearer some-secret-token credentials on the ecommerce services")
+)
+
 // server is used to implement ecommerce/product_info.
 type server struct {
 	productMap map[string]*pb.Product
@@ -32,6 +50,16 @@ type server struct {
 
 // AddProduct implements ecommerce.AddProduct
 func (s *server) AddProduct(ctx context.Context, in *pb.Product) (*wrapper.StringValue, error) {
+	var violations fieldViolations
+	if in.Name == "" {
+		violations.add("name", "must not be empty")
+	}
+	if in.Price < 0 {
+		violations.add("price", "must not be negative")
+	}
+	if err := violations.err("invalid product"); err != nil {
+		return nil, err
+	}
 	out, err := uuid.NewUUID()
 	if err != nil {
 		log.Fatal(err)
@@ -41,6 +69,7 @@ func (s *server) AddProduct(ctx context.Context, in *pb.Product) (*wrapper.Strin
 		s.productMap = make(map[string]*pb.Product)
 	}
 	s.productMap[in.Id] = in
+	grpc.SetHeader(ctx, metadata.Pairs("location", "/v1/product/"+in.Id))
 	return &wrapper.StringValue{Value: in.Id}, nil
 }
 
@@ -50,19 +79,61 @@ func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.P
 	if exists {
 		return value, nil
 	}
-	return nil, errors.New("Product does not exist for the ID" + in.Value)
+	return nil, status.Errorf(codes.NotFound, "Product does not exist for the ID %s", in.Value)
 }
 
 func main() {
+	flag.Parse()
+	cfg, err := loadGatewayConfig(*gatewayConfigPath)
+	if err != nil {
+		log.Fatalf("failed to load gateway configuration: %v", err)
+	}
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	unary := []grpc.UnaryServerInterceptor{requestid.UnaryServerInterceptor()}
+	stream := []grpc.StreamServerInterceptor{requestid.StreamServerInterceptor()}
+	if *requireAuth {
+		unary = append(unary, authUnaryInterceptor)
+		stream = append(stream, authStreamInterceptor)
+	}
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
 	pb.RegisterProductInfoServer(s, &server{})
+	pb.RegisterOrderManagementServer(s, newOrderServer())
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+
+	// The gateway calls the services through the shared port, so REST
+	// requests go through the same interceptors as gRPC calls.
+	var creds credentials.TransportCredentials
+	if *tlsCert != "" {
+		if creds, err = credentials.NewClientTLSFromFile(*tlsCert, "localhost"); err != nil {
+			log.Fatalf("failed to load certificate: %v", err)
+		}
+	}
+	conn, err := dialGateway("localhost"+port, creds)
+	if err != nil {
+		log.Fatalf("failed to create gateway connection: %v", err)
+	}
+	runner.OnShutdown("gateway connection", func(context.Context) error { return conn.Close() })
+	gateway, err := newGateway(context.Background(), conn, cfg)
+	if err != nil {
+		log.Fatalf("failed to register gateway: %v", err)
+	}
+
+	srv := portmux.NewServer(s, gateway, cfg.CORS.handler)
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("failed to load key pair: %v", err)
+		}
+		lis = portmux.TLSListener(srv, lis, cert)
+	}
+
+	log.Println("gRPC, gRPC-Web and REST gateway are running on port " + port)
+	if err := runner.ServeHTTP(srv, lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,75 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+// swaggerJSON is generated from the annotated protos by protoc-gen-swagger,
+// see buf.gen.yaml.
+//
+//go:embed openapi/ecommerce.swagger.json
+var swaggerJSON []byte
+
+//go:embed openapi/docs.html
+var docsHTML []byte
+
+// processOrdersPath is served over a WebSocket rather than by the gateway.
+const processOrdersPath = "/v1/orders/process"
+
+// openAPISpec returns the OpenAPI v2 document of the gateway: the generated
+// one with its info filled in and the WebSocket route added, as neither can
+// be expressed by the HTTP annotations.
+func openAPISpec() ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(swaggerJSON, &doc); err != nil {
+		return nil, err
+	}
+	doc["info"] = map[string]interface{}{
+		"title":       "ecommerce",
+		"description": "REST gateway of the ProductInfo and OrderManagement gRPC services.",
+		"version":     "1.0",
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	if paths == nil {
+		paths = make(map[string]interface{})
+		doc["paths"] = paths
+	}
+	paths[processOrdersPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "processOrders over a WebSocket.",
+			"description": "Upgrade to a WebSocket, then send every order ID as a text message, bare or as a JSON string, " +
+				"and an empty message to end the stream. Every combined shipment is sent back as a JSON text message; " +
+				"a failed call ends with a {\"code\", \"message\"} status message.",
+			"operationId": "OrderManagement_processOrders",
+			"responses": map[string]interface{}{
+				"101": map[string]interface{}{
+					"description": "Switching to the WebSocket protocol.",
+					"schema":      map[string]interface{}{"$ref": "#/definitions/ecommerceCombinedShipment"},
+				},
+			},
+			"tags": []string{"OrderManagement"},
+		},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// docsHandler serves the OpenAPI document at /openapi.json and a Swagger UI
+// page rendering it at /docs.
+func docsHandler() (http.Handler, error) {
+	spec, err := openAPISpec()
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsHTML)
+	})
+	return mux, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/cuongpiger/golang/proto"
+)
+
+// annotatedRoutes returns the "VERB /path" routes of the HTTP annotations of
+// the services the gateway registers, plus the WebSocket route.
+func annotatedRoutes() []string {
+	routes := []string{"GET " + processOrdersPath}
+	for _, fd := range []protoreflect.FileDescriptor{pb.File_proto_product_info_proto, pb.File_proto_order_management_proto} {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				rule, _ := proto.GetExtension(methods.Get(j).Options(), annotations.E_Http).(*annotations.HttpRule)
+				switch {
+				case rule == nil:
+				case rule.GetGet() != "":
+					routes = append(routes, "GET "+rule.GetGet())
+				case rule.GetPost() != "":
+					routes = append(routes, "POST "+rule.GetPost())
+				case rule.GetPut() != "":
+					routes = append(routes, "PUT "+rule.GetPut())
+				case rule.GetPatch() != "":
+					routes = append(routes, "PATCH "+rule.GetPatch())
+				case rule.GetDelete() != "":
+					routes = append(routes, "DELETE "+rule.GetDelete())
+				}
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func fetchSpec(t *testing.T, addr string) map[string]map[string]json.RawMessage {
+	t.Helper()
+	res, err := http.Get("http://" + addr + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var doc struct {
+		Swagger string                                `json:"swagger"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatalf("decoding /openapi.json: %v", err)
+	}
+	if doc.Swagger != "2.0" {
+		t.Fatalf("swagger = %q, want 2.0", doc.Swagger)
+	}
+	return doc.Paths
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	addr := startServer(t)
+	var documented []string
+	for path, ops := range fetchSpec(t, addr) {
+		for verb := range ops {
+			documented = append(documented, strings.ToUpper(verb)+" "+path)
+		}
+	}
+	sort.Strings(documented)
+	if want := annotatedRoutes(); !reflect.DeepEqual(documented, want) {
+		t.Fatalf("documented routes = %q, want the annotated ones %q; regenerate with make protoc", documented, want)
+	}
+
+	// Every documented route is served: the gateway answers unknown routes
+	// with a "no route" problem, the services with their own responses.
+	for _, route := range documented {
+		verb, path, _ := strings.Cut(route, " ")
+		if path == processOrdersPath {
+			continue // covered by TestProcessOrdersWebSocket
+		}
+		var body io.Reader
+		if verb != http.MethodGet {
+			body = strings.NewReader("{}")
+		}
+		req, _ := http.NewRequest(verb, "http://"+addr+strings.ReplaceAll(path, "{value}", "102"), body)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", route, err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if strings.Contains(string(b), "no route for") {
+			t.Errorf("%s = %d %s, want a service response", route, res.StatusCode, b)
+		}
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	addr := startServer(t)
+	res, err := http.Get("http://" + addr + "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(b), `url: "/openapi.json"`) {
+		t.Errorf("GET /docs = %d %s", res.StatusCode, b)
+	}
+}
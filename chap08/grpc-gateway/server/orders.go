@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	wrapper "github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/cuongpiger/golang/proto"
+)
+
+const orderBatchSize = 3
+
+// orderServer is used to implement ecommerce/order_management.
+type orderServer struct {
+	mu       sync.Mutex
+	orderMap map[string]*pb.Order
+
+	pb.UnimplementedOrderManagementServer
+}
+
+func newOrderServer() *orderServer {
+	s := &orderServer{orderMap: make(map[string]*pb.Order)}
+	for _, o := range []*pb.Order{
+		{Id: "102", Items: []string{"Google Pixel 3A", "Mac Book Pro"}, Destination: "Mountain View, CA", Price: 1800.00},
+		{Id: "103", Items: []string{"Apple Watch S4"}, Destination: "San Jose, CA", Price: 400.00},
+		{Id: "104", Items: []string{"Google Home Mini", "Google Nest Hub"}, Destination: "Mountain View, CA", Price: 400.00},
+		{Id: "105", Items: []string{"Amazon Echo"}, Destination: "San Jose, CA", Price: 30.00},
+		{Id: "106", Items: []string{"Amazon Echo", "Apple iPhone XS"}, Destination: "Mountain View, CA", Price: 300.00},
+	} {
+		s.orderMap[o.Id] = o
+	}
+	return s
+}
+
+// order returns a copy of the order with the given ID.
+func (s *orderServer) order(id string) (*pb.Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orderMap[id]
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(o).(*pb.Order), true
+}
+
+func (s *orderServer) put(o *pb.Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orderMap[o.Id] = proto.Clone(o).(*pb.Order)
+}
+
+func validateOrder(o *pb.Order) error {
+	var violations fieldViolations
+	if o.Id == "" {
+		violations.add("id", "must not be empty")
+	}
+	if o.Price < 0 {
+		violations.add("price", "must not be negative")
+	}
+	return violations.err("invalid order " + o.Id)
+}
+
+// AddOrder implements ecommerce.AddOrder
+func (s *orderServer) AddOrder(ctx context.Context, orderReq *pb.Order) (*wrapper.StringValue, error) {
+	if err := validateOrder(orderReq); err != nil {
+		return nil, err
+	}
+	s.put(orderReq)
+	grpc.SetHeader(ctx, metadata.Pairs("location", "/v1/orders/"+orderReq.Id))
+	log.Printf("Order Added. ID : %v", orderReq.Id)
+	return &wrapper.StringValue{Value: "Order Added: " + orderReq.Id}, nil
+}
+
+// GetOrder implements ecommerce.GetOrder
+func (s *orderServer) GetOrder(ctx context.Context, orderId *wrapper.StringValue) (*pb.Order, error) {
+	if o, ok := s.order(orderId.Value); ok {
+		return o, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "Order does not exist. : %s", orderId.Value)
+}
+
+// SearchOrders implements ecommerce.SearchOrders, streaming the orders with
+// an item containing the query.
+func (s *orderServer) SearchOrders(searchQuery *wrapper.StringValue, stream pb.OrderManagement_SearchOrdersServer) error {
+	s.mu.Lock()
+	var matches []*pb.Order
+	for _, order := range s.orderMap {
+		for _, itemStr := range order.Items {
+			if strings.Contains(itemStr, searchQuery.Value) {
+				matches = append(matches, proto.Clone(order).(*pb.Order))
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, order := range matches {
+		if err := stream.Send(order); err != nil {
+			return err
+		}
+		log.Print("Matching Order Found : " + order.Id)
+	}
+	return nil
+}
+
+// UpdateOrders implements ecommerce.UpdateOrders
+func (s *orderServer) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) error {
+	ordersStr := "Updated Order IDs : "
+	for {
+		order, err := stream.Recv()
+		if err == io.EOF {
+			// Finished reading the order stream.
+			return stream.SendAndClose(&wrapper.StringValue{Value: "Orders processed " + ordersStr})
+		}
+		if err != nil {
+			return err
+		}
+		if err := validateOrder(order); err != nil {
+			return err
+		}
+		s.put(order)
+		log.Printf("Order ID : %s - %s", order.Id, "Updated")
+		ordersStr += order.Id + ", "
+	}
+}
+
+// ProcessOrders implements ecommerce.ProcessOrders, combining the orders
+// into one shipment per destination and sending the shipments every
+// orderBatchSize orders and once the client is done.
+func (s *orderServer) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) error {
+	batchMarker := 1
+	combinedShipmentMap := make(map[string]*pb.CombinedShipment)
+	for {
+		orderId, err := stream.Recv()
+		if err == io.EOF {
+			// Client has sent all the messages, send the remaining shipments.
+			for _, shipment := range combinedShipmentMap {
+				if err := stream.Send(shipment); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ord, ok := s.order(orderId.GetValue())
+		if !ok {
+			return status.Errorf(codes.NotFound, "Order does not exist. : %s", orderId.GetValue())
+		}
+		shipment, found := combinedShipmentMap[ord.Destination]
+		if !found {
+			shipment = &pb.CombinedShipment{Id: "cmb - " + ord.Destination, Status: "Processed!"}
+			combinedShipmentMap[ord.Destination] = shipment
+		}
+		shipment.OrdersList = append(shipment.OrdersList, ord)
+
+		if batchMarker == orderBatchSize {
+			for _, comb := range combinedShipmentMap {
+				log.Printf("Shipping : %v -> %v", comb.Id, len(comb.OrdersList))
+				if err := stream.Send(comb); err != nil {
+					return err
+				}
+			}
+			batchMarker = 0
+			combinedShipmentMap = make(map[string]*pb.CombinedShipment)
+		} else {
+			batchMarker++
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/order_management.proto
+
+package __
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	wrapperspb "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	OrderManagement_AddOrder_FullMethodName      = "/ecommerce.OrderManagement/addOrder"
+	OrderManagement_GetOrder_FullMethodName      = "/ecommerce.OrderManagement/getOrder"
+	OrderManagement_SearchOrders_FullMethodName  = "/ecommerce.OrderManagement/searchOrders"
+	OrderManagement_UpdateOrders_FullMethodName  = "/ecommerce.OrderManagement/updateOrders"
+	OrderManagement_ProcessOrders_FullMethodName = "/ecommerce.OrderManagement/processOrders"
+)
+
+// OrderManagementClient is the client API for OrderManagement service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OrderManagementClient interface {
+	AddOrder(ctx context.Context, in *Order, opts ...grpc.CallOption) (*wrapperspb.StringValue, error)
+	GetOrder(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*Order, error)
+	// Streamed as newline-delimited JSON, one {"result": Order} per line.
+	SearchOrders(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Order], error)
+	// Bulk update: the request body is a sequence of Order JSON objects.
+	UpdateOrders(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Order, wrapperspb.StringValue], error)
+	// Served over a WebSocket at /v1/orders/process rather than by the
+	// gateway, as HTTP/1.1 cannot interleave a request and response stream.
+	ProcessOrders(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[wrapperspb.StringValue, CombinedShipment], error)
+}
+
+type orderManagementClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrderManagementClient(cc grpc.ClientConnInterface) OrderManagementClient {
+	return &orderManagementClient{cc}
+}
+
+func (c *orderManagementClient) AddOrder(ctx context.Context, in *Order, opts ...grpc.CallOption) (*wrapperspb.StringValue, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(wrapperspb.StringValue)
+	err := c.cc.Invoke(ctx, OrderManagement_AddOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderManagementClient) GetOrder(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (*Order, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Order)
+	err := c.cc.Invoke(ctx, OrderManagement_GetOrder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orderManagementClient) SearchOrders(ctx context.Context, in *wrapperspb.StringValue, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Order], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrderManagement_ServiceDesc.Streams[0], OrderManagement_SearchOrders_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[wrapperspb.StringValue, Order]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderManagement_SearchOrdersClient = grpc.ServerStreamingClient[Order]
+
+func (c *orderManagementClient) UpdateOrders(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Order, wrapperspb.StringValue], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrderManagement_ServiceDesc.Streams[1], OrderManagement_UpdateOrders_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Order, wrapperspb.StringValue]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderManagement_UpdateOrdersClient = grpc.ClientStreamingClient[Order, wrapperspb.StringValue]
+
+func (c *orderManagementClient) ProcessOrders(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[wrapperspb.StringValue, CombinedShipment], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrderManagement_ServiceDesc.Streams[2], OrderManagement_ProcessOrders_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[wrapperspb.StringValue, CombinedShipment]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderManagement_ProcessOrdersClient = grpc.BidiStreamingClient[wrapperspb.StringValue, CombinedShipment]
+
+// OrderManagementServer is the server API for OrderManagement service.
+// All implementations must embed UnimplementedOrderManagementServer
+// for forward compatibility.
+type OrderManagementServer interface {
+	AddOrder(context.Context, *Order) (*wrapperspb.StringValue, error)
+	GetOrder(context.Context, *wrapperspb.StringValue) (*Order, error)
+	// Streamed as newline-delimited JSON, one {"result": Order} per line.
+	SearchOrders(*wrapperspb.StringValue, grpc.ServerStreamingServer[Order]) error
+	// Bulk update: the request body is a sequence of Order JSON objects.
+	UpdateOrders(grpc.ClientStreamingServer[Order, wrapperspb.StringValue]) error
+	// Served over a WebSocket at /v1/orders/process rather than by the
+	// gateway, as HTTP/1.1 cannot interleave a request and response stream.
+	ProcessOrders(grpc.BidiStreamingServer[wrapperspb.StringValue, CombinedShipment]) error
+	mustEmbedUnimplementedOrderManagementServer()
+}
+
+// UnimplementedOrderManagementServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOrderManagementServer struct{}
+
+func (UnimplementedOrderManagementServer) AddOrder(context.Context, *Order) (*wrapperspb.StringValue, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddOrder not implemented")
+}
+func (UnimplementedOrderManagementServer) GetOrder(context.Context, *wrapperspb.StringValue) (*Order, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrder not implemented")
+}
+func (UnimplementedOrderManagementServer) SearchOrders(*wrapperspb.StringValue, grpc.ServerStreamingServer[Order]) error {
+	return status.Errorf(codes.Unimplemented, "method SearchOrders not implemented")
+}
+func (UnimplementedOrderManagementServer) UpdateOrders(grpc.ClientStreamingServer[Order, wrapperspb.StringValue]) error {
+	return status.Errorf(codes.Unimplemented, "method UpdateOrders not implemented")
+}
+func (UnimplementedOrderManagementServer) ProcessOrders(grpc.BidiStreamingServer[wrapperspb.StringValue, CombinedShipment]) error {
+	return status.Errorf(codes.Unimplemented, "method ProcessOrders not implemented")
+}
+func (UnimplementedOrderManagementServer) mustEmbedUnimplementedOrderManagementServer() {}
+func (UnimplementedOrderManagementServer) testEmbeddedByValue()                         {}
+
+// UnsafeOrderManagementServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OrderManagementServer will
+// result in compilation errors.
+type UnsafeOrderManagementServer interface {
+	mustEmbedUnimplementedOrderManagementServer()
+}
+
+func RegisterOrderManagementServer(s grpc.ServiceRegistrar, srv OrderManagementServer) {
+	// If the following call pancis, it indicates UnimplementedOrderManagementServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&OrderManagement_ServiceDesc, srv)
+}
+
+func _OrderManagement_AddOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Order)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderManagementServer).AddOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderManagement_AddOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderManagementServer).AddOrder(ctx, req.(*Order))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderManagement_GetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrderManagementServer).GetOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrderManagement_GetOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrderManagementServer).GetOrder(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrderManagement_SearchOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(wrapperspb.StringValue)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OrderManagementServer).SearchOrders(m, &grpc.GenericServerStream[wrapperspb.StringValue, Order]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderManagement_SearchOrdersServer = grpc.ServerStreamingServer[Order]
+
+func _OrderManagement_UpdateOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OrderManagementServer).UpdateOrders(&grpc.GenericServerStream[Order, wrapperspb.StringValue]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderManagement_UpdateOrdersServer = grpc.ClientStreamingServer[Order, wrapperspb.StringValue]
+
+func _OrderManagement_ProcessOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OrderManagementServer).ProcessOrders(&grpc.GenericServerStream[wrapperspb.StringValue, CombinedShipment]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderManagement_ProcessOrdersServer = grpc.BidiStreamingServer[wrapperspb.StringValue, CombinedShipment]
+
+// OrderManagement_ServiceDesc is the grpc.ServiceDesc for OrderManagement service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OrderManagement_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ecommerce.OrderManagement",
+	HandlerType: (*OrderManagementServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "addOrder",
+			Handler:    _OrderManagement_AddOrder_Handler,
+		},
+		{
+			MethodName: "getOrder",
+			Handler:    _OrderManagement_GetOrder_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "searchOrders",
+			Handler:       _OrderManagement_SearchOrders_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "updateOrders",
+			Handler:       _OrderManagement_UpdateOrders_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "processOrders",
+			Handler:       _OrderManagement_ProcessOrders_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/order_management.proto",
+}
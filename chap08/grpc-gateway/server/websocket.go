@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	wrapper "github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/problem"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+
+	pb "github.com/cuongpiger/golang/proto"
+)
+
+// processOrdersHandler serves ecommerce.ProcessOrders over a WebSocket, as
+// the gateway cannot map a bidirectional stream to a single HTTP/1.1
+// request. Every text message from the client is an order ID, bare or as a
+// JSON string, and an empty message ends the client stream. Every combined
+// shipment is sent back as one JSON text message. The socket is closed once
+// the call ends, after an {"error": <problem details>} message if it failed.
+// The headers of the upgrade request selected by cfg are forwarded, e.g. the
+// cookies of a browser, so the upgrade is refused to pages whose origin is
+// neither the gateway's own nor allowed by the CORS policy: browsers send
+// cookies with WebSocket requests from any site.
+func processOrdersHandler(client pb.OrderManagementClient, cfg gatewayConfig) http.Handler {
+	return websocket.Server{Handshake: cfg.CORS.checkWebSocketOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		ctx := metadata.NewOutgoingContext(ws.Request().Context(), cfg.outgoingMetadata(ws.Request()))
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := client.ProcessOrders(ctx)
+		if err != nil {
+			sendStatus(ws, err)
+			return
+		}
+
+		// The reader reports invalid messages here before cancelling the call.
+		invalid := make(chan error, 1)
+		go func() {
+			for {
+				var msg string
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					// The client went away before ending its stream.
+					cancel()
+					return
+				}
+				id := strings.TrimSpace(msg)
+				if id == "" {
+					stream.CloseSend()
+					return
+				}
+				if strings.HasPrefix(id, `"`) {
+					if err := json.Unmarshal([]byte(id), &id); err != nil {
+						invalid <- status.Errorf(codes.InvalidArgument, "invalid order ID %s: %v", msg, err)
+						cancel()
+						return
+					}
+				}
+				if err := stream.Send(&wrapper.StringValue{Value: id}); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			shipment, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				select {
+				case err = <-invalid:
+				default:
+				}
+				sendStatus(ws, err)
+				return
+			}
+			b, err := jsonMarshaler.Marshal(shipment)
+			if err != nil {
+				sendStatus(ws, err)
+				return
+			}
+			if err := websocket.Message.Send(ws, string(b)); err != nil {
+				log.Printf("processOrders: failed to send shipment: %v", err)
+				return
+			}
+		}
+	}}
+}
+
+// checkWebSocketOrigin accepts upgrade requests without an Origin, which
+// browsers always send, from the gateway's own origin and from the allowed
+// origins, listed by name: "*" does not open the socket, whose upgrade
+// carries cookies, to every site. An error makes the server answer 403
+// Forbidden.
+func (p corsPolicy) checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q: %w", origin, err)
+	}
+	config.Origin = u
+	if u.Host == r.Host {
+		return nil
+	}
+	for _, o := range p.AllowedOrigins {
+		if o == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// sendStatus sends the final {"error": <problem details>} message of a
+// failed call, the chunk ending the other failed streams.
+func sendStatus(ws *websocket.Conn, err error) {
+	r := ws.Request()
+	p := problem.FromStatus(status.Convert(err))
+	p.Instance = r.URL.Path
+	if id, ok := requestid.FromContext(r.Context()); ok {
+		p.RequestID = id
+	}
+	b, _ := json.Marshal(map[string]*problem.Problem{"error": p})
+	websocket.Message.Send(ws, string(b))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	grpcstt "google.golang.org/grpc/status"
+
+	pb "github.com/cuongpiger/golang/healthcheck"
+)
+
+// HealthServer implements the grpc.health.v1.Health service. Statuses are set
+// with SetStatus, normally by a Prober evaluating the dependencies of each
+// service.
+//
+// Following the health checking protocol, Check fails with NotFound for a
+// service that was never registered, while Watch reports SERVICE_UNKNOWN and
+// keeps the stream open so the caller learns when the service appears.
+//
+// Each watcher owns a channel with a buffer of one that always holds the
+// latest status not yet sent: an update replaces a pending one instead of
+// being dropped, so a slow watcher skips intermediate statuses but never
+// misses the current one. Channels are only written under mu and are never
+// closed, so unregistering a watcher cannot race with an update.
+type HealthServer struct {
+	mu       sync.RWMutex
+	shutdown bool
+	services map[string]pb.HealthCheckResponse_ServingStatus
+	watchers map[string]map[chan pb.HealthCheckResponse_ServingStatus]struct{}
+	pb.UnimplementedHealthServer
+}
+
+// NewHealthServer creates a new health server instance
+func NewHealthServer() *HealthServer {
+	return &HealthServer{
+		services: make(map[string]pb.HealthCheckResponse_ServingStatus),
+		watchers: make(map[string]map[chan pb.HealthCheckResponse_ServingStatus]struct{}),
+	}
+}
+
+// Check implements the Check method of the Health service
+func (h *HealthServer) Check(ctx context.Context, req *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	status, exists := h.services[req.Service]
+	if !exists {
+		return nil, grpcstt.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
+	return &pb.HealthCheckResponse{Status: status}, nil
+}
+
+// Watch implements the Watch method of the Health service
+func (h *HealthServer) Watch(req *pb.HealthCheckRequest, stream pb.Health_WatchServer) error {
+	service := req.Service
+	ch := make(chan pb.HealthCheckResponse_ServingStatus, 1)
+
+	h.mu.Lock()
+	// The initial status is queued like any update, so one set before the
+	// watcher starts reading replaces it.
+	currentStatus, exists := h.services[service]
+	if !exists {
+		currentStatus = pb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	ch <- currentStatus
+	if h.watchers[service] == nil {
+		h.watchers[service] = make(map[chan pb.HealthCheckResponse_ServingStatus]struct{})
+	}
+	h.watchers[service][ch] = struct{}{}
+	h.mu.Unlock()
+	defer h.removeWatcher(service, ch)
+
+	var lastSent pb.HealthCheckResponse_ServingStatus = -1
+	for {
+		select {
+		case status := <-ch:
+			if status == lastSent {
+				continue
+			}
+			if err := stream.Send(&pb.HealthCheckResponse{Status: status}); err != nil {
+				return err
+			}
+			lastSent = status
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// SetStatus sets the serving status for a service, registering it if needed.
+// It has no effect after Shutdown.
+func (h *HealthServer) SetStatus(service string, status pb.HealthCheckResponse_ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.shutdown {
+		return
+	}
+	h.setStatusLocked(service, status)
+}
+
+// Shutdown sets every service NOT_SERVING and ignores later status updates,
+// so clients stop sending new calls while the server drains.
+func (h *HealthServer) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.shutdown = true
+	for service := range h.services {
+		h.setStatusLocked(service, pb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (h *HealthServer) setStatusLocked(service string, status pb.HealthCheckResponse_ServingStatus) {
+	if old, exists := h.services[service]; exists && old == status {
+		return
+	}
+	log.Printf("Setting status for service %q to %v", service, status)
+	h.services[service] = status
+
+	// Replace the pending status of every watcher. Senders hold mu, so the
+	// buffer is free once drained and the send cannot block.
+	for ch := range h.watchers[service] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- status
+	}
+}
+
+// removeWatcher unregisters a watcher channel. The channel is left open for
+// the garbage collector; nothing sends on it once it is unregistered.
+func (h *HealthServer) removeWatcher(service string, ch chan pb.HealthCheckResponse_ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.watchers[service], ch)
+	if len(h.watchers[service]) == 0 {
+		delete(h.watchers, service)
+	}
+}
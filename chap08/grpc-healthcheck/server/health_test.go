@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcstt "google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/cuongpiger/golang/healthcheck"
+)
+
+func newTestClient(t *testing.T, healthServer *HealthServer) pb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	pb.RegisterHealthServer(s, healthServer)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough://bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewHealthClient(conn)
+}
+
+func checkStatus(t *testing.T, client pb.HealthClient, service string, want pb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+	resp, err := client.Check(context.Background(), &pb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Check(%q): %v", service, err)
+	}
+	if resp.GetStatus() != want {
+		t.Fatalf("Check(%q) = %v, want %v", service, resp.GetStatus(), want)
+	}
+}
+
+func TestStatusFollowsProbes(t *testing.T) {
+	healthServer := NewHealthServer()
+	client := newTestClient(t, healthServer)
+
+	var storeDown atomic.Bool
+	store := Probe{Name: "store", Check: func(context.Context) error {
+		if storeDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+	prober := NewProber(healthServer, time.Hour, time.Second)
+	prober.Register("productinfo.ProductInfo", store)
+	prober.Register("ecommerce.OrderManagement", store, Probe{Name: "inventory", Check: func(context.Context) error { return nil }})
+
+	checkStatus(t, client, "productinfo.ProductInfo", pb.HealthCheckResponse_UNKNOWN)
+
+	prober.Evaluate(context.Background())
+	checkStatus(t, client, "", pb.HealthCheckResponse_SERVING)
+	checkStatus(t, client, "productinfo.ProductInfo", pb.HealthCheckResponse_SERVING)
+	checkStatus(t, client, "ecommerce.OrderManagement", pb.HealthCheckResponse_SERVING)
+
+	storeDown.Store(true)
+	prober.Evaluate(context.Background())
+	checkStatus(t, client, "", pb.HealthCheckResponse_NOT_SERVING)
+	checkStatus(t, client, "productinfo.ProductInfo", pb.HealthCheckResponse_NOT_SERVING)
+	checkStatus(t, client, "ecommerce.OrderManagement", pb.HealthCheckResponse_NOT_SERVING)
+
+	healthServer.Shutdown()
+	storeDown.Store(false)
+	prober.Evaluate(context.Background())
+	checkStatus(t, client, "productinfo.ProductInfo", pb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestProbeTimeout(t *testing.T) {
+	healthServer := NewHealthServer()
+	client := newTestClient(t, healthServer)
+
+	prober := NewProber(healthServer, time.Hour, 10*time.Millisecond)
+	prober.Register("slow", Probe{Name: "hang", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	prober.Evaluate(context.Background())
+	checkStatus(t, client, "slow", pb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestUnknownService(t *testing.T) {
+	healthServer := NewHealthServer()
+	client := newTestClient(t, healthServer)
+
+	_, err := client.Check(context.Background(), &pb.HealthCheckRequest{Service: "missing"})
+	if grpcstt.Code(err) != codes.NotFound {
+		t.Fatalf("Check(missing) = %v, want NotFound", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Watch(ctx, &pb.HealthCheckRequest{Service: "missing"})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if resp.GetStatus() != pb.HealthCheckResponse_SERVICE_UNKNOWN {
+		t.Fatalf("first Watch status = %v, want SERVICE_UNKNOWN", resp.GetStatus())
+	}
+
+	// The stream stays open and reports the service once it is registered.
+	healthServer.SetStatus("missing", pb.HealthCheckResponse_SERVING)
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if resp.GetStatus() != pb.HealthCheckResponse_SERVING {
+		t.Fatalf("Watch status = %v, want SERVING", resp.GetStatus())
+	}
+}
+
+func TestWatchersObserveLatestStatus(t *testing.T) {
+	const (
+		watchers = 2000
+		flips    = 200
+	)
+	healthServer := NewHealthServer()
+	client := newTestClient(t, healthServer)
+	healthServer.SetStatus("svc", pb.HealthCheckResponse_SERVING)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The status flips between SERVING and UNKNOWN and ends NOT_SERVING; every
+	// watcher must eventually receive that final status.
+	final := pb.HealthCheckResponse_NOT_SERVING
+	done := make(chan error, watchers)
+	started := make(chan struct{}, watchers)
+	for i := 0; i < watchers; i++ {
+		go func() {
+			stream, err := client.Watch(ctx, &pb.HealthCheckRequest{Service: "svc"})
+			if err != nil {
+				done <- err
+				return
+			}
+			first := true
+			for {
+				resp, err := stream.Recv()
+				if err != nil {
+					done <- err
+					return
+				}
+				if first {
+					started <- struct{}{}
+					first = false
+				}
+				if resp.GetStatus() == final {
+					done <- nil
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < watchers; i++ {
+		select {
+		case <-started:
+		case err := <-done:
+			t.Fatalf("watcher failed before its first status: %v", err)
+		}
+	}
+
+	// Short-lived watchers come and go while the status flips, exercising
+	// unregistering concurrently with updates.
+	churnCtx, stopChurn := context.WithCancel(ctx)
+	defer stopChurn()
+	for i := 0; i < 50; i++ {
+		go func() {
+			for churnCtx.Err() == nil {
+				wctx, wcancel := context.WithCancel(churnCtx)
+				if stream, err := client.Watch(wctx, &pb.HealthCheckRequest{Service: "svc"}); err == nil {
+					stream.Recv()
+				}
+				wcancel()
+			}
+		}()
+	}
+
+	for i := 0; i < flips; i++ {
+		status := pb.HealthCheckResponse_SERVING
+		if i%2 == 0 {
+			status = pb.HealthCheckResponse_UNKNOWN
+		}
+		healthServer.SetStatus("svc", status)
+	}
+	healthServer.SetStatus("svc", final)
+
+	for i := 0; i < watchers; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("watcher did not observe the final status: %v", err)
+		}
+	}
+	stopChurn()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/cuongpiger/golang/healthcheck"
+)
+
+// Probe checks one dependency of a service, such as its store or a
+// downstream service. Check returns nil while the dependency is usable.
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// DialProbe reports whether a TCP connection to addr can be opened, e.g. to
+// check that a database is reachable.
+func DialProbe(name, addr string) Probe {
+	return Probe{Name: name, Check: func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}}
+}
+
+// HealthProbe reports whether service is SERVING on a downstream server
+// implementing the health checking protocol.
+func HealthProbe(name string, client pb.HealthClient, service string) Probe {
+	return Probe{Name: name, Check: func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &pb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != pb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("%q is %v", service, resp.GetStatus())
+		}
+		return nil
+	}}
+}
+
+// Prober evaluates the probes of every registered service on an interval and
+// publishes the results to a HealthServer. A service is SERVING when all of
+// its probes pass and NOT_SERVING otherwise; the overall server status
+// (service "") is SERVING only while every registered service is.
+type Prober struct {
+	health   *HealthServer
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	services map[string][]Probe
+}
+
+// NewProber returns a Prober running every probe each interval, giving each
+// one at most timeout to answer.
+func NewProber(health *HealthServer, interval, timeout time.Duration) *Prober {
+	return &Prober{
+		health:   health,
+		interval: interval,
+		timeout:  timeout,
+		services: make(map[string][]Probe),
+	}
+}
+
+// Register adds service with its dependency probes. Its status is UNKNOWN
+// until the next evaluation.
+func (p *Prober) Register(service string, probes ...Probe) {
+	p.mu.Lock()
+	p.services[service] = probes
+	p.mu.Unlock()
+	p.health.SetStatus(service, pb.HealthCheckResponse_UNKNOWN)
+}
+
+// Run evaluates the probes immediately and then on every interval until ctx
+// is done.
+func (p *Prober) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.Evaluate(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate runs all probes once, concurrently, and updates the statuses.
+func (p *Prober) Evaluate(ctx context.Context) {
+	p.mu.Lock()
+	services := make(map[string][]Probe, len(p.services))
+	for name, probes := range p.services {
+		services[name] = probes
+	}
+	p.mu.Unlock()
+
+	results := make(map[string]pb.HealthCheckResponse_ServingStatus, len(services))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, probes := range services {
+		wg.Add(1)
+		go func(name string, probes []Probe) {
+			defer wg.Done()
+			status := p.evaluateService(ctx, name, probes)
+			mu.Lock()
+			results[name] = status
+			mu.Unlock()
+		}(name, probes)
+	}
+	wg.Wait()
+
+	overall := pb.HealthCheckResponse_SERVING
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.health.SetStatus(name, results[name])
+		if results[name] != pb.HealthCheckResponse_SERVING {
+			overall = pb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	p.health.SetStatus("", overall)
+}
+
+func (p *Prober) evaluateService(ctx context.Context, service string, probes []Probe) pb.HealthCheckResponse_ServingStatus {
+	failed := make([]error, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe Probe) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+			failed[i] = probe.Check(ctx)
+		}(i, probe)
+	}
+	wg.Wait()
+
+	status := pb.HealthCheckResponse_SERVING
+	for i, err := range failed {
+		if err != nil {
+			log.Printf("Probe %s of service %q failed: %v", probes[i].Name, service, err)
+			status = pb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return status
+}
@@ -13,6 +13,11 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/logging"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
 
@@ -52,7 +57,6 @@ func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.P
 
 func main() {
 	logger, _ := zap.NewProduction()
-	defer logger.Sync()
 
 	// Add zap interceptor middleware
 	grpczap.ReplaceGrpcLoggerV2(logger) // optional but helpful
@@ -62,17 +66,35 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	// Structured request logging with payloads rendered as JSON. The product
+	// price and any credentials sent as metadata are masked in the output.
+	requestLogger := logging.New(logger, logging.Config{
+		LogPayloads:    true,
+		LogMetadata:    true,
+		RedactFields:   []string{"Product.price"},
+		RedactMetadata: []string{"authorization", "cookie"},
+	})
+
 	s := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
-			grpczap.UnaryServerInterceptor(logger),
+			requestid.UnaryServerInterceptor(),
+			requestLogger.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			requestid.StreamServerInterceptor(),
+			requestLogger.StreamServerInterceptor(),
 		),
 	)
 	pb.RegisterProductInfoServer(s, &server{})
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
 
+	// Buffered log records are flushed once the last calls have finished.
+	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+	runner.OnShutdown("logger", func(context.Context) error { return logger.Sync() })
+
 	log.Printf("gRPC server is running on port %s", port)
-	if err := s.Serve(lis); err != nil {
+	if err := runner.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
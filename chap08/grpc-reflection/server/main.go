@@ -3,13 +3,18 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"log"
 	"net"
+	"strings"
 
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/reflection"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/reflectsvc"
 
 	pb "github.com/cuongpiger/golang/ecommerce"
 )
@@ -49,6 +54,11 @@ func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.P
 }
 
 func main() {
+	descriptorSets := flag.String("descriptor-sets", "", "comma-separated FileDescriptorSet files to describe in addition to the linked-in services")
+	hideInternal := flag.Bool("hide-internal", false, "leave health and other internal services out of the service listing")
+	v1Only := flag.Bool("v1-only", false, "serve only the v1 reflection API, not v1alpha")
+	flag.Parse()
+
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
@@ -56,8 +66,17 @@ func main() {
 	s := grpc.NewServer()
 	pb.RegisterProductInfoServer(s, &server{})
 	// Register reflection service on gRPC server.
-	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+	opts := reflectsvc.Options{V1Only: *v1Only}
+	if *descriptorSets != "" {
+		opts.DescriptorSets = strings.Split(*descriptorSets, ",")
+	}
+	if *hideInternal {
+		opts.Hidden = reflectsvc.Internal
+	}
+	if err := reflectsvc.Register(s, opts); err != nil {
+		log.Fatalf("failed to register reflection: %v", err)
+	}
+	if err := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)}).Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
\ No newline at end of file
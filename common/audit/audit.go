@@ -0,0 +1,230 @@
+// Package audit records mutating RPCs in an append-only, tamper-evident log.
+//
+// Every record is one JSON line holding the principal, method, a digest of the
+// request messages and the outcome of the call. Records are hash-chained: each
+// one stores the hash of its predecessor and its own hash is computed over its
+// content and that previous hash, so editing, removing or reordering any
+// record breaks the chain from that point on. Verify checks a log file.
+//
+// Removing the last records leaves a valid, shorter chain. Only a Checkpoint
+// of the head kept outside the log, such as the last sequence number and
+// hash auditverify prints, detects it: VerifyCheckpoint fails when the log
+// no longer holds the checkpoint record.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GenesisHash is the previous hash of the first record of a log.
+var GenesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Record is one audited call.
+type Record struct {
+	Seq           uint64    `json:"seq"`
+	Time          time.Time `json:"time"`
+	Principal     string    `json:"principal"`
+	Method        string    `json:"method"`
+	Peer          string    `json:"peer,omitempty"`
+	RequestID     string    `json:"request_id,omitempty"`
+	RequestDigest string    `json:"request_digest"`
+	Messages      int       `json:"messages"`
+	Code          string    `json:"code"`
+	Error         string    `json:"error,omitempty"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// computeHash returns the hash of r, covering every field but Hash itself.
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends records to a file.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	seq  uint64
+	prev string
+	// err is set once a failed record could not be removed, after which the
+	// file no longer ends with record seq and nothing is appended.
+	err error
+}
+
+// Open opens the audit log at path for appending, creating it if needed. An
+// existing log is verified first and new records continue its chain.
+func Open(path string) (*Log, error) {
+	l := &Log{prev: GenesisHash}
+	if f, err := os.Open(path); err == nil {
+		last, err := Verify(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("existing audit log %s is invalid: %w", path, err)
+		}
+		if last != nil {
+			l.seq, l.prev = last.Seq, last.Hash
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l.f = f
+	return l, nil
+}
+
+// Append chains r to the log and writes it durably. Seq, PrevHash and Hash
+// are filled in by Append. If r cannot be written, what was written of it
+// is truncated away so the next record continues the chain.
+func (l *Log) Append(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+
+	r.Seq = l.seq + 1
+	r.PrevHash = l.prev
+	hash, err := r.computeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	off, err := l.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if n, err := l.f.Write(append(line, '\n')); err != nil {
+		if n > 0 {
+			l.truncate(off)
+		}
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		l.truncate(off)
+		return err
+	}
+	l.seq, l.prev = r.Seq, r.Hash
+	return nil
+}
+
+// truncate removes a failed record written from offset off.
+func (l *Log) truncate(off int64) {
+	if err := l.f.Truncate(off); err != nil {
+		l.err = fmt.Errorf("audit log left with a partial record after seq %d: %w", l.seq, err)
+	}
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Checkpoint identifies a record of a log, kept elsewhere to detect the
+// removal of the records up to it.
+type Checkpoint struct {
+	Seq  uint64
+	Hash string
+}
+
+// ParseCheckpoint parses a checkpoint written as "seq:hash".
+func ParseCheckpoint(s string) (Checkpoint, error) {
+	seq, hash, ok := strings.Cut(s, ":")
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if !ok || err != nil || n == 0 || hash == "" {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint %q, want seq:hash", s)
+	}
+	return Checkpoint{Seq: n, Hash: hash}, nil
+}
+
+func (c Checkpoint) String() string {
+	return fmt.Sprintf("%d:%s", c.Seq, c.Hash)
+}
+
+// Verify reads a log and checks that sequence numbers are contiguous, every
+// record links to the hash of its predecessor and every hash matches the
+// record content. It returns the last record, or nil for an empty log.
+func Verify(r io.Reader) (*Record, error) {
+	return verify(r, func(*Record) error { return nil })
+}
+
+// VerifyCheckpoint is Verify for a log that must still hold the record of
+// checkpoint c, unchanged.
+func VerifyCheckpoint(r io.Reader, c Checkpoint) (*Record, error) {
+	found := false
+	last, err := verify(r, func(rec *Record) error {
+		if rec.Seq != c.Seq {
+			return nil
+		}
+		if rec.Hash != c.Hash {
+			return fmt.Errorf("hash %s does not match checkpoint %s", rec.Hash, c)
+		}
+		found = true
+		return nil
+	})
+	if err == nil && !found {
+		n := uint64(0)
+		if last != nil {
+			n = last.Seq
+		}
+		err = fmt.Errorf("log ends at record %d, before checkpoint %s: records were removed", n, c)
+	}
+	return last, err
+}
+
+// verify checks the chain of a log, calling check on every valid record.
+func verify(r io.Reader, check func(*Record) error) (*Record, error) {
+	var last *Record
+	prev := GenesisHash
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return last, fmt.Errorf("line %d: malformed record: %w", line, err)
+		}
+		if want := uint64(line); rec.Seq != want {
+			return last, fmt.Errorf("line %d: sequence %d, want %d", line, rec.Seq, want)
+		}
+		if rec.PrevHash != prev {
+			return last, fmt.Errorf("line %d: chain broken, prev_hash %s does not match the previous record hash %s", line, rec.PrevHash, prev)
+		}
+		hash, err := rec.computeHash()
+		if err != nil {
+			return last, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Hash != hash {
+			return last, fmt.Errorf("line %d: record was modified, hash %s does not match its content (%s)", line, rec.Hash, hash)
+		}
+		if err := check(&rec); err != nil {
+			return last, fmt.Errorf("line %d: %w", line, err)
+		}
+		prev = rec.Hash
+		last = &rec
+	}
+	return last, scanner.Err()
+}
@@ -0,0 +1,247 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestInterceptorRecordsAuditedMethods(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	auditor := New(l, []string{"check"}, nil)
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auditor.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(auditor.StreamServerInterceptor()))
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough://bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:admin")))
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Check(missing) = %v, want NotFound", err)
+	}
+	// Watch is not audited.
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Watch.Recv: %v", err)
+	}
+	l.Close()
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	last, err := Verify(f)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if last == nil || last.Seq != 2 {
+		t.Fatalf("last record = %+v, want seq 2", last)
+	}
+	if last.Principal != "claimed-basic:admin" || last.Method != "/grpc.health.v1.Health/Check" || last.Code != "NotFound" || last.Messages != 1 {
+		t.Errorf("last record = %+v", last)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, p := range []string{"alice", "bob", "carol"} {
+		if err := l.Append(Record{Principal: p, Method: "/svc/AddOrder", Code: "OK"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	l.Close()
+
+	// Reopening continues the chain.
+	l, err = Open(logPath)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if err := l.Append(Record{Principal: "dave", Method: "/svc/AddOrder", Code: "OK"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	l.Close()
+
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last, err := Verify(strings.NewReader(string(b))); err != nil || last.Seq != 4 {
+		t.Fatalf("Verify = %+v, %v; want seq 4", last, err)
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	for name, tc := range map[string]struct {
+		log  string
+		want string
+	}{
+		"modified": {strings.Replace(string(b), `"principal":"bob"`, `"principal":"eve"`, 1), "line 2: record was modified"},
+		"removed":  {lines[0] + lines[2] + lines[3], "line 2: sequence 3, want 2"},
+		"reordered": {
+			lines[0] + strings.Replace(lines[2], `"seq":3`, `"seq":2`, 1) + strings.Replace(lines[1], `"seq":2`, `"seq":3`, 1),
+			"line 2: chain broken",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(tc.log))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Verify = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, p := range []string{"alice", "bob", "carol"} {
+		if err := l.Append(Record{Principal: p, Method: "/svc/AddOrder", Code: "OK"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	l.Close()
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(b)
+	last, err := Verify(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	c, err := ParseCheckpoint(Checkpoint{Seq: last.Seq, Hash: last.Hash}.String())
+	if err != nil {
+		t.Fatalf("ParseCheckpoint: %v", err)
+	}
+
+	if _, err := VerifyCheckpoint(strings.NewReader(log), c); err != nil {
+		t.Errorf("VerifyCheckpoint(intact log) = %v", err)
+	}
+	lines := strings.SplitAfter(log, "\n")
+	truncated := lines[0] + lines[1]
+	if _, err := Verify(strings.NewReader(truncated)); err != nil {
+		t.Errorf("Verify(truncated log) = %v, want a valid chain", err)
+	}
+	if _, err := VerifyCheckpoint(strings.NewReader(truncated), c); err == nil || !strings.Contains(err.Error(), "records were removed") {
+		t.Errorf("VerifyCheckpoint(truncated log) = %v, want records were removed", err)
+	}
+	if _, err := VerifyCheckpoint(strings.NewReader(log), Checkpoint{Seq: 2, Hash: c.Hash}); err == nil || !strings.Contains(err.Error(), "line 2: hash") {
+		t.Errorf("VerifyCheckpoint(wrong hash) = %v, want line 2 mismatch", err)
+	}
+	for _, s := range []string{"", "3", "x:abc", "0:abc", "3:"} {
+		if _, err := ParseCheckpoint(s); err == nil {
+			t.Errorf("ParseCheckpoint(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRecordWithoutPeerAddress(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+	ctx := peer.NewContext(context.Background(), &peer.Peer{})
+	if err := New(l, []string{"check"}, nil).record(ctx, "/grpc.health.v1.Health/Check", newDigest(), nil); err != nil {
+		t.Errorf("record: %v", err)
+	}
+}
+
+func TestFailedAppendKeepsChain(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := l.Append(Record{Method: "/m/first"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// Writes to a read-only file fail.
+	w := l.f
+	if l.f, err = os.Open(logPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Record{Method: "/m/lost"}); err == nil {
+		t.Fatal("Append to a read-only file succeeded")
+	}
+	l.f.Close()
+	l.f = w
+	if err := l.Append(Record{Method: "/m/second"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	l.Close()
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	last, err := Verify(f)
+	if err != nil || last == nil || last.Seq != 2 || last.Method != "/m/second" {
+		t.Fatalf("Verify = %+v, %v; want record 2 continuing the chain", last, err)
+	}
+}
+
+func TestCallFailsWhenNotRecorded(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	l.Close()
+	interceptor := New(l, []string{"check"}, nil).UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return &healthpb.HealthCheckResponse{}, nil
+	}
+	resp, err := interceptor(context.Background(), &healthpb.HealthCheckRequest{}, info, handler)
+	if resp != nil || status.Code(err) != codes.Internal {
+		t.Errorf("call with a closed log = %v, %v; want INTERNAL", resp, err)
+	}
+}
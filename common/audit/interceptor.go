@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/principal"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+// DefaultMethods are the mutating RPCs of the ProductInfo and OrderManagement
+// services used throughout the examples.
+var DefaultMethods = []string{"AddProduct", "AddOrder", "UpdateOrders", "ProcessOrders"}
+
+// PrincipalFunc identifies the caller of an RPC.
+type PrincipalFunc = principal.Func
+
+// Auditor records the calls to a set of methods in a Log.
+type Auditor struct {
+	log       *Log
+	methods   map[string]bool
+	principal PrincipalFunc
+}
+
+// New returns an Auditor recording calls to the given methods in l. Methods
+// are matched by name, case-insensitively, whatever their service, so
+// "AddOrder" matches "/ecommerce.OrderManagement/addOrder". A nil identify
+// uses principal.Default, which records the credentials the client claims.
+func New(l *Log, methods []string, identify PrincipalFunc) *Auditor {
+	if identify == nil {
+		identify = principal.Default
+	}
+	a := &Auditor{log: l, methods: make(map[string]bool), principal: identify}
+	for _, m := range methods {
+		a.methods[strings.ToLower(m)] = true
+	}
+	return a
+}
+
+func (a *Auditor) audited(fullMethod string) bool {
+	return a.methods[strings.ToLower(path.Base(fullMethod))]
+}
+
+// UnaryServerInterceptor records audited unary calls once they complete. A
+// call that cannot be recorded fails with INTERNAL, whatever its result.
+func (a *Auditor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !a.audited(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		d := newDigest()
+		d.add(req)
+		resp, err := handler(ctx, req)
+		if rerr := a.record(ctx, info.FullMethod, d, err); rerr != nil {
+			return nil, rerr
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records audited streaming calls once they
+// complete. The request digest covers every message received from the client.
+// A call that cannot be recorded fails with INTERNAL, after the messages
+// already sent.
+func (a *Auditor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !a.audited(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		d := newDigest()
+		err := handler(srv, &digestStream{ServerStream: ss, digest: d})
+		if rerr := a.record(ss.Context(), info.FullMethod, d, err); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+}
+
+// record appends the call to the log. It returns the INTERNAL status to end
+// the call with if that fails.
+func (a *Auditor) record(ctx context.Context, method string, d *digest, err error) error {
+	st := status.Convert(err)
+	r := Record{
+		Time:          time.Now().UTC(),
+		Principal:     a.principal(ctx),
+		Method:        method,
+		RequestDigest: d.sum(),
+		Messages:      d.count,
+		Code:          st.Code().String(),
+		Error:         st.Message(),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.Peer = p.Addr.String()
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		r.RequestID = id
+	}
+	if err := a.log.Append(r); err != nil {
+		log.Printf("audit: failed to record %s: %v", method, err)
+		return status.Error(codes.Internal, "the call could not be audited")
+	}
+	return nil
+}
+
+// digest hashes the deterministic encoding of a sequence of messages. Each
+// message is prefixed with its length so message boundaries are part of the
+// digest.
+type digest struct {
+	h     hash.Hash
+	count int
+}
+
+func newDigest() *digest {
+	return &digest{h: sha256.New()}
+}
+
+func (d *digest) add(m interface{}) {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(pm)
+	if err != nil {
+		return
+	}
+	var n [8]byte
+	for i, l := 0, uint64(len(b)); i < 8; i++ {
+		n[i] = byte(l >> (8 * i))
+	}
+	d.h.Write(n[:])
+	d.h.Write(b)
+	d.count++
+}
+
+func (d *digest) sum() string {
+	return hex.EncodeToString(d.h.Sum(nil))
+}
+
+type digestStream struct {
+	grpc.ServerStream
+	digest *digest
+}
+
+func (s *digestStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.digest.add(m)
+	}
+	return err
+}
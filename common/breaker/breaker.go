@@ -0,0 +1,304 @@
+// Package breaker implements a client-side circuit breaker, one per target
+// and method, as unary and stream client interceptors.
+//
+// A breaker starts closed and lets every call through while recording its
+// outcome over a rolling window. Once the window holds at least MinCalls
+// calls and the ratio of failed ones, slow unary calls included, reaches
+// FailureRatio, it opens: calls fail at once with codes.Unavailable instead
+// of reaching the degraded server. After OpenTimeout it turns half-open and
+// lets HalfOpenCalls trial calls through; it closes if they all succeed and
+// opens again on the first failure.
+//
+// State changes are logged, passed to OnStateChange and exported as
+// Prometheus metrics:
+//
+//	grpc_client_circuit_breaker_state{target,method}                 0 closed, 1 open, 2 half-open
+//	grpc_client_circuit_breaker_transitions_total{target,method,to}
+//	grpc_client_circuit_breaker_rejected_total{target,method}
+package breaker
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// Open fails every call.
+	Open
+	// HalfOpen lets a few trial calls through.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Options configures the breakers. Zero values select the defaults.
+type Options struct {
+	// Window is the period over which failures are counted. Default 10s.
+	Window time.Duration
+	// MinCalls is the number of calls in the window below which the breaker
+	// does not open. Default 20.
+	MinCalls int
+	// FailureRatio is the ratio of failed calls opening the breaker.
+	// Default 0.5.
+	FailureRatio float64
+	// SlowCall is the duration above which a successful unary call counts as
+	// failed. Zero disables the latency threshold.
+	SlowCall time.Duration
+	// OpenTimeout is how long the breaker stays open before letting trial
+	// calls through. Default 5s.
+	OpenTimeout time.Duration
+	// HalfOpenCalls is the number of trial calls, all of which must succeed
+	// to close the breaker. Default 3.
+	HalfOpenCalls int
+	// IsFailure reports whether an error signals a degraded server. Default
+	// IsServerFailure.
+	IsFailure func(error) bool
+	// OnStateChange is called, without locks held, on every state change.
+	OnStateChange func(target, method string, from, to State)
+	// Metrics receives the state changes and rejections. Default none.
+	Metrics *Metrics
+
+	now func() time.Time
+}
+
+func (o *Options) setDefaults() {
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.MinCalls <= 0 {
+		o.MinCalls = 20
+	}
+	if o.FailureRatio <= 0 {
+		o.FailureRatio = 0.5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 5 * time.Second
+	}
+	if o.HalfOpenCalls <= 0 {
+		o.HalfOpenCalls = 3
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = IsServerFailure
+	}
+	if o.now == nil {
+		o.now = time.Now
+	}
+}
+
+// IsServerFailure reports whether err is one of the codes a struggling or
+// unreachable server returns: Unavailable, DeadlineExceeded,
+// ResourceExhausted, Internal and Unknown. Errors caused by the request or
+// the caller, such as NotFound or Canceled, do not count.
+func IsServerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// buckets is the number of buckets of the rolling window.
+const buckets = 10
+
+type bucket struct {
+	start           time.Time
+	calls, failures int
+}
+
+// breaker is the circuit breaker of one target and method.
+type breaker struct {
+	target, method string
+	opts           *Options
+
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	openedAt   time.Time
+	window     [buckets]bucket
+	// trials and successes count the calls let through and succeeded while
+	// half-open.
+	trials, successes int
+}
+
+type transition struct {
+	from, to State
+}
+
+// allow reports whether a call may proceed and, if so, the generation its
+// outcome must be recorded in.
+func (b *breaker) allow() (uint64, bool, *transition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var t *transition
+	if b.state == Open && b.opts.now().Sub(b.openedAt) >= b.opts.OpenTimeout {
+		t = b.setState(HalfOpen)
+	}
+	switch b.state {
+	case Open:
+		return 0, false, t
+	case HalfOpen:
+		if b.trials >= b.opts.HalfOpenCalls {
+			return 0, false, t
+		}
+		b.trials++
+	}
+	return b.generation, true, t
+}
+
+// record records the outcome of a call allowed in generation. Outcomes of
+// calls started before the last state change are ignored.
+func (b *breaker) record(generation uint64, failed bool) *transition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return nil
+	}
+	switch b.state {
+	case HalfOpen:
+		if failed {
+			return b.setState(Open)
+		}
+		b.successes++
+		if b.successes >= b.opts.HalfOpenCalls {
+			return b.setState(Closed)
+		}
+	case Closed:
+		bk := b.current()
+		bk.calls++
+		if failed {
+			bk.failures++
+		}
+		calls, failures := b.totals()
+		if calls >= b.opts.MinCalls && float64(failures) >= b.opts.FailureRatio*float64(calls) {
+			return b.setState(Open)
+		}
+	}
+	return nil
+}
+
+// release gives back the half-open trial of a call allowed in generation
+// that ended without telling anything about the server, such as one the
+// caller cancelled.
+func (b *breaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == HalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// current returns the bucket of the current time, resetting it if it last
+// held an older period.
+func (b *breaker) current() *bucket {
+	width := b.opts.Window / buckets
+	now := b.opts.now()
+	start := now.Truncate(width)
+	bk := &b.window[(now.UnixNano()/int64(width))%buckets]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *breaker) totals() (calls, failures int) {
+	oldest := b.opts.now().Add(-b.opts.Window)
+	for _, bk := range b.window {
+		if bk.start.After(oldest) {
+			calls += bk.calls
+			failures += bk.failures
+		}
+	}
+	return calls, failures
+}
+
+func (b *breaker) setState(to State) *transition {
+	t := &transition{from: b.state, to: to}
+	b.state = to
+	b.generation++
+	b.trials, b.successes = 0, 0
+	switch to {
+	case Open:
+		b.openedAt = b.opts.now()
+	case Closed:
+		b.window = [buckets]bucket{}
+	}
+	return t
+}
+
+func (b *breaker) currentState() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Breakers holds the circuit breakers of every target and method called
+// through its interceptors.
+type Breakers struct {
+	opts Options
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// New returns Breakers configured by opts.
+func New(opts Options) *Breakers {
+	opts.setDefaults()
+	return &Breakers{opts: opts, breakers: make(map[string]*breaker)}
+}
+
+func (bs *Breakers) get(target, method string) *breaker {
+	key := target + " " + method
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.breakers[key]
+	if !ok {
+		b = &breaker{target: target, method: method, opts: &bs.opts}
+		bs.breakers[key] = b
+		bs.opts.Metrics.observe(target, method, Closed)
+	}
+	return b
+}
+
+// State returns the state of the breaker of target and method.
+func (bs *Breakers) State(target, method string) State {
+	return bs.get(target, method).currentState()
+}
+
+func (bs *Breakers) notify(b *breaker, t *transition) {
+	if t == nil {
+		return
+	}
+	log.Printf("circuit breaker %s %s: %s -> %s", b.target, b.method, t.from, t.to)
+	bs.opts.Metrics.transition(b.target, b.method, t.to)
+	if bs.opts.OnStateChange != nil {
+		bs.opts.OnStateChange(b.target, b.method, t.from, t.to)
+	}
+}
+
+func (bs *Breakers) reject(b *breaker) error {
+	bs.opts.Metrics.reject(b.target, b.method)
+	return status.Errorf(codes.Unavailable, "circuit breaker open for %s %s", b.target, b.method)
+}
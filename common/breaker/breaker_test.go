@@ -0,0 +1,386 @@
+package breaker
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	checkMethod = "/grpc.health.v1.Health/Check"
+	watchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// degradingServer fails every call with code, when set, after sleeping delay.
+type degradingServer struct {
+	healthpb.UnimplementedHealthServer
+
+	mu    sync.Mutex
+	code  codes.Code
+	delay time.Duration
+	calls int
+}
+
+func (s *degradingServer) set(code codes.Code, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.code, s.delay = code, delay
+}
+
+func (s *degradingServer) answer() error {
+	s.mu.Lock()
+	s.calls++
+	code, delay := s.code, s.delay
+	s.mu.Unlock()
+	time.Sleep(delay)
+	if code != codes.OK {
+		return status.Error(code, "degraded")
+	}
+	return nil
+}
+
+func (s *degradingServer) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func (s *degradingServer) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if err := s.answer(); err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *degradingServer) Watch(_ *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if err := s.answer(); err != nil {
+		return err
+	}
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type env struct {
+	srv         *degradingServer
+	client      healthpb.HealthClient
+	breakers    *Breakers
+	clock       *fakeClock
+	reg         *prometheus.Registry
+	target      string
+	mu          sync.Mutex
+	transitions []string
+}
+
+func (e *env) changes() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.transitions...)
+}
+
+func setup(t *testing.T, opts Options) *env {
+	t.Helper()
+	e := &env{srv: &degradingServer{}, clock: &fakeClock{now: time.Unix(1000, 0)}, reg: prometheus.NewRegistry()}
+	metrics, err := NewMetrics(e.reg)
+	if err != nil {
+		t.Fatalf("NewMetrics: %v", err)
+	}
+	opts.Metrics = metrics
+	opts.now = e.clock.Now
+	opts.OnStateChange = func(_, method string, from, to State) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.transitions = append(e.transitions, method+" "+from.String()+"->"+to.String())
+	}
+	e.breakers = New(opts)
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, e.srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	e.target = "passthrough:///bufnet"
+	conn, err := grpc.NewClient(e.target,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(e.breakers.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(e.breakers.StreamClientInterceptor()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	e.client = healthpb.NewHealthClient(conn)
+	return e
+}
+
+func (e *env) check() error {
+	_, err := e.client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	return err
+}
+
+// metric returns the value of a breaker metric for the Check method.
+func (e *env) metric(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := e.reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if want, ok := labels[l.GetName()]; ok && want != l.GetValue() {
+					continue metrics
+				}
+			}
+			if m.GetGauge() != nil {
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	e := setup(t, Options{MinCalls: 4, FailureRatio: 0.5, OpenTimeout: time.Minute, HalfOpenCalls: 2})
+
+	// Client errors do not count.
+	e.srv.set(codes.NotFound, 0)
+	for i := 0; i < 10; i++ {
+		e.check()
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Closed {
+		t.Fatalf("state after client errors = %v, want closed", got)
+	}
+
+	// Server errors do: with 10 successes and 10 failures, the ratio reaches
+	// 0.5 on the 10th failure.
+	e.srv.set(codes.Unavailable, 0)
+	for i := 0; i < 10; i++ {
+		e.check()
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Open {
+		t.Fatalf("state after server errors = %v, want open", got)
+	}
+
+	// While open, calls fail fast without reaching the server.
+	calls := e.srv.callCount()
+	err := e.check()
+	if status.Code(err) != codes.Unavailable || !strings.Contains(err.Error(), "circuit breaker open") {
+		t.Fatalf("Check while open = %v, want circuit breaker Unavailable", err)
+	}
+	if e.srv.callCount() != calls {
+		t.Error("a call reached the server while the breaker was open")
+	}
+	// Other methods have their own breaker.
+	if got := e.breakers.State(e.target, watchMethod); got != Closed {
+		t.Errorf("Watch breaker = %v, want closed", got)
+	}
+
+	// A failed trial call opens the breaker again.
+	e.clock.Advance(time.Minute)
+	if err := e.check(); status.Code(err) != codes.Unavailable || strings.Contains(err.Error(), "circuit breaker") {
+		t.Fatalf("trial Check = %v, want the server error", err)
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Open {
+		t.Fatalf("state after a failed trial = %v, want open", got)
+	}
+
+	// Successful trial calls close it.
+	e.srv.set(codes.OK, 0)
+	e.clock.Advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := e.check(); err != nil {
+			t.Fatalf("trial Check %d: %v", i, err)
+		}
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Closed {
+		t.Fatalf("state after successful trials = %v, want closed", got)
+	}
+
+	want := []string{
+		checkMethod + " closed->open",
+		checkMethod + " open->half-open",
+		checkMethod + " half-open->open",
+		checkMethod + " open->half-open",
+		checkMethod + " half-open->closed",
+	}
+	if got := e.changes(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("transitions = %q, want %q", got, want)
+	}
+	labels := map[string]string{"method": checkMethod}
+	if got := e.metric(t, "grpc_client_circuit_breaker_state", labels); got != float64(Closed) {
+		t.Errorf("state metric = %v, want %v", got, float64(Closed))
+	}
+	if got := e.metric(t, "grpc_client_circuit_breaker_rejected_total", labels); got != 1 {
+		t.Errorf("rejected metric = %v, want 1", got)
+	}
+	labels["to"] = "open"
+	if got := e.metric(t, "grpc_client_circuit_breaker_transitions_total", labels); got != 2 {
+		t.Errorf("transitions to open = %v, want 2", got)
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	e := setup(t, Options{MinCalls: 4, Window: 10 * time.Second})
+	e.srv.set(codes.Unavailable, 0)
+	for i := 0; i < 3; i++ {
+		e.check()
+	}
+	// Failures older than the window are forgotten.
+	e.clock.Advance(11 * time.Second)
+	for i := 0; i < 3; i++ {
+		e.check()
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Closed {
+		t.Fatalf("state = %v, want closed", got)
+	}
+	e.check()
+	if got := e.breakers.State(e.target, checkMethod); got != Open {
+		t.Fatalf("state = %v, want open", got)
+	}
+}
+
+func TestBreakerSlowCalls(t *testing.T) {
+	e := setup(t, Options{MinCalls: 3, SlowCall: time.Millisecond})
+	e.breakers.opts.now = time.Now
+	e.srv.set(codes.OK, 20*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := e.check(); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Open {
+		t.Fatalf("state after slow calls = %v, want open", got)
+	}
+}
+
+func TestBreakerStreams(t *testing.T) {
+	e := setup(t, Options{MinCalls: 3})
+	e.srv.set(codes.Internal, 0)
+	for i := 0; i < 3; i++ {
+		stream, err := e.client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+		if _, err := stream.Recv(); status.Code(err) != codes.Internal {
+			t.Fatalf("Recv = %v, want Internal", err)
+		}
+	}
+	if got := e.breakers.State(e.target, watchMethod); got != Open {
+		t.Fatalf("state = %v, want open", got)
+	}
+	if _, err := e.client.Watch(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Watch while open = %v, want Unavailable", err)
+	}
+	if got := e.breakers.State(e.target, checkMethod); got != Closed {
+		t.Errorf("Check breaker = %v, want closed", got)
+	}
+}
+
+func TestBreakerStreamOutcomes(t *testing.T) {
+	e := setup(t, Options{MinCalls: 4, FailureRatio: 0.5, OpenTimeout: time.Minute, HalfOpenCalls: 1})
+	watch := func(ctx context.Context) (healthpb.Health_WatchClient, error) {
+		return e.client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	}
+
+	// Healthy streams the caller cancels after one message count as
+	// neither failures nor successes.
+	for i := 0; i < 200; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := watch(ctx)
+		if err != nil {
+			t.Fatalf("Watch %d: %v", i, err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("Recv %d: %v", i, err)
+		}
+		cancel()
+	}
+	// Streams read to the end count as successes.
+	for i := 0; i < 10; i++ {
+		stream, err := watch(context.Background())
+		if err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+		stream.Recv()
+		if _, err := stream.Recv(); err != io.EOF {
+			t.Fatalf("second Recv = %v, want EOF", err)
+		}
+	}
+	b := e.breakers.get(e.target, watchMethod)
+	if calls, failures := b.totals(); failures != 0 || calls < 10 {
+		t.Fatalf("window = %d calls, %d failures; want the 10 completed streams and no failure", calls, failures)
+	}
+	if got := e.breakers.State(e.target, watchMethod); got != Closed {
+		t.Fatalf("state = %v, want closed", got)
+	}
+
+	// Open the breaker, then cancel the only half-open trial: its slot is
+	// given back, so the next stream is let through and closes the breaker.
+	e.srv.set(codes.Internal, 0)
+	for e.breakers.State(e.target, watchMethod) != Open {
+		stream, err := watch(context.Background())
+		if err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+		stream.Recv()
+	}
+	e.srv.set(codes.OK, 0)
+	e.clock.Advance(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := watch(ctx); err != nil {
+		t.Fatalf("trial Watch: %v", err)
+	}
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stream, err := watch(context.Background())
+		if err == nil {
+			if _, err := stream.Recv(); err != nil {
+				t.Fatalf("trial Recv: %v", err)
+			}
+			stream.Recv()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Watch after a cancelled trial = %v, want the trial slot back", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := e.breakers.State(e.target, watchMethod); got != Closed {
+		t.Errorf("state after a successful trial = %v, want closed", got)
+	}
+}
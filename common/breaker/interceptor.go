@@ -0,0 +1,118 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor fails calls at once while their breaker is open and
+// records the outcome of the others.
+func (bs *Breakers) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		b := bs.get(cc.Target(), method)
+		generation, ok, t := b.allow()
+		bs.notify(b, t)
+		if !ok {
+			return bs.reject(b)
+		}
+		start := bs.opts.now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		slow := err == nil && bs.opts.SlowCall > 0 && bs.opts.now().Sub(start) > bs.opts.SlowCall
+		bs.done(ctx, b, generation, err, slow)
+		return err
+	}
+}
+
+// StreamClientInterceptor fails streams at once while their breaker is open
+// and records the outcome of the others when they end, as reported by
+// RecvMsg, SendMsg or CloseSend. The latency threshold does not apply to
+// streams.
+func (bs *Breakers) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		b := bs.get(cc.Target(), method)
+		generation, ok, t := b.allow()
+		bs.notify(b, t)
+		if !ok {
+			return nil, bs.reject(b)
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			bs.done(ctx, b, generation, err, false)
+			return nil, err
+		}
+		s := &stream{ClientStream: cs, done: func(err error) {
+			bs.done(ctx, b, generation, err, false)
+		}}
+		// A caller whose context ends may never read the outcome of the
+		// stream: cancelled streams end neutral and expired ones failed.
+		// The stream context is done as well when the stream ends by
+		// itself, with the outcome RecvMsg reports.
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-cs.Context().Done():
+			}
+			if err := ctx.Err(); err != nil {
+				s.finish(err)
+			}
+		}()
+		return s, nil
+	}
+}
+
+// done records the outcome err of a call allowed in generation. Calls the
+// caller cancelled say nothing about the server and are not counted.
+func (bs *Breakers) done(ctx context.Context, b *breaker, generation uint64, err error, slow bool) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		b.release(generation)
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		err = status.FromContextError(err).Err()
+	}
+	bs.notify(b, b.record(generation, slow || bs.opts.IsFailure(err)))
+}
+
+type stream struct {
+	grpc.ClientStream
+
+	once sync.Once
+	done func(error)
+}
+
+func (s *stream) finish(err error) {
+	s.once.Do(func() { s.done(err) })
+}
+
+func (s *stream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if errors.Is(err, io.EOF) {
+		s.finish(nil)
+	} else if err != nil {
+		s.finish(err)
+	}
+	return err
+}
+
+// SendMsg records send failures. io.EOF means the stream has ended and
+// RecvMsg reports how.
+func (s *stream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *stream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.finish(err)
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package breaker
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exports the state of the breakers to Prometheus.
+type Metrics struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+// NewMetrics registers the breaker metrics with reg, reusing the collectors
+// already registered by an earlier call.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_client_circuit_breaker_state",
+			Help: "State of the circuit breaker of a target and method: 0 closed, 1 open, 2 half-open.",
+		}, []string{"target", "method"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_circuit_breaker_transitions_total",
+			Help: "State changes of the circuit breaker of a target and method, by new state.",
+		}, []string{"target", "method", "to"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_circuit_breaker_rejected_total",
+			Help: "Calls failed by the circuit breaker of a target and method without reaching the server.",
+		}, []string{"target", "method"}),
+	}
+	var err error
+	if m.state, err = register(reg, m.state); err != nil {
+		return nil, err
+	}
+	if m.transitions, err = register(reg, m.transitions); err != nil {
+		return nil, err
+	}
+	if m.rejected, err = register(reg, m.rejected); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, err
+	}
+	return c, nil
+}
+
+func (m *Metrics) observe(target, method string, s State) {
+	if m != nil {
+		m.state.WithLabelValues(target, method).Set(float64(s))
+	}
+}
+
+func (m *Metrics) transition(target, method string, to State) {
+	if m != nil {
+		m.observe(target, method, to)
+		m.transitions.WithLabelValues(target, method, to.String()).Inc()
+	}
+}
+
+func (m *Metrics) reject(target, method string) {
+	if m != nil {
+		m.rejected.WithLabelValues(target, method).Inc()
+	}
+}
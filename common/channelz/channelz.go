@@ -0,0 +1,303 @@
+// Package channelz collects a snapshot of the gRPC channelz data of a process
+// and renders it as readable tables.
+//
+// The data can be read from a remote process that registered the channelz
+// service (see Register and Serve) or from the current process with
+// InProcessClient.
+package channelz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Register adds the channelz service to s.
+func Register(s grpc.ServiceRegistrar) {
+	channelzsvc.RegisterChannelzServiceToServer(s)
+}
+
+// Serve starts a gRPC server exposing only the channelz service on addr. It
+// is meant for client processes, which have no gRPC server of their own. The
+// returned function stops the server.
+func Serve(addr string) (func(), error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := grpc.NewServer()
+	Register(s)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("channelz server stopped: %v", err)
+		}
+	}()
+	log.Printf("channelz service listening on %s", lis.Addr())
+	return s.Stop, nil
+}
+
+// registrar captures the implementation passed to RegisterService.
+type registrar struct {
+	impl interface{}
+}
+
+func (r *registrar) RegisterService(_ *grpc.ServiceDesc, impl interface{}) {
+	r.impl = impl
+}
+
+// InProcessClient returns a ChannelzClient that reads the channelz data of the
+// current process directly, without a network round trip.
+func InProcessClient() channelzpb.ChannelzClient {
+	r := &registrar{}
+	Register(r)
+	return inProcess{r.impl.(channelzpb.ChannelzServer)}
+}
+
+type inProcess struct {
+	srv channelzpb.ChannelzServer
+}
+
+func (c inProcess) GetTopChannels(ctx context.Context, in *channelzpb.GetTopChannelsRequest, _ ...grpc.CallOption) (*channelzpb.GetTopChannelsResponse, error) {
+	return c.srv.GetTopChannels(ctx, in)
+}
+
+func (c inProcess) GetServers(ctx context.Context, in *channelzpb.GetServersRequest, _ ...grpc.CallOption) (*channelzpb.GetServersResponse, error) {
+	return c.srv.GetServers(ctx, in)
+}
+
+func (c inProcess) GetServer(ctx context.Context, in *channelzpb.GetServerRequest, _ ...grpc.CallOption) (*channelzpb.GetServerResponse, error) {
+	return c.srv.GetServer(ctx, in)
+}
+
+func (c inProcess) GetServerSockets(ctx context.Context, in *channelzpb.GetServerSocketsRequest, _ ...grpc.CallOption) (*channelzpb.GetServerSocketsResponse, error) {
+	return c.srv.GetServerSockets(ctx, in)
+}
+
+func (c inProcess) GetChannel(ctx context.Context, in *channelzpb.GetChannelRequest, _ ...grpc.CallOption) (*channelzpb.GetChannelResponse, error) {
+	return c.srv.GetChannel(ctx, in)
+}
+
+func (c inProcess) GetSubchannel(ctx context.Context, in *channelzpb.GetSubchannelRequest, _ ...grpc.CallOption) (*channelzpb.GetSubchannelResponse, error) {
+	return c.srv.GetSubchannel(ctx, in)
+}
+
+func (c inProcess) GetSocket(ctx context.Context, in *channelzpb.GetSocketRequest, _ ...grpc.CallOption) (*channelzpb.GetSocketResponse, error) {
+	return c.srv.GetSocket(ctx, in)
+}
+
+// Snapshot is the channelz state of a process at one point in time.
+type Snapshot struct {
+	Servers     []*channelzpb.Server
+	Channels    []*channelzpb.Channel
+	Subchannels []*channelzpb.Subchannel
+	// Sockets maps a socket ID to its data, for server and subchannel sockets.
+	Sockets map[int64]*channelzpb.Socket
+	// ServerSockets maps a server ID to the IDs of its accepted sockets.
+	ServerSockets map[int64][]int64
+}
+
+// Fetch reads the servers, channels (including nested ones), subchannels and
+// sockets exposed by client, following the pages of every list.
+func Fetch(ctx context.Context, client channelzpb.ChannelzClient) (*Snapshot, error) {
+	snap := &Snapshot{
+		Sockets:       make(map[int64]*channelzpb.Socket),
+		ServerSockets: make(map[int64][]int64),
+	}
+
+	for start, end := int64(0), false; !end; {
+		resp, err := client.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return nil, fmt.Errorf("get servers: %w", err)
+		}
+		for _, srv := range resp.GetServer() {
+			start = srv.GetRef().GetServerId() + 1
+			snap.Servers = append(snap.Servers, srv)
+		}
+		end = resp.GetEnd() || len(resp.GetServer()) == 0
+	}
+	for _, srv := range snap.Servers {
+		if err := snap.addServerSockets(ctx, client, srv.GetRef().GetServerId()); err != nil {
+			return nil, err
+		}
+	}
+
+	for start, end := int64(0), false; !end; {
+		resp, err := client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return nil, fmt.Errorf("get top channels: %w", err)
+		}
+		for _, ch := range resp.GetChannel() {
+			start = ch.GetRef().GetChannelId() + 1
+			if err := snap.addChannel(ctx, client, ch); err != nil {
+				return nil, err
+			}
+		}
+		end = resp.GetEnd() || len(resp.GetChannel()) == 0
+	}
+	return snap, nil
+}
+
+func (s *Snapshot) addServerSockets(ctx context.Context, client channelzpb.ChannelzClient, id int64) error {
+	for start, end := int64(0), false; !end; {
+		resp, err := client.GetServerSockets(ctx, &channelzpb.GetServerSocketsRequest{ServerId: id, StartSocketId: start})
+		if err != nil {
+			return fmt.Errorf("get sockets of server %d: %w", id, err)
+		}
+		for _, ref := range resp.GetSocketRef() {
+			start = ref.GetSocketId() + 1
+			s.ServerSockets[id] = append(s.ServerSockets[id], ref.GetSocketId())
+			if err := s.addSocket(ctx, client, ref.GetSocketId()); err != nil {
+				return err
+			}
+		}
+		end = resp.GetEnd() || len(resp.GetSocketRef()) == 0
+	}
+	return nil
+}
+
+func (s *Snapshot) addChannel(ctx context.Context, client channelzpb.ChannelzClient, ch *channelzpb.Channel) error {
+	s.Channels = append(s.Channels, ch)
+	for _, ref := range ch.GetChannelRef() {
+		resp, err := client.GetChannel(ctx, &channelzpb.GetChannelRequest{ChannelId: ref.GetChannelId()})
+		if err != nil {
+			return fmt.Errorf("get channel %d: %w", ref.GetChannelId(), err)
+		}
+		if err := s.addChannel(ctx, client, resp.GetChannel()); err != nil {
+			return err
+		}
+	}
+	for _, ref := range ch.GetSubchannelRef() {
+		resp, err := client.GetSubchannel(ctx, &channelzpb.GetSubchannelRequest{SubchannelId: ref.GetSubchannelId()})
+		if err != nil {
+			return fmt.Errorf("get subchannel %d: %w", ref.GetSubchannelId(), err)
+		}
+		sc := resp.GetSubchannel()
+		s.Subchannels = append(s.Subchannels, sc)
+		for _, sref := range sc.GetSocketRef() {
+			if err := s.addSocket(ctx, client, sref.GetSocketId()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) addSocket(ctx context.Context, client channelzpb.ChannelzClient, id int64) error {
+	resp, err := client.GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: id})
+	if err != nil {
+		return fmt.Errorf("get socket %d: %w", id, err)
+	}
+	s.Sockets[id] = resp.GetSocket()
+	return nil
+}
+
+// WriteTable renders the snapshot as aligned text tables.
+func WriteTable(w io.Writer, s *Snapshot) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SERVERS")
+	fmt.Fprintln(tw, "ID\tLISTEN\tCALLS STARTED\tSUCCEEDED\tFAILED\tLAST CALL\tSOCKETS")
+	for _, srv := range s.Servers {
+		var listen []string
+		for _, ref := range srv.GetListenSocket() {
+			listen = append(listen, ref.GetName())
+		}
+		d := srv.GetData()
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			srv.GetRef().GetServerId(), strings.Join(listen, ","),
+			d.GetCallsStarted(), d.GetCallsSucceeded(), d.GetCallsFailed(),
+			formatTime(d.GetLastCallStartedTimestamp()),
+			joinIDs(s.ServerSockets[srv.GetRef().GetServerId()]))
+	}
+
+	fmt.Fprintln(tw, "\nCHANNELS")
+	fmt.Fprintln(tw, "ID\tTARGET\tSTATE\tCALLS STARTED\tSUCCEEDED\tFAILED\tLAST CALL\tSUBCHANNELS")
+	for _, ch := range s.Channels {
+		d := ch.GetData()
+		var subs []int64
+		for _, ref := range ch.GetSubchannelRef() {
+			subs = append(subs, ref.GetSubchannelId())
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			ch.GetRef().GetChannelId(), d.GetTarget(), d.GetState().GetState(),
+			d.GetCallsStarted(), d.GetCallsSucceeded(), d.GetCallsFailed(),
+			formatTime(d.GetLastCallStartedTimestamp()), joinIDs(subs))
+	}
+
+	fmt.Fprintln(tw, "\nSUBCHANNELS")
+	fmt.Fprintln(tw, "ID\tTARGET\tSTATE\tCALLS STARTED\tSUCCEEDED\tFAILED\tLAST CALL\tSOCKETS")
+	for _, sc := range s.Subchannels {
+		d := sc.GetData()
+		var socks []int64
+		for _, ref := range sc.GetSocketRef() {
+			socks = append(socks, ref.GetSocketId())
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			sc.GetRef().GetSubchannelId(), d.GetTarget(), d.GetState().GetState(),
+			d.GetCallsStarted(), d.GetCallsSucceeded(), d.GetCallsFailed(),
+			formatTime(d.GetLastCallStartedTimestamp()), joinIDs(socks))
+	}
+
+	fmt.Fprintln(tw, "\nSOCKETS")
+	fmt.Fprintln(tw, "ID\tLOCAL\tREMOTE\tSTREAMS STARTED\tSUCCEEDED\tFAILED\tMSGS SENT\tMSGS RECEIVED\tKEEPALIVES")
+	for _, id := range sortedIDs(s.Sockets) {
+		sock := s.Sockets[id]
+		d := sock.GetData()
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			id, formatAddress(sock.GetLocal()), formatAddress(sock.GetRemote()),
+			d.GetStreamsStarted(), d.GetStreamsSucceeded(), d.GetStreamsFailed(),
+			d.GetMessagesSent(), d.GetMessagesReceived(), d.GetKeepAlivesSent())
+	}
+	return tw.Flush()
+}
+
+func formatAddress(a *channelzpb.Address) string {
+	switch {
+	case a.GetTcpipAddress() != nil:
+		tcp := a.GetTcpipAddress()
+		return net.JoinHostPort(net.IP(tcp.GetIpAddress()).String(), fmt.Sprint(tcp.GetPort()))
+	case a.GetUdsAddress() != nil:
+		return "unix:" + a.GetUdsAddress().GetFilename()
+	case a.GetOtherAddress() != nil:
+		return a.GetOtherAddress().GetName()
+	}
+	return "-"
+}
+
+func formatTime(ts *timestamppb.Timestamp) string {
+	if ts == nil || (ts.GetSeconds() == 0 && ts.GetNanos() == 0) {
+		return "-"
+	}
+	return ts.AsTime().Local().Format(time.TimeOnly)
+}
+
+func joinIDs(ids []int64) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortedIDs(m map[int64]*channelzpb.Socket) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
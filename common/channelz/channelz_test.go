@@ -0,0 +1,128 @@
+package channelz
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestFetchAndWriteTable(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	s := grpc.NewServer()
+	Register(s)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+
+	for name, client := range map[string]channelzpb.ChannelzClient{
+		"remote":     channelzpb.NewChannelzClient(conn),
+		"in-process": InProcessClient(),
+	} {
+		snap, err := Fetch(context.Background(), client)
+		if err != nil {
+			t.Fatalf("%s: Fetch: %v", name, err)
+		}
+		if len(snap.Servers) == 0 || len(snap.Channels) == 0 || len(snap.Subchannels) == 0 || len(snap.Sockets) == 0 {
+			t.Fatalf("%s: incomplete snapshot: %d servers, %d channels, %d subchannels, %d sockets", name,
+				len(snap.Servers), len(snap.Channels), len(snap.Subchannels), len(snap.Sockets))
+		}
+		var started int64
+		for _, srv := range snap.Servers {
+			started += srv.GetData().GetCallsStarted()
+		}
+		if started < 3 {
+			t.Errorf("%s: servers started %d calls, want at least 3", name, started)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteTable(&buf, snap); err != nil {
+			t.Fatalf("%s: WriteTable: %v", name, err)
+		}
+		for _, want := range []string{"SERVERS", "CHANNELS", "SUBCHANNELS", "SOCKETS", lis.Addr().String(), "READY"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: table does not contain %q:\n%s", name, want, buf.String())
+			}
+		}
+	}
+}
+
+// pagingClient asks for one entry per page of every list.
+type pagingClient struct {
+	channelzpb.ChannelzClient
+}
+
+func (c pagingClient) GetServers(ctx context.Context, in *channelzpb.GetServersRequest, opts ...grpc.CallOption) (*channelzpb.GetServersResponse, error) {
+	in.MaxResults = 1
+	return c.ChannelzClient.GetServers(ctx, in, opts...)
+}
+
+func (c pagingClient) GetTopChannels(ctx context.Context, in *channelzpb.GetTopChannelsRequest, opts ...grpc.CallOption) (*channelzpb.GetTopChannelsResponse, error) {
+	in.MaxResults = 1
+	return c.ChannelzClient.GetTopChannels(ctx, in, opts...)
+}
+
+func (c pagingClient) GetServerSockets(ctx context.Context, in *channelzpb.GetServerSocketsRequest, opts ...grpc.CallOption) (*channelzpb.GetServerSocketsResponse, error) {
+	in.MaxResults = 1
+	return c.ChannelzClient.GetServerSockets(ctx, in, opts...)
+}
+
+func TestFetchFollowsPages(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		lis, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		s := grpc.NewServer()
+		healthpb.RegisterHealthServer(s, health.NewServer())
+		go s.Serve(lis)
+		defer s.Stop()
+		for j := 0; j < 2; j++ {
+			conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			defer conn.Close()
+			if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+		}
+	}
+
+	all, err := Fetch(context.Background(), InProcessClient())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	paged, err := Fetch(context.Background(), pagingClient{InProcessClient()})
+	if err != nil {
+		t.Fatalf("Fetch one per page: %v", err)
+	}
+	if len(paged.Servers) != len(all.Servers) || len(paged.Channels) != len(all.Channels) || len(paged.Sockets) != len(all.Sockets) {
+		t.Errorf("one per page: %d servers, %d channels, %d sockets; want %d, %d, %d",
+			len(paged.Servers), len(paged.Channels), len(paged.Sockets), len(all.Servers), len(all.Channels), len(all.Sockets))
+	}
+	if len(all.Servers) < 2 || len(all.Channels) < 4 {
+		t.Errorf("snapshot has %d servers and %d channels, want at least 2 and 4", len(all.Servers), len(all.Channels))
+	}
+}
@@ -0,0 +1,60 @@
+// Command auditverify checks the hash chain of an audit log written by the
+// audit package. It exits with status 1 when a record was modified, removed
+// or reordered.
+//
+//	go run ./cmd/auditverify audit.log
+//	go run ./cmd/auditverify -checkpoint 4:5c0f... audit.log
+//
+// Removing the last records leaves a valid chain. To detect it, keep the
+// checkpoint printed by a previous run somewhere the log's writer cannot
+// change and pass it with -checkpoint.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/audit"
+)
+
+func main() {
+	checkpoint := flag.String("checkpoint", "", "seq:hash of a record the log must still hold, as printed by a previous run")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: auditverify [-checkpoint seq:hash] <audit log>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer f.Close()
+
+	verify := audit.Verify
+	if *checkpoint != "" {
+		c, err := audit.ParseCheckpoint(*checkpoint)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		verify = func(r io.Reader) (*audit.Record, error) { return audit.VerifyCheckpoint(r, c) }
+	}
+	last, err := verify(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: TAMPERED: %v\n", path, err)
+		os.Exit(1)
+	}
+	if last == nil {
+		fmt.Printf("%s: OK, empty log\n", path)
+		return
+	}
+	fmt.Printf("%s: OK, %d records, checkpoint %s\n", path, last.Seq, audit.Checkpoint{Seq: last.Seq, Hash: last.Hash})
+}
@@ -0,0 +1,55 @@
+// Command channelz connects to a process exposing the gRPC channelz service
+// and prints its servers, channels, subchannels and sockets as tables.
+//
+//	go run ./cmd/channelz -addr localhost:50051
+//	go run ./cmd/channelz -addr localhost:50100 -watch 2s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/channelz"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:50051", "address of the process exposing the channelz service")
+	watch := flag.Duration("watch", 0, "refresh interval; print once when zero")
+	flag.Parse()
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	client := channelzpb.NewChannelzClient(conn)
+
+	for {
+		if err := printSnapshot(client); err != nil {
+			log.Fatalf("could not read channelz data from %s: %v", *addr, err)
+		}
+		if *watch <= 0 {
+			return
+		}
+		time.Sleep(*watch)
+		fmt.Print("\033[H\033[2J") // clear the terminal between refreshes
+	}
+}
+
+func printSnapshot(client channelzpb.ChannelzClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	snap, err := channelz.Fetch(ctx, client)
+	if err != nil {
+		return err
+	}
+	return channelz.WriteTable(os.Stdout, snap)
+}
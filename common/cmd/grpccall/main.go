@@ -0,0 +1,247 @@
+// Command grpccall talks to any gRPC server exposing the reflection service:
+// it lists services, describes services, methods and messages in proto
+// syntax and invokes unary and streaming methods with JSON messages.
+//
+//	go run ./cmd/grpccall localhost:50051 list
+//	go run ./cmd/grpccall localhost:50051 describe ecommerce.Product
+//	go run ./cmd/grpccall -d '{"name":"Apple","price":699}' localhost:50051 call ecommerce.ProductInfo/addProduct
+//	go run ./cmd/grpccall localhost:50051 call ecommerce.OrderManagement/processOrders < ids.ndjson
+//
+// Requests are read as one JSON message per line, from -d or else from
+// standard input; each response is written as one line of JSON.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // renders the standard error details
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/dynamic"
+)
+
+var errUsage = errors.New("usage")
+
+type headers []string
+
+func (h *headers) String() string     { return strings.Join(*h, ", ") }
+func (h *headers) Set(v string) error { *h = append(*h, v); return nil }
+
+var (
+	useTLS     = flag.Bool("tls", false, "connect over TLS")
+	caCert     = flag.String("cacert", "", "PEM file with the CA certificates to verify the server with (implies -tls)")
+	cert       = flag.String("cert", "", "PEM client certificate for mutual TLS (implies -tls, needs -key)")
+	key        = flag.String("key", "", "PEM private key of -cert")
+	serverName = flag.String("servername", "", "server name to verify the certificate against")
+	skipVerify = flag.Bool("insecure", false, "do not verify the server certificate (implies -tls)")
+	bearer     = flag.String("bearer", "", "send the token as \"authorization: Bearer <token>\"")
+	basic      = flag.String("basic", "", "send user:password as \"authorization: Basic ...\"")
+	data       = flag.String("d", "", "request messages as JSON, one per line; read from standard input when empty")
+	pretty     = flag.Bool("pretty", false, "indent JSON responses")
+	verbose    = flag.Bool("v", false, "print response headers and trailers to standard error")
+	timeout    = flag.Duration("timeout", 0, "deadline of the whole command; none when zero")
+	header     headers
+)
+
+func main() {
+	flag.Var(&header, "H", "extra request metadata as \"name: value\" (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `usage: grpccall [flags] <address> list [service]
+       grpccall [flags] <address> describe <symbol>
+       grpccall [flags] <address> call <package.Service/Method>
+
+`)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(args[0], args[1], args[2:])
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		if st, ok := status.FromError(err); ok {
+			fmt.Fprintf(os.Stderr, "ERROR:\n  Code: %s\n  Message: %s\n", st.Code(), st.Message())
+			for _, d := range st.Proto().GetDetails() {
+				if b, err := protojson.Marshal(d); err == nil {
+					fmt.Fprintf(os.Stderr, "  Details: %s\n", b)
+				} else {
+					fmt.Fprintf(os.Stderr, "  Details: %s (%d bytes)\n", d.GetTypeUrl(), len(d.GetValue()))
+				}
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(addr, command string, args []string) error {
+	creds, err := transportCredentials()
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	if ctx, err = outgoingMetadata(ctx); err != nil {
+		return err
+	}
+	r := dynamic.NewResolver(conn)
+
+	switch {
+	case command == "list" && len(args) == 0:
+		services, err := r.ListServices(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			fmt.Println(s)
+		}
+		return nil
+	case command == "list" && len(args) == 1:
+		sd, err := r.FindService(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < sd.Methods().Len(); i++ {
+			fmt.Println(sd.Methods().Get(i).FullName())
+		}
+		return nil
+	case command == "describe" && len(args) == 1:
+		d, err := r.FindSymbol(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return dynamic.Describe(os.Stdout, d)
+	case command == "call" && len(args) == 1:
+		return call(ctx, conn, r, args[0])
+	}
+	return errUsage
+}
+
+func call(ctx context.Context, conn *grpc.ClientConn, r *dynamic.Resolver, method string) error {
+	md, err := r.FindMethod(ctx, method)
+	if err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	if *data != "" {
+		in = strings.NewReader(*data)
+	}
+	marshal := protojson.MarshalOptions{Resolver: r.Types()}
+	if *pretty {
+		marshal.Multiline = true
+	}
+	var head, trail metadata.MD
+	err = dynamic.Call(ctx, conn, md,
+		dynamic.JSONRequests(in, md.Input(), protojson.UnmarshalOptions{Resolver: r.Types()}),
+		func(m proto.Message) error {
+			b, err := marshal.Marshal(m)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Printf("%s\n", b)
+			return err
+		},
+		grpc.Header(&head), grpc.Trailer(&trail))
+	if *verbose {
+		printMetadata("header", head)
+		printMetadata("trailer", trail)
+	}
+	return err
+}
+
+func printMetadata(kind string, md metadata.MD) {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			fmt.Fprintf(os.Stderr, "< %s %s: %s\n", kind, k, v)
+		}
+	}
+}
+
+func transportCredentials() (credentials.TransportCredentials, error) {
+	if !*useTLS && *caCert == "" && *cert == "" && !*skipVerify {
+		return insecure.NewCredentials(), nil
+	}
+	cfg := &tls.Config{ServerName: *serverName, InsecureSkipVerify: *skipVerify}
+	if *caCert != "" {
+		pem, err := os.ReadFile(*caCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *caCert)
+		}
+	}
+	if *cert != "" || *key != "" {
+		pair, err := tls.LoadX509KeyPair(*cert, *key)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// outgoingMetadata attaches the -H headers and the credentials of -bearer or
+// -basic to every call, reflection included.
+func outgoingMetadata(ctx context.Context) (context.Context, error) {
+	var kv []string
+	for _, h := range header {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, want \"name: value\"", h)
+		}
+		kv = append(kv, strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value))
+	}
+	switch {
+	case *bearer != "" && *basic != "":
+		return nil, fmt.Errorf("-bearer and -basic are mutually exclusive")
+	case *bearer != "":
+		kv = append(kv, "authorization", "Bearer "+*bearer)
+	case *basic != "":
+		kv = append(kv, "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(*basic)))
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...), nil
+}
@@ -0,0 +1,67 @@
+// Command grpcproxy forwards gRPC calls to backends chosen by full method
+// name (see package grpcproxy), so services can move to separate processes
+// while clients keep dialing one address.
+//
+//	go run ./cmd/grpcproxy -config ../chap05/multiplexing/proxy.yaml -listen :50051
+//
+// The proxy serves health itself, reporting whether its routes can reach
+// their backends (see Proxy.WatchHealth). Reflection lists the services of
+// the -descriptor-sets files, since the proxy links in none of them.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/grpcproxy"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle"
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/reflectsvc"
+)
+
+func main() {
+	config := flag.String("config", "proxy.yaml", "routing table in YAML or JSON")
+	listen := flag.String("listen", ":50051", "address to serve on")
+	descriptorSets := flag.String("descriptor-sets", "", "comma-separated FileDescriptorSet files describing the proxied services to reflection")
+	flag.Parse()
+
+	c, err := grpcproxy.Load(*config)
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	proxy, err := grpcproxy.New(c)
+	if err != nil {
+		log.Fatalf("failed to connect to backends: %v", err)
+	}
+	defer proxy.Close()
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer(proxy.ServerOptions()...)
+	opts := reflectsvc.Options{Hidden: reflectsvc.Internal}
+	if *descriptorSets != "" {
+		opts.DescriptorSets = strings.Split(*descriptorSets, ",")
+	}
+	if err := reflectsvc.Register(s, opts); err != nil {
+		log.Fatalf("failed to register reflection: %v", err)
+	}
+	for _, r := range c.Routes {
+		to := r.Target
+		if to == "" {
+			to = strings.Join(r.Backends, ", ")
+		}
+		log.Printf("routing %s* to %s", r.Match, to)
+	}
+	h := stdhealth.Register(s)
+	proxy.WatchHealth(context.Background(), h)
+	if err := lifecycle.New(s, lifecycle.Options{Health: h}).Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
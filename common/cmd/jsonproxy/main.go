@@ -0,0 +1,79 @@
+// Command jsonproxy exposes every method of a gRPC backend as a JSON endpoint
+// over HTTP, using the backend's reflection service instead of generated
+// gateway code (see dynamic.Proxy).
+//
+//	go run ./cmd/jsonproxy -backend localhost:50051 -listen :8081
+//	curl -d '{"name":"Apple","price":699}' localhost:8081/ecommerce.ProductInfo/addProduct
+//	curl -d '"Google"' localhost:8081/ecommerce.OrderManagement/searchOrders
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/dynamic"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+func main() {
+	listen := flag.String("listen", ":8081", "HTTP address to serve on")
+	backend := flag.String("backend", "localhost:50051", "address of the gRPC backend exposing reflection")
+	forward := flag.String("forward-headers", "Authorization,Cookie", "comma-separated HTTP headers sent to the backend as metadata")
+	useTLS := flag.Bool("tls", false, "connect to the backend over TLS")
+	caCert := flag.String("cacert", "", "PEM file with the CA certificates to verify the backend with (implies -tls)")
+	flag.Parse()
+
+	creds, err := backendCredentials(*useTLS, *caCert)
+	if err != nil {
+		log.Fatalf("invalid TLS settings: %v", err)
+	}
+	conn, err := grpc.NewClient(*backend,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(requestid.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(requestid.StreamClientInterceptor()))
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	var headers []string
+	for _, h := range strings.Split(*forward, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, h)
+		}
+	}
+	proxy := dynamic.NewProxy(conn, headers...)
+
+	log.Printf("JSON proxy for %s listening on %s", *backend, *listen)
+	if err := http.ListenAndServe(*listen, requestid.Handler(proxy)); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+func backendCredentials(useTLS bool, caCert string) (credentials.TransportCredentials, error) {
+	if !useTLS && caCert == "" {
+		return insecure.NewCredentials(), nil
+	}
+	cfg := &tls.Config{}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+	}
+	return credentials.NewTLS(cfg), nil
+}
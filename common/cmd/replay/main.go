@@ -0,0 +1,162 @@
+// Command replay sends the calls of a recording written by the recording
+// package to a target server, one after the other, and reports every call
+// whose status or responses differ from the recorded ones. It exits with
+// status 1 when any does.
+//
+//	go run ./cmd/replay -target localhost:50052 calls.jsonl
+//	go run ./cmd/replay -target localhost:50052 -unordered -ignore id -H 'authorization: Bearer some-secret-token' calls.jsonl
+//
+// Responses are compared as messages when the target serves reflection,
+// as bytes otherwise.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/dynamic"
+	"github.com/cuongpiger/grpc-up-and-running/common/recording"
+)
+
+type headers []string
+
+func (h *headers) String() string     { return strings.Join(*h, ", ") }
+func (h *headers) Set(v string) error { *h = append(*h, v); return nil }
+
+func main() {
+	target := flag.String("target", "localhost:50051", "address of the server to replay the calls against")
+	useTLS := flag.Bool("tls", false, "connect to the target over TLS")
+	caCert := flag.String("cacert", "", "PEM file with the CA certificates to verify the target with (implies -tls)")
+	methods := flag.String("methods", "", "comma-separated prefixes of the full method names to replay; all when empty")
+	ignore := flag.String("ignore", "", "comma-separated response field names left out of the comparison, e.g. generated IDs")
+	unordered := flag.Bool("unordered", false, "accept stream responses in any order")
+	keepTiming := flag.Bool("keep-timing", false, "send calls and stream messages at their recorded pace instead of back to back")
+	useReflection := flag.Bool("reflection", true, "compare responses as messages using the target's reflection service")
+	verbose := flag.Bool("v", false, "print every call, not only mismatches")
+	var header headers
+	flag.Var(&header, "H", "metadata sent with every call as \"name: value\", replacing recorded values (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: replay [flags] <recording>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	md := metadata.MD{}
+	for _, h := range header {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			log.Fatalf("invalid -H %q, want \"name: value\"", h)
+		}
+		md.Append(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	creds, err := targetCredentials(*useTLS, *caCert)
+	if err != nil {
+		log.Fatalf("invalid TLS settings: %v", err)
+	}
+	conn, err := grpc.NewClient(*target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	opts := recording.ReplayOptions{Unordered: *unordered, KeepTiming: *keepTiming, Metadata: md}
+	if *useReflection {
+		opts.Resolver = dynamic.NewResolver(conn)
+	}
+	if *ignore != "" {
+		opts.Ignore = strings.Split(*ignore, ",")
+	}
+	replayer := recording.NewReplayer(conn, opts)
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// The reflection lookups carry the -H metadata too.
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	var replayed, mismatched int
+	var first time.Time
+	began := time.Now()
+	err = recording.Read(f, func(c *recording.Call) error {
+		if !selected(c.Method, *methods) {
+			return nil
+		}
+		if first.IsZero() {
+			first = c.Start
+		}
+		if *keepTiming {
+			time.Sleep(time.Until(began.Add(c.Start.Sub(first))))
+		}
+		res, err := replayer.Replay(ctx, c)
+		if err != nil {
+			return err
+		}
+		replayed++
+		if len(res.Mismatches) == 0 {
+			if *verbose {
+				fmt.Printf("ok       #%d %s %v (recorded %v)\n", replayed, c.Method, res.Duration.Round(time.Microsecond), c.Duration.Round(time.Microsecond))
+			}
+			return nil
+		}
+		mismatched++
+		fmt.Printf("MISMATCH #%d %s recorded at %s\n", replayed, c.Method, c.Start.Format(time.RFC3339Nano))
+		for _, m := range res.Mismatches {
+			fmt.Printf("  %s\n", m)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+	fmt.Printf("%d calls replayed against %s: %d matched, %d mismatched\n", replayed, *target, replayed-mismatched, mismatched)
+	if mismatched > 0 {
+		os.Exit(1)
+	}
+}
+
+func selected(method, prefixes string) bool {
+	if prefixes == "" {
+		return true
+	}
+	for _, p := range strings.Split(prefixes, ",") {
+		if strings.HasPrefix(method, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func targetCredentials(useTLS bool, caCert string) (credentials.TransportCredentials, error) {
+	if !useTLS && caCert == "" {
+		return insecure.NewCredentials(), nil
+	}
+	cfg := &tls.Config{}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+	}
+	return credentials.NewTLS(cfg), nil
+}
@@ -0,0 +1,173 @@
+// Package debugz serves zpages-style live debug pages for a gRPC server on an
+// admin HTTP listener.
+//
+// A server opts in by installing the Monitor interceptors and mounting the mux
+// returned by NewMux on its admin address:
+//
+//	monitor := debugz.NewMonitor()
+//	s := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(monitor.UnaryServerInterceptor()),
+//		grpc.ChainStreamInterceptor(monitor.StreamServerInterceptor()))
+//	...
+//	go http.ListenAndServe("localhost:7777", debugz.NewMux(debugz.Options{
+//		Monitor: monitor, Server: s, Health: healthServer,
+//	}))
+//
+// The mux exposes:
+//
+//	/debug/            index of the pages below
+//	/debug/rpcz        active RPCs, per-method latency summaries, recent errors
+//	/debug/servicez    registered services and their methods
+//	/debug/healthz     serving status of every registered service
+//	/debug/channelz    channelz servers, channels, subchannels and sockets
+//
+// Additional pages, such as the OpenTelemetry tracez handler, can be mounted
+// on the returned mux.
+package debugz
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/channelz"
+)
+
+// HealthChecker reports the serving status of a service. The standard
+// google.golang.org/grpc/health server implements it.
+type HealthChecker interface {
+	Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error)
+}
+
+// Options selects the data sources of the debug pages. Pages whose source is
+// nil say so instead of failing.
+type Options struct {
+	// Monitor feeds /debug/rpcz.
+	Monitor *Monitor
+
+	// Server feeds /debug/servicez and the service list of /debug/healthz.
+	Server *grpc.Server
+
+	// Health feeds /debug/healthz.
+	Health HealthChecker
+}
+
+// NewMux returns an http.ServeMux serving the debug pages under /debug/.
+func NewMux(opts Options) *http.ServeMux {
+	p := &pages{opts: opts, channelz: channelz.InProcessClient()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/", p.index)
+	mux.HandleFunc("/debug/rpcz", p.rpcz)
+	mux.HandleFunc("/debug/servicez", p.servicez)
+	mux.HandleFunc("/debug/healthz", p.healthz)
+	mux.HandleFunc("/debug/channelz", p.channelzPage)
+	return mux
+}
+
+type pages struct {
+	opts     Options
+	channelz channelzpb.ChannelzClient
+}
+
+func (p *pages) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/debug/" {
+		http.NotFound(w, r)
+		return
+	}
+	render(w, indexTmpl, nil)
+}
+
+func (p *pages) rpcz(w http.ResponseWriter, r *http.Request) {
+	if p.opts.Monitor == nil {
+		http.Error(w, "no RPC monitor installed", http.StatusNotFound)
+		return
+	}
+	render(w, rpczTmpl, map[string]interface{}{
+		"Now":       time.Now(),
+		"Active":    p.opts.Monitor.Active(),
+		"Summaries": p.opts.Monitor.Summaries(),
+		"Errors":    p.opts.Monitor.Errors(),
+	})
+}
+
+type serviceRow struct {
+	Name    string
+	Methods []grpc.MethodInfo
+}
+
+func (p *pages) services() []serviceRow {
+	if p.opts.Server == nil {
+		return nil
+	}
+	var rows []serviceRow
+	for name, info := range p.opts.Server.GetServiceInfo() {
+		methods := append([]grpc.MethodInfo(nil), info.Methods...)
+		sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+		rows = append(rows, serviceRow{Name: name, Methods: methods})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	return rows
+}
+
+func (p *pages) servicez(w http.ResponseWriter, r *http.Request) {
+	render(w, servicezTmpl, p.services())
+}
+
+type healthRow struct {
+	Service string
+	Status  string
+}
+
+func (p *pages) healthz(w http.ResponseWriter, r *http.Request) {
+	if p.opts.Health == nil {
+		http.Error(w, "no health checker installed", http.StatusNotFound)
+		return
+	}
+	names := []string{""}
+	for _, svc := range p.services() {
+		names = append(names, svc.Name)
+	}
+	rows := make([]healthRow, 0, len(names))
+	for _, name := range names {
+		resp, err := p.opts.Health.Check(r.Context(), &healthpb.HealthCheckRequest{Service: name})
+		row := healthRow{Service: name}
+		if err != nil {
+			row.Status = err.Error()
+		} else {
+			row.Status = resp.GetStatus().String()
+		}
+		if row.Service == "" {
+			row.Service = "(server)"
+		}
+		rows = append(rows, row)
+	}
+	render(w, healthzTmpl, rows)
+}
+
+func (p *pages) channelzPage(w http.ResponseWriter, r *http.Request) {
+	snap, err := channelz.Fetch(r.Context(), p.channelz)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := channelz.WriteTable(&buf, snap); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render(w, channelzTmpl, buf.String())
+}
+
+func render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
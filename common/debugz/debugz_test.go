@@ -0,0 +1,125 @@
+package debugz
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestPages(t *testing.T) {
+	monitor := NewMonitor()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("grpc.health.v1.Health", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(monitor.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(monitor.StreamServerInterceptor()))
+	healthpb.RegisterHealthServer(s, healthServer)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough://bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"}); err == nil {
+		t.Fatal("Check(missing) succeeded, want NotFound")
+	}
+
+	srv := httptest.NewServer(NewMux(Options{Monitor: monitor, Server: s, Health: healthServer}))
+	defer srv.Close()
+
+	for path, want := range map[string][]string{
+		"/debug/":         {"rpcz", "channelz"},
+		"/debug/rpcz":     {"/grpc.health.v1.Health/Check", "NotFound", "unknown service"},
+		"/debug/servicez": {"grpc.health.v1.Health", "Watch"},
+		"/debug/healthz":  {"(server)", "SERVING", "NOT_SERVING"},
+		"/debug/channelz": {"SERVERS", "SUBCHANNELS", "SOCKETS"},
+	} {
+		body := get(t, srv.URL+path)
+		for _, w := range want {
+			if !strings.Contains(body, w) {
+				t.Errorf("GET %s: body does not contain %q", path, w)
+			}
+		}
+	}
+
+	summaries := monitor.Summaries()
+	if len(summaries) != 1 || summaries[0].Count != 2 || summaries[0].Errors != 1 {
+		t.Errorf("Summaries() = %+v, want one method with 2 calls and 1 error", summaries)
+	}
+	if active := monitor.Active(); len(active) != 0 {
+		t.Errorf("Active() = %v, want none", active)
+	}
+}
+
+func TestErrorsNewestFirst(t *testing.T) {
+	m := NewMonitor()
+	for i := 0; i < recentErrors+5; i++ {
+		id := m.begin(context.Background(), "/svc/M", false)
+		m.end(id, context.Canceled)
+	}
+	errs := m.Errors()
+	if len(errs) != recentErrors {
+		t.Fatalf("len(Errors()) = %d, want %d", len(errs), recentErrors)
+	}
+	for i := 1; i < len(errs); i++ {
+		if errs[i].Time.After(errs[i-1].Time) {
+			t.Fatalf("Errors() not sorted newest first at %d", i)
+		}
+	}
+}
+
+func TestPanickingHandlerLeavesActive(t *testing.T) {
+	m := NewMonitor()
+	interceptor := m.UnaryServerInterceptor()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic did not reach the caller")
+			}
+		}()
+		interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/M"}, func(context.Context, interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	}()
+	if active := m.Active(); len(active) != 0 {
+		t.Errorf("Active() = %v after the handler panicked, want none", active)
+	}
+	if errs := m.Errors(); len(errs) != 1 || errs[0].Code != codes.Internal {
+		t.Errorf("Errors() = %v, want one Internal error", errs)
+	}
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s: %s", url, resp.Status, b)
+	}
+	return string(b)
+}
@@ -0,0 +1,233 @@
+package debugz
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+const (
+	// latencySamples is the number of recent latencies kept per method to
+	// compute percentiles.
+	latencySamples = 1024
+
+	// recentErrors is the number of failed RPCs kept for the errors table.
+	recentErrors = 100
+)
+
+// Monitor records in-flight RPCs, per-method latencies and recent errors
+// through its interceptors.
+type Monitor struct {
+	mu      sync.Mutex
+	nextID  uint64
+	active  map[uint64]*ActiveRPC
+	methods map[string]*methodStats
+	errors  []RPCError // ring buffer, errNext is the oldest entry once full
+	errNext int
+}
+
+// ActiveRPC describes an RPC that has not completed yet.
+type ActiveRPC struct {
+	Method    string
+	Peer      string
+	RequestID string
+	Streaming bool
+	Start     time.Time
+}
+
+// RPCError describes a failed RPC.
+type RPCError struct {
+	Time      time.Time
+	Method    string
+	Code      codes.Code
+	Message   string
+	RequestID string
+	Duration  time.Duration
+}
+
+// MethodSummary aggregates the completed RPCs of one method.
+type MethodSummary struct {
+	Method string
+	Count  uint64
+	Errors uint64
+	Mean   time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+type methodStats struct {
+	count   uint64
+	errors  uint64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration // ring buffer of the most recent latencies
+	next    int
+}
+
+// NewMonitor creates an empty Monitor.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		active:  make(map[uint64]*ActiveRPC),
+		methods: make(map[string]*methodStats),
+	}
+}
+
+// UnaryServerInterceptor tracks unary RPCs.
+func (m *Monitor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		id := m.begin(ctx, info.FullMethod, false)
+		defer m.finish(id, &err)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor tracks streaming RPCs.
+func (m *Monitor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		id := m.begin(ss.Context(), info.FullMethod, true)
+		defer m.finish(id, &err)
+		return handler(srv, ss)
+	}
+}
+
+func (m *Monitor) begin(ctx context.Context, method string, streaming bool) uint64 {
+	rpc := &ActiveRPC{Method: method, Streaming: streaming, Start: time.Now()}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		rpc.Peer = p.Addr.String()
+	}
+	rpc.RequestID, _ = requestid.FromContext(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	m.active[m.nextID] = rpc
+	return m.nextID
+}
+
+// finish ends the RPC id with the error *err or, when its handler panics, as
+// an Internal error before letting the panic through.
+func (m *Monitor) finish(id uint64, err *error) {
+	if p := recover(); p != nil {
+		m.end(id, status.Errorf(codes.Internal, "panic: %v", p))
+		panic(p)
+	}
+	m.end(id, *err)
+}
+
+func (m *Monitor) end(id uint64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rpc := m.active[id]
+	delete(m.active, id)
+	elapsed := time.Since(rpc.Start)
+
+	st := m.methods[rpc.Method]
+	if st == nil {
+		st = &methodStats{samples: make([]time.Duration, 0, latencySamples)}
+		m.methods[rpc.Method] = st
+	}
+	st.count++
+	st.total += elapsed
+	if elapsed > st.max {
+		st.max = elapsed
+	}
+	if len(st.samples) < latencySamples {
+		st.samples = append(st.samples, elapsed)
+	} else {
+		st.samples[st.next] = elapsed
+		st.next = (st.next + 1) % latencySamples
+	}
+	if err == nil {
+		return
+	}
+
+	st.errors++
+	s := status.Convert(err)
+	e := RPCError{
+		Time:      time.Now(),
+		Method:    rpc.Method,
+		Code:      s.Code(),
+		Message:   s.Message(),
+		RequestID: rpc.RequestID,
+		Duration:  elapsed,
+	}
+	if len(m.errors) < recentErrors {
+		m.errors = append(m.errors, e)
+	} else {
+		m.errors[m.errNext] = e
+		m.errNext = (m.errNext + 1) % recentErrors
+	}
+}
+
+// Active returns the in-flight RPCs, oldest first.
+func (m *Monitor) Active() []ActiveRPC {
+	m.mu.Lock()
+	out := make([]ActiveRPC, 0, len(m.active))
+	for _, rpc := range m.active {
+		out = append(out, *rpc)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// Summaries returns the latency summary of every method seen so far, sorted
+// by method name.
+func (m *Monitor) Summaries() []MethodSummary {
+	m.mu.Lock()
+	out := make([]MethodSummary, 0, len(m.methods))
+	samples := make(map[string][]time.Duration, len(m.methods))
+	for name, st := range m.methods {
+		out = append(out, MethodSummary{
+			Method: name,
+			Count:  st.count,
+			Errors: st.errors,
+			Mean:   st.total / time.Duration(st.count),
+			Max:    st.max,
+		})
+		samples[name] = append([]time.Duration(nil), st.samples...)
+	}
+	m.mu.Unlock()
+
+	for i := range out {
+		s := samples[out[i].Method]
+		sort.Slice(s, func(a, b int) bool { return s[a] < s[b] })
+		out[i].P50 = percentile(s, 0.50)
+		out[i].P90 = percentile(s, 0.90)
+		out[i].P99 = percentile(s, 0.99)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Method < out[j].Method })
+	return out
+}
+
+// Errors returns the most recent failed RPCs, newest first.
+func (m *Monitor) Errors() []RPCError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]RPCError, 0, len(m.errors))
+	for i := 0; i < len(m.errors); i++ {
+		// Walk backwards from the newest entry.
+		idx := (m.errNext - 1 - i + 2*len(m.errors)) % len(m.errors)
+		out = append(out, m.errors[idx])
+	}
+	return out
+}
+
+// percentile returns the p-th percentile of the sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
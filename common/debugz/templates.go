@@ -0,0 +1,70 @@
+package debugz
+
+import (
+	"html/template"
+	"time"
+)
+
+const layout = `{{define "header"}}<!DOCTYPE html>
+<html><head><title>{{.}}</title>
+<style>
+body { font-family: monospace; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+th { background: #eee; }
+</style></head><body>
+<p><a href="/debug/">index</a> | <a href="/debug/rpcz">rpcz</a> | <a href="/debug/servicez">servicez</a> | <a href="/debug/healthz">healthz</a> | <a href="/debug/channelz">channelz</a></p>
+<h1>{{.}}</h1>{{end}}
+{{define "footer"}}</body></html>{{end}}`
+
+var funcs = template.FuncMap{
+	"since": func(t time.Time) time.Duration { return time.Since(t).Round(time.Millisecond) },
+	"ms":    func(d time.Duration) string { return d.Round(10 * time.Microsecond).String() },
+	"clock": func(t time.Time) string { return t.Format("15:04:05.000") },
+}
+
+func page(body string) *template.Template {
+	return template.Must(template.Must(template.New("layout").Funcs(funcs).Parse(layout)).New("page").Parse(body))
+}
+
+var indexTmpl = page(`{{template "header" "Debug pages"}}
+<ul>
+<li><a href="/debug/rpcz">rpcz</a>: active RPCs, per-method latency summaries and recent errors</li>
+<li><a href="/debug/servicez">servicez</a>: registered services</li>
+<li><a href="/debug/healthz">healthz</a>: current health status</li>
+<li><a href="/debug/channelz">channelz</a>: channels, subchannels, sockets and call counts</li>
+</ul>
+{{template "footer"}}`)
+
+var rpczTmpl = page(`{{template "header" "RPCs"}}
+<h2>Active RPCs ({{len .Active}})</h2>
+<table><tr><th>Method</th><th>Type</th><th>Peer</th><th>Request ID</th><th>Started</th><th>Elapsed</th></tr>
+{{range .Active}}<tr><td>{{.Method}}</td><td>{{if .Streaming}}stream{{else}}unary{{end}}</td><td>{{.Peer}}</td><td>{{.RequestID}}</td><td>{{clock .Start}}</td><td>{{since .Start}}</td></tr>
+{{end}}</table>
+<h2>Latency by method</h2>
+<table><tr><th>Method</th><th>Count</th><th>Errors</th><th>Mean</th><th>P50</th><th>P90</th><th>P99</th><th>Max</th></tr>
+{{range .Summaries}}<tr><td>{{.Method}}</td><td>{{.Count}}</td><td>{{.Errors}}</td><td>{{ms .Mean}}</td><td>{{ms .P50}}</td><td>{{ms .P90}}</td><td>{{ms .P99}}</td><td>{{ms .Max}}</td></tr>
+{{end}}</table>
+<h2>Recent errors</h2>
+<table><tr><th>Time</th><th>Method</th><th>Code</th><th>Message</th><th>Request ID</th><th>Duration</th></tr>
+{{range .Errors}}<tr><td>{{clock .Time}}</td><td>{{.Method}}</td><td>{{.Code}}</td><td>{{.Message}}</td><td>{{.RequestID}}</td><td>{{ms .Duration}}</td></tr>
+{{end}}</table>
+{{template "footer"}}`)
+
+var servicezTmpl = page(`{{template "header" "Services"}}
+{{range .}}<h2>{{.Name}}</h2>
+<table><tr><th>Method</th><th>Client streaming</th><th>Server streaming</th></tr>
+{{range .Methods}}<tr><td>{{.Name}}</td><td>{{.IsClientStream}}</td><td>{{.IsServerStream}}</td></tr>
+{{end}}</table>
+{{else}}<p>No gRPC server attached.</p>{{end}}
+{{template "footer"}}`)
+
+var healthzTmpl = page(`{{template "header" "Health"}}
+<table><tr><th>Service</th><th>Status</th></tr>
+{{range .}}<tr><td>{{.Service}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{template "footer"}}`)
+
+var channelzTmpl = page(`{{template "header" "Channelz"}}
+<pre>{{.}}</pre>
+{{template "footer"}}`)
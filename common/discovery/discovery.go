@@ -0,0 +1,100 @@
+// Package discovery provides gRPC name resolvers reading backend endpoints
+// from sources that change at run time, and attaches per-endpoint attributes
+// (weight and zone) that balancers can read with Weight and Zone.
+//
+// Importing the package registers two schemes:
+//
+//	file:///etc/app/endpoints.yaml          watched JSON or YAML file
+//	file:endpoints.json                     same, path relative to the working directory
+//	dnssrv:///_grpc._tcp.echo.example.com   DNS SRV records, system resolver
+//	dnssrv://127.0.0.1:8600/_grpc._tcp.echo.service.consul?refresh=5s
+//	                                        SRV records from a given DNS server
+//
+// A file lists the endpoints of one target:
+//
+//	endpoints:
+//	  - address: localhost:50051
+//	    weight: 3
+//	    zone: zone-a
+//	  - address: localhost:50052
+//	    zone: zone-b
+package discovery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Endpoint is one backend address with its balancing attributes.
+type Endpoint struct {
+	Address string `json:"address" yaml:"address"`
+	// Weight is the relative share of traffic the endpoint should receive.
+	// Zero means 1.
+	Weight uint32 `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Zone is the locality of the endpoint, e.g. an availability zone.
+	Zone string `json:"zone,omitempty" yaml:"zone,omitempty"`
+}
+
+type weightKey struct{}
+type zoneKey struct{}
+
+// Weight returns the weight stored in attrs, the BalancerAttributes of an
+// address or the Attributes of an endpoint, or 1 when there is none.
+func Weight(attrs *attributes.Attributes) uint32 {
+	if w, ok := attrs.Value(weightKey{}).(uint32); ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Zone returns the zone stored in attrs, or "" when there is none.
+func Zone(attrs *attributes.Attributes) string {
+	z, _ := attrs.Value(zoneKey{}).(string)
+	return z
+}
+
+// WithAttributes returns attrs with the weight and zone of e added.
+func WithAttributes(attrs *attributes.Attributes, e Endpoint) *attributes.Attributes {
+	w := e.Weight
+	if w == 0 {
+		w = 1
+	}
+	if attrs == nil {
+		attrs = attributes.New(weightKey{}, w)
+	} else {
+		attrs = attrs.WithValue(weightKey{}, w)
+	}
+	if e.Zone != "" {
+		attrs = attrs.WithValue(zoneKey{}, e.Zone)
+	}
+	return attrs
+}
+
+// State converts endpoints to a resolver state. The attributes are set both on
+// the endpoints and on the balancer attributes of their address, so they reach
+// endpoint-based and address-based balancers alike.
+func State(endpoints []Endpoint) resolver.State {
+	var s resolver.State
+	for _, e := range endpoints {
+		attrs := WithAttributes(nil, e)
+		addr := resolver.Address{Addr: e.Address, BalancerAttributes: attrs}
+		s.Addresses = append(s.Addresses, addr)
+		s.Endpoints = append(s.Endpoints, resolver.Endpoint{Addresses: []resolver.Address{addr}, Attributes: attrs})
+	}
+	return s
+}
+
+// key returns a canonical form of endpoints, used to skip updates that do not
+// change anything.
+func key(endpoints []Endpoint) string {
+	parts := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		parts[i] = fmt.Sprintf("%s/%d/%s", e.Address, e.Weight, e.Zone)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
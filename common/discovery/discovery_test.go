@@ -0,0 +1,237 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// fakeClientConn records the states and errors pushed by a resolver.
+type fakeClientConn struct {
+	resolver.ClientConn
+
+	states chan resolver.State
+	errs   chan error
+	// reject is how many updates UpdateState still rejects.
+	reject int
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{states: make(chan resolver.State, 10), errs: make(chan error, 10)}
+}
+
+func (cc *fakeClientConn) UpdateState(s resolver.State) error {
+	cc.states <- s
+	if cc.reject > 0 {
+		cc.reject--
+		return balancer.ErrBadResolverState
+	}
+	return nil
+}
+
+func (cc *fakeClientConn) ReportError(err error) { cc.errs <- err }
+
+func (cc *fakeClientConn) ParseServiceConfig(string) *serviceconfig.ParseResult { return nil }
+
+func (cc *fakeClientConn) nextState(t *testing.T) resolver.State {
+	t.Helper()
+	select {
+	case s := <-cc.states:
+		return s
+	case err := <-cc.errs:
+		t.Fatalf("resolver reported error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a resolver update")
+	}
+	return resolver.State{}
+}
+
+type summary struct {
+	Addr   string
+	Weight uint32
+	Zone   string
+}
+
+func summarize(s resolver.State) []summary {
+	var out []summary
+	for i, a := range s.Addresses {
+		out = append(out, summary{a.Addr, Weight(a.BalancerAttributes), Zone(s.Endpoints[i].Attributes)})
+	}
+	return out
+}
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "endpoints.yaml")
+	write := func(content string) {
+		// Replace the file atomically, as config management tools do.
+		tmp := filepath.Join(dir, "endpoints.tmp")
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`
+endpoints:
+  - address: localhost:50051
+    weight: 3
+    zone: zone-a
+  - address: localhost:50052
+`)
+
+	cc := newFakeClientConn()
+	r, err := fileBuilder{}.Build(resolver.Target{URL: url.URL{Scheme: "file", Path: path}}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer r.Close()
+
+	want := []summary{{"localhost:50051", 3, "zone-a"}, {"localhost:50052", 1, ""}}
+	if got := summarize(cc.nextState(t)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("initial state = %v, want %v", got, want)
+	}
+
+	write(`
+endpoints:
+  - address: localhost:50052
+    weight: 2
+    zone: zone-b
+`)
+	want = []summary{{"localhost:50052", 2, "zone-b"}}
+	if got := summarize(cc.nextState(t)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("state after change = %v, want %v", got, want)
+	}
+
+	// An invalid file is reported and the last good state is kept.
+	write("endpoints: [")
+	select {
+	case <-cc.errs:
+	case s := <-cc.states:
+		t.Fatalf("unexpected state %v for an invalid file", summarize(s))
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalid file was not reported")
+	}
+}
+
+func TestReadEndpointsFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	if err := os.WriteFile(path, []byte(`{"endpoints":[{"address":"10.0.0.1:50051","weight":5,"zone":"z1"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadEndpointsFile(path)
+	if err != nil {
+		t.Fatalf("ReadEndpointsFile: %v", err)
+	}
+	if want := []Endpoint{{"10.0.0.1:50051", 5, "z1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadEndpointsFile = %v, want %v", got, want)
+	}
+}
+
+type fakeLookup struct {
+	mu    sync.Mutex
+	srv   []*net.SRV
+	hosts map[string][]string
+	txt   map[string][]string
+	// gate, when set, holds SRV lookups until it is closed.
+	gate chan struct{}
+}
+
+func (f *fakeLookup) setSRV(srv []*net.SRV) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.srv = srv
+}
+
+func (f *fakeLookup) LookupSRV(context.Context, string, string, string) (string, []*net.SRV, error) {
+	if f.gate != nil {
+		<-f.gate
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return "", f.srv, nil
+}
+
+func (f *fakeLookup) LookupHost(_ context.Context, host string) ([]string, error) {
+	if ips, ok := f.hosts[host]; ok {
+		return ips, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (f *fakeLookup) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return f.txt[name], nil
+}
+
+func TestSRVResolver(t *testing.T) {
+	l := &fakeLookup{
+		srv: []*net.SRV{
+			{Target: "a.example.com.", Port: 50051, Priority: 10, Weight: 60},
+			{Target: "b.example.com.", Port: 50052, Priority: 10, Weight: 40},
+			{Target: "backup.example.com.", Port: 50053, Priority: 20, Weight: 100},
+		},
+		hosts: map[string][]string{
+			"a.example.com":      {"10.0.0.1"},
+			"b.example.com":      {"10.0.0.2", "10.0.0.3"},
+			"backup.example.com": {"10.0.0.9"},
+		},
+		txt: map[string][]string{"a.example.com": {"v=1", "zone=zone-a"}},
+	}
+	cc := newFakeClientConn()
+	r := newSRVResolver("_grpc._tcp.echo.example.com", time.Hour, cc, l)
+	r.start()
+	defer r.Close()
+
+	want := []summary{
+		{"10.0.0.1:50051", 60, "zone-a"},
+		{"10.0.0.2:50052", 40, ""},
+		{"10.0.0.3:50052", 40, ""},
+	}
+	if got := summarize(cc.nextState(t)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("state = %v, want %v", got, want)
+	}
+
+	// ResolveNow picks up changes.
+	l.setSRV(l.srv[2:])
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	if got, want := summarize(cc.nextState(t)), []summary{{"10.0.0.9:50053", 100, ""}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("state after change = %v, want %v", got, want)
+	}
+}
+
+func TestSRVResolverRetriesRejectedUpdates(t *testing.T) {
+	l := &fakeLookup{
+		srv:   []*net.SRV{{Target: "a.example.com.", Port: 50051, Priority: 10, Weight: 1}},
+		hosts: map[string][]string{"a.example.com": {"10.0.0.1"}},
+		gate:  make(chan struct{}),
+	}
+	cc := newFakeClientConn()
+	cc.reject = 1
+	r := newSRVResolver("_grpc._tcp.echo.example.com", time.Hour, cc, l)
+	// The first lookup runs in the background: start does not wait for it.
+	r.start()
+	defer r.Close()
+	close(l.gate)
+
+	want := []summary{{"10.0.0.1:50051", 1, ""}}
+	if got := summarize(cc.nextState(t)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("state = %v, want %v", got, want)
+	}
+	// The channel rejected the endpoints: the same ones are pushed again.
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	if got := summarize(cc.nextState(t)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("state after ResolveNow = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// DefaultSRVRefresh is how often SRV records are looked up again when the
+// target does not set ?refresh=.
+const DefaultSRVRefresh = 30 * time.Second
+
+func init() {
+	resolver.Register(srvBuilder{})
+}
+
+type srvBuilder struct{}
+
+func (srvBuilder) Scheme() string { return "dnssrv" }
+
+func (srvBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	name := strings.TrimPrefix(target.URL.Path, "/")
+	if name == "" {
+		return nil, fmt.Errorf("discovery: missing SRV name in target %q", target.URL.String())
+	}
+	refresh := DefaultSRVRefresh
+	if v := target.URL.Query().Get("refresh"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("discovery: invalid refresh %q in target %q", v, target.URL.String())
+		}
+		refresh = d
+	}
+
+	res := net.DefaultResolver
+	if server := target.URL.Host; server != "" {
+		// Send every query to the given DNS server, e.g. a local Consul agent.
+		res = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	r := newSRVResolver(name, refresh, cc, res)
+	r.start()
+	return r, nil
+}
+
+// lookup is the subset of net.Resolver used by srvResolver.
+type lookup interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// srvResolver resolves a DNS SRV name on an interval and on ResolveNow. Only
+// the records with the lowest priority are used, following SRV semantics;
+// their weight becomes the endpoint weight and a "zone=<name>" TXT record on
+// the target host, if any, its zone.
+type srvResolver struct {
+	name       string
+	refresh    time.Duration
+	cc         resolver.ClientConn
+	lookup     lookup
+	resolveNow chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	last string
+}
+
+func newSRVResolver(name string, refresh time.Duration, cc resolver.ClientConn, l lookup) *srvResolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &srvResolver{
+		name:       name,
+		refresh:    refresh,
+		cc:         cc,
+		lookup:     l,
+		resolveNow: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// start resolves the name in the background, first at once, so building
+// the resolver does not wait for DNS.
+func (r *srvResolver) start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.update()
+		ticker := time.NewTicker(r.refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+			case <-r.resolveNow:
+			}
+			r.update()
+		}
+	}()
+}
+
+func (r *srvResolver) update() {
+	endpoints, err := r.resolve()
+	if err != nil {
+		r.cc.ReportError(err)
+		return
+	}
+	k := key(endpoints)
+	if k == r.last {
+		return
+	}
+	// A rejected update is pushed again on the next ResolveNow, which the
+	// channel calls to recover.
+	if err := r.cc.UpdateState(State(endpoints)); err != nil {
+		log.Printf("discovery: endpoints of %s rejected: %v", r.name, err)
+		return
+	}
+	r.last = k
+}
+
+func (r *srvResolver) resolve() ([]Endpoint, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, 10*time.Second)
+	defer cancel()
+
+	_, records, err := r.lookup.LookupSRV(ctx, "", "", r.name)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: SRV lookup of %s: %w", r.name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("discovery: no SRV records for %s", r.name)
+	}
+	lowest := records[0].Priority
+	for _, rec := range records {
+		if rec.Priority < lowest {
+			lowest = rec.Priority
+		}
+	}
+
+	var endpoints []Endpoint
+	for _, rec := range records {
+		if rec.Priority != lowest {
+			continue
+		}
+		host := strings.TrimSuffix(rec.Target, ".")
+		ips, err := r.lookup.LookupHost(ctx, host)
+		if err != nil {
+			log.Printf("discovery: resolving SRV target %s: %v", host, err)
+			continue
+		}
+		zone := r.zone(ctx, host)
+		for _, ip := range ips {
+			endpoints = append(endpoints, Endpoint{
+				Address: net.JoinHostPort(ip, strconv.Itoa(int(rec.Port))),
+				Weight:  uint32(rec.Weight),
+				Zone:    zone,
+			})
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("discovery: no SRV target of %s could be resolved", r.name)
+	}
+	return endpoints, nil
+}
+
+func (r *srvResolver) zone(ctx context.Context, host string) string {
+	txts, err := r.lookup.LookupTXT(ctx, host)
+	if err != nil {
+		return ""
+	}
+	for _, txt := range txts {
+		if z, ok := strings.CutPrefix(txt, "zone="); ok {
+			return z
+		}
+	}
+	return ""
+}
+
+func (r *srvResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *srvResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
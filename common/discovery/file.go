@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	resolver.Register(fileBuilder{})
+}
+
+type fileBuilder struct{}
+
+func (fileBuilder) Scheme() string { return "file" }
+
+func (fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	path := target.URL.Path
+	if path == "" {
+		path = target.URL.Opaque
+	}
+	if path == "" {
+		return nil, fmt.Errorf("discovery: missing file path in target %q", target.URL.String())
+	}
+	path = filepath.Clean(path)
+
+	// Watch the directory rather than the file, so the resolver follows
+	// editors and config management tools that replace the file.
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	r := &fileResolver{
+		path:       path,
+		cc:         cc,
+		watcher:    watcher,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	r.update()
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+type fileResolver struct {
+	path       string
+	cc         resolver.ClientConn
+	watcher    *fsnotify.Watcher
+	resolveNow chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+
+	last string // key of the endpoints last pushed
+}
+
+func (r *fileResolver) run() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.resolveNow:
+			r.update()
+		case ev, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) == r.path {
+				r.update()
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("discovery: watching %s: %v", r.path, err)
+		}
+	}
+}
+
+// update reads the file and pushes its endpoints when they changed. A file
+// that cannot be read or parsed is reported to the channel, which keeps using
+// the last good endpoints.
+func (r *fileResolver) update() {
+	endpoints, err := ReadEndpointsFile(r.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && r.last != "" {
+			// The file is being replaced; wait for it to reappear.
+			return
+		}
+		r.cc.ReportError(err)
+		return
+	}
+	k := key(endpoints)
+	if k == r.last {
+		return
+	}
+	// Not remembered, so the next ResolveNow tries them again.
+	if err := r.cc.UpdateState(State(endpoints)); err != nil {
+		log.Printf("discovery: endpoints of %s rejected: %v", r.path, err)
+		return
+	}
+	r.last = k
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	close(r.done)
+	r.watcher.Close()
+	r.wg.Wait()
+}
+
+type endpointsFile struct {
+	Endpoints []Endpoint `json:"endpoints" yaml:"endpoints"`
+}
+
+// ReadEndpointsFile reads a JSON or YAML endpoints file; files ending in
+// .yaml or .yml are parsed as YAML.
+func ReadEndpointsFile(path string) ([]Endpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f endpointsFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &f)
+	default:
+		err = json.Unmarshal(b, &f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("discovery: parsing %s: %w", path, err)
+	}
+	if len(f.Endpoints) == 0 {
+		return nil, fmt.Errorf("discovery: %s lists no endpoints", path)
+	}
+	for i, e := range f.Endpoints {
+		if e.Address == "" {
+			return nil, fmt.Errorf("discovery: %s: endpoint %d has no address", path, i)
+		}
+	}
+	return f.Endpoints, nil
+}
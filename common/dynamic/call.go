@@ -0,0 +1,144 @@
+package dynamic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// FullMethod returns the "/package.Service/Method" path of md.
+func FullMethod(md protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+}
+
+// Call invokes md on conn. Requests are taken from next until it returns
+// io.EOF and every response is passed to emit, so one function serves unary,
+// client, server and bidirectional streaming methods. A method taking a
+// single request gets an empty message when next yields none.
+func Call(ctx context.Context, conn grpc.ClientConnInterface, md protoreflect.MethodDescriptor,
+	next func() (proto.Message, error), emit func(proto.Message) error, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	desc := &grpc.StreamDesc{ServerStreams: md.IsStreamingServer(), ClientStreams: md.IsStreamingClient()}
+	if !desc.ClientStreams {
+		req, err := next()
+		if errors.Is(err, io.EOF) {
+			req, err = dynamicpb.NewMessage(md.Input()), nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := next(); !errors.Is(err, io.EOF) {
+			if err == nil {
+				err = status.Errorf(codes.InvalidArgument, "%s takes a single request", md.FullName())
+			}
+			return err
+		}
+		next = single(req)
+	}
+
+	stream, err := conn.NewStream(ctx, desc, FullMethod(md), opts...)
+	if err != nil {
+		return err
+	}
+	// Requests are sent while responses are read so that bidirectional
+	// methods can answer each request as it arrives. A request that cannot
+	// be produced cancels the call and is reported instead of the status.
+	sendErr := make(chan error, 1)
+	go func() {
+		err := send(stream, next)
+		sendErr <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+
+	for {
+		resp := dynamicpb.NewMessage(md.Output())
+		err := stream.RecvMsg(resp)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			select {
+			case serr := <-sendErr:
+				if serr != nil {
+					return serr
+				}
+			default:
+			}
+			return err
+		}
+		if err := emit(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func send(stream grpc.ClientStream, next func() (proto.Message, error)) error {
+	for {
+		req, err := next()
+		if errors.Is(err, io.EOF) {
+			return stream.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.SendMsg(req); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The stream ended; RecvMsg reports why.
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func single(m proto.Message) func() (proto.Message, error) {
+	return func() (proto.Message, error) {
+		if m == nil {
+			return nil, io.EOF
+		}
+		defer func() { m = nil }()
+		return m, nil
+	}
+}
+
+// JSONRequests returns a request source for Call that reads one JSON message
+// of type desc per line of r, skipping blank lines. Lines are read as they
+// arrive, so r may be a terminal or a pipe feeding a streaming call.
+func JSONRequests(r io.Reader, desc protoreflect.MessageDescriptor, opts protojson.UnmarshalOptions) func() (proto.Message, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	return func() (proto.Message, error) {
+		for sc.Scan() {
+			line++
+			b := bytes.TrimSpace(sc.Bytes())
+			if len(b) == 0 {
+				continue
+			}
+			m := dynamicpb.NewMessage(desc)
+			if err := opts.Unmarshal(b, m); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "line %d: invalid %s: %v", line, desc.FullName(), err)
+			}
+			return m, nil
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
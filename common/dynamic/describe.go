@@ -0,0 +1,123 @@
+package dynamic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Describe writes d in proto syntax, preceded by a comment naming it and the
+// file defining it. Services are written with their methods, messages with
+// their fields, nested types and oneofs, enums with their values.
+func Describe(w io.Writer, d protoreflect.Descriptor) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s in %s\n", d.FullName(), d.ParentFile().Path())
+	switch d := d.(type) {
+	case protoreflect.ServiceDescriptor:
+		describeService(&b, d)
+	case protoreflect.MethodDescriptor:
+		describeMethod(&b, "", d)
+	case protoreflect.MessageDescriptor:
+		describeMessage(&b, "", d)
+	case protoreflect.EnumDescriptor:
+		describeEnum(&b, "", d)
+	case protoreflect.FieldDescriptor:
+		describeField(&b, "", d)
+	case protoreflect.EnumValueDescriptor:
+		fmt.Fprintf(&b, "%s = %d;\n", d.Name(), d.Number())
+	default:
+		return fmt.Errorf("cannot describe %s", d.FullName())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func describeService(b *strings.Builder, sd protoreflect.ServiceDescriptor) {
+	fmt.Fprintf(b, "service %s {\n", sd.Name())
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		describeMethod(b, "  ", methods.Get(i))
+	}
+	b.WriteString("}\n")
+}
+
+func describeMethod(b *strings.Builder, indent string, md protoreflect.MethodDescriptor) {
+	stream := func(streaming bool) string {
+		if streaming {
+			return "stream "
+		}
+		return ""
+	}
+	fmt.Fprintf(b, "%srpc %s(%s%s) returns (%s%s);\n", indent, md.Name(),
+		stream(md.IsStreamingClient()), md.Input().FullName(),
+		stream(md.IsStreamingServer()), md.Output().FullName())
+}
+
+func describeMessage(b *strings.Builder, indent string, m protoreflect.MessageDescriptor) {
+	fmt.Fprintf(b, "%smessage %s {\n", indent, m.Name())
+	inner := indent + "  "
+	written := make(map[protoreflect.OneofDescriptor]bool)
+	fields := m.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		o := f.ContainingOneof()
+		if o == nil || o.IsSynthetic() {
+			describeField(b, inner, f)
+			continue
+		}
+		if written[o] {
+			continue
+		}
+		written[o] = true
+		fmt.Fprintf(b, "%soneof %s {\n", inner, o.Name())
+		for j := 0; j < o.Fields().Len(); j++ {
+			describeField(b, inner+"  ", o.Fields().Get(j))
+		}
+		fmt.Fprintf(b, "%s}\n", inner)
+	}
+	for i := 0; i < m.Messages().Len(); i++ {
+		if nested := m.Messages().Get(i); !nested.IsMapEntry() {
+			describeMessage(b, inner, nested)
+		}
+	}
+	for i := 0; i < m.Enums().Len(); i++ {
+		describeEnum(b, inner, m.Enums().Get(i))
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func describeField(b *strings.Builder, indent string, f protoreflect.FieldDescriptor) {
+	var label string
+	switch {
+	case f.IsMap():
+		fmt.Fprintf(b, "%smap<%s, %s> %s = %d;\n", indent, typeName(f.MapKey()), typeName(f.MapValue()), f.Name(), f.Number())
+		return
+	case f.IsList():
+		label = "repeated "
+	case f.HasOptionalKeyword():
+		label = "optional "
+	}
+	fmt.Fprintf(b, "%s%s%s %s = %d;\n", indent, label, typeName(f), f.Name(), f.Number())
+}
+
+func describeEnum(b *strings.Builder, indent string, e protoreflect.EnumDescriptor) {
+	fmt.Fprintf(b, "%senum %s {\n", indent, e.Name())
+	for i := 0; i < e.Values().Len(); i++ {
+		v := e.Values().Get(i)
+		fmt.Fprintf(b, "%s  %s = %d;\n", indent, v.Name(), v.Number())
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func typeName(f protoreflect.FieldDescriptor) string {
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(f.Enum().FullName())
+	default:
+		return f.Kind().String()
+	}
+}
@@ -0,0 +1,316 @@
+package dynamic
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	v1alphagrpc "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// testServer implements one method of each kind of grpc.testing.TestService.
+type testServer struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testServer) UnaryCall(ctx context.Context, in *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	if s := in.GetResponseStatus(); s != nil {
+		return nil, status.Error(codes.Code(s.GetCode()), s.GetMessage())
+	}
+	resp := &testpb.SimpleResponse{Payload: in.GetPayload()}
+	if in.GetFillUsername() {
+		md, _ := metadata.FromIncomingContext(ctx)
+		resp.Username = strings.Join(md.Get("authorization"), ",")
+	}
+	return resp, nil
+}
+
+func (testServer) StreamingOutputCall(in *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	for _, p := range in.GetResponseParameters() {
+		body := bytes.Repeat([]byte("x"), int(p.GetSize()))
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: body}}); err != nil {
+			return err
+		}
+	}
+	if s := in.GetResponseStatus(); s != nil {
+		return status.Error(codes.Code(s.GetCode()), s.GetMessage())
+	}
+	return nil
+}
+
+func (testServer) StreamingInputCall(stream testpb.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(in.GetPayload().GetBody()))
+	}
+}
+
+func (testServer) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: in.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+func dial(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	testpb.RegisterTestServiceServer(s, testServer{})
+	register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestResolver(t *testing.T) {
+	r := NewResolver(dial(t, func(s *grpc.Server) { reflection.Register(s) }))
+	ctx := context.Background()
+
+	services, err := r.ListServices(ctx)
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if got := strings.Join(services, ","); !strings.Contains(got, "grpc.testing.TestService") ||
+		!strings.Contains(got, "grpc.reflection.v1.ServerReflection") {
+		t.Errorf("services = %v", services)
+	}
+
+	for _, tc := range []struct {
+		name                  string
+		client, server        bool
+		wantInput, wantOutput string
+	}{
+		{"grpc.testing.TestService/UnaryCall", false, false, "grpc.testing.SimpleRequest", "grpc.testing.SimpleResponse"},
+		{"/grpc.testing.TestService/StreamingOutputCall", false, true, "grpc.testing.StreamingOutputCallRequest", "grpc.testing.StreamingOutputCallResponse"},
+		{"grpc.testing.TestService.StreamingInputCall", true, false, "grpc.testing.StreamingInputCallRequest", "grpc.testing.StreamingInputCallResponse"},
+		{"grpc.testing.TestService.FullDuplexCall", true, true, "grpc.testing.StreamingOutputCallRequest", "grpc.testing.StreamingOutputCallResponse"},
+	} {
+		md, err := r.FindMethod(ctx, tc.name)
+		if err != nil {
+			t.Errorf("FindMethod(%q): %v", tc.name, err)
+			continue
+		}
+		if md.IsStreamingClient() != tc.client || md.IsStreamingServer() != tc.server ||
+			string(md.Input().FullName()) != tc.wantInput || string(md.Output().FullName()) != tc.wantOutput {
+			t.Errorf("FindMethod(%q) = %v", tc.name, md)
+		}
+	}
+
+	if _, err := r.FindSymbol(ctx, "grpc.testing.Payload.body"); err != nil {
+		t.Errorf("FindSymbol(field): %v", err)
+	}
+	if _, err := r.FindMethod(ctx, "grpc.testing.TestService/Missing"); status.Code(err) != codes.NotFound {
+		t.Errorf("FindMethod(missing) = %v, want NOT_FOUND", err)
+	}
+	if _, err := r.FindMethod(ctx, "grpc.testing.SimpleRequest.payload"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("FindMethod(field) = %v, want INVALID_ARGUMENT", err)
+	}
+}
+
+func TestResolverConcurrentLoads(t *testing.T) {
+	// The files the server sends for grpc.testing.TestService.
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		protos[fd.Path()] = protodesc.ToFileDescriptorProto(fd)
+		for i := 0; i < fd.Imports().Len(); i++ {
+			add(fd.Imports().Get(i).FileDescriptor)
+		}
+	}
+	add(testpb.File_grpc_testing_test_proto)
+
+	for i := 0; i < 50; i++ {
+		r := NewResolver(nil)
+		start := make(chan struct{})
+		errs := make(chan error, 16)
+		var wg sync.WaitGroup
+		for j := 0; j < cap(errs); j++ {
+			pending := make(map[string]*descriptorpb.FileDescriptorProto)
+			for k, v := range protos {
+				pending[k] = v
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if _, err := r.register(context.Background(), "grpc/testing/test.proto", pending); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("concurrent register: %v", err)
+		}
+	}
+}
+
+func TestResolverV1Alpha(t *testing.T) {
+	conn := dial(t, func(s *grpc.Server) {
+		v1alphagrpc.RegisterServerReflectionServer(s, reflection.NewServer(reflection.ServerOptions{Services: s}))
+	})
+	r := NewResolver(conn)
+	services, err := r.ListServices(context.Background())
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if !strings.Contains(strings.Join(services, ","), "grpc.testing.TestService") {
+		t.Errorf("services = %v", services)
+	}
+	if _, err := r.FindService(context.Background(), "grpc.testing.TestService"); err != nil {
+		t.Errorf("FindService: %v", err)
+	}
+}
+
+// call invokes method with the JSON lines of input and returns the JSON
+// responses, one per line.
+func call(t *testing.T, conn *grpc.ClientConn, r *Resolver, method, input string) (string, error) {
+	t.Helper()
+	md, err := r.FindMethod(context.Background(), method)
+	if err != nil {
+		t.Fatalf("FindMethod(%q): %v", method, err)
+	}
+	var out strings.Builder
+	err = Call(context.Background(), conn, md,
+		JSONRequests(strings.NewReader(input), md.Input(), protojson.UnmarshalOptions{}),
+		func(m proto.Message) error {
+			b, err := protojson.MarshalOptions{Resolver: r.Types()}.Marshal(m)
+			if err != nil {
+				return err
+			}
+			// protojson output spacing is not stable; compare compacted.
+			out.WriteString(strings.ReplaceAll(string(b), " ", "") + "\n")
+			return nil
+		})
+	return out.String(), err
+}
+
+func TestCall(t *testing.T) {
+	conn := dial(t, func(s *grpc.Server) { reflection.Register(s) })
+	r := NewResolver(conn)
+
+	for _, tc := range []struct {
+		method, input, want string
+	}{
+		{"grpc.testing.TestService/UnaryCall", `{"payload":{"body":"aGk="}}`, `{"payload":{"body":"aGk="}}` + "\n"},
+		{"grpc.testing.TestService/UnaryCall", "", "{}\n"},
+		{"grpc.testing.TestService/StreamingOutputCall", `{"responseParameters":[{"size":1},{"size":2}]}`,
+			`{"payload":{"body":"eA=="}}` + "\n" + `{"payload":{"body":"eHg="}}` + "\n"},
+		{"grpc.testing.TestService/StreamingInputCall", "{\"payload\":{\"body\":\"aGk=\"}}\n\n{\"payload\":{\"body\":\"eHh4\"}}\n",
+			`{"aggregatedPayloadSize":5}` + "\n"},
+		{"grpc.testing.TestService/FullDuplexCall", "{\"payload\":{\"body\":\"YQ==\"}}\n{\"payload\":{\"body\":\"Yg==\"}}\n",
+			`{"payload":{"body":"YQ=="}}` + "\n" + `{"payload":{"body":"Yg=="}}` + "\n"},
+	} {
+		got, err := call(t, conn, r, tc.method, tc.input)
+		if err != nil {
+			t.Errorf("%s(%q): %v", tc.method, tc.input, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s(%q) = %q, want %q", tc.method, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	conn := dial(t, func(s *grpc.Server) { reflection.Register(s) })
+	r := NewResolver(conn)
+
+	_, err := call(t, conn, r, "grpc.testing.TestService/UnaryCall", `{"responseStatus":{"code":5,"message":"gone"}}`)
+	if st := status.Convert(err); st.Code() != codes.NotFound || st.Message() != "gone" {
+		t.Errorf("server error = %v, want NOT_FOUND gone", err)
+	}
+	_, err = call(t, conn, r, "grpc.testing.TestService/UnaryCall", "{}\n{}\n")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("two requests to a unary method = %v, want INVALID_ARGUMENT", err)
+	}
+	_, err = call(t, conn, r, "grpc.testing.TestService/StreamingInputCall", "{}\n{\"unknown\":1}\n")
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || !strings.Contains(st.Message(), "line 2") {
+		t.Errorf("invalid streamed request = %v, want INVALID_ARGUMENT on line 2", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	r := NewResolver(dial(t, func(s *grpc.Server) { reflection.Register(s) }))
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		symbol string
+		want   []string
+	}{
+		{"grpc.testing.TestService", []string{
+			"service TestService {\n",
+			"  rpc UnaryCall(grpc.testing.SimpleRequest) returns (grpc.testing.SimpleResponse);\n",
+			"  rpc FullDuplexCall(stream grpc.testing.StreamingOutputCallRequest) returns (stream grpc.testing.StreamingOutputCallResponse);\n",
+		}},
+		{"grpc.testing.StreamingOutputCallRequest", []string{
+			"message StreamingOutputCallRequest {\n",
+			"  grpc.testing.PayloadType response_type = 1;\n",
+			"  repeated grpc.testing.ResponseParameters response_parameters = 2;\n",
+		}},
+		{"grpc.testing.PayloadType", []string{"enum PayloadType {\n", "  COMPRESSABLE = 0;\n"}},
+		{"grpc.testing.TestService.StreamingInputCall", []string{
+			"rpc StreamingInputCall(stream grpc.testing.StreamingInputCallRequest) returns (grpc.testing.StreamingInputCallResponse);\n",
+		}},
+	} {
+		d, err := r.FindSymbol(ctx, tc.symbol)
+		if err != nil {
+			t.Fatalf("FindSymbol(%q): %v", tc.symbol, err)
+		}
+		var b strings.Builder
+		if err := Describe(&b, d); err != nil {
+			t.Fatalf("Describe(%q): %v", tc.symbol, err)
+		}
+		if !strings.HasPrefix(b.String(), "// "+tc.symbol+" in grpc/testing/") {
+			t.Errorf("Describe(%q) header = %q", tc.symbol, strings.SplitN(b.String(), "\n", 2)[0])
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(b.String(), w) {
+				t.Errorf("Describe(%q) = %s\nmissing %q", tc.symbol, b.String(), w)
+			}
+		}
+	}
+}
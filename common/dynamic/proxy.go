@@ -0,0 +1,164 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/problem"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+// ContentTypeNDJSON is the content type of streamed requests and responses.
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// maxBody bounds the JSON body of a single-request method.
+const maxBody = 4 << 20
+
+// Proxy is an HTTP handler exposing every method of a backend as
+// POST /package.Service/Method, without generated gateway code. Descriptors
+// are fetched through the backend's reflection service on first use.
+//
+// A method taking a single request reads it as the JSON body; a client
+// streaming method reads one JSON message per line of the body. A method
+// returning a single response answers with a JSON body; a server streaming
+// method answers with one JSON message per line (application/x-ndjson),
+// flushed as it arrives, and a final {"error": ...} line if the call fails
+// after the first message. Other failures are written as problem details.
+type Proxy struct {
+	conn     grpc.ClientConnInterface
+	resolver *Resolver
+	forward  []string
+}
+
+// NewProxy returns a Proxy calling the backend behind conn. The named HTTP
+// request headers, e.g. Authorization, are sent along as call metadata.
+func NewProxy(conn grpc.ClientConnInterface, forwardHeaders ...string) *Proxy {
+	return &Proxy{conn: conn, resolver: NewResolver(conn), forward: forwardHeaders}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		describeRequest(r, &problem.Problem{
+			Title:  http.StatusText(http.StatusMethodNotAllowed),
+			Status: http.StatusMethodNotAllowed,
+			Detail: "methods are called with POST",
+			Code:   code.Code_UNIMPLEMENTED.String(),
+		}).Write(w)
+		return
+	}
+	service, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		problem.Write(w, r, status.Errorf(codes.NotFound, "no method at %s, want /package.Service/Method", r.URL.Path))
+		return
+	}
+
+	ctx := r.Context()
+	for _, h := range p.forward {
+		for _, v := range r.Header.Values(h) {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(h), v)
+		}
+	}
+	md, err := p.resolver.FindMethod(ctx, service+"/"+method)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	types := p.resolver.Types()
+	unmarshal := protojson.UnmarshalOptions{Resolver: types}
+	var next func() (proto.Message, error)
+	if md.IsStreamingClient() {
+		next = JSONRequests(r.Body, md.Input(), unmarshal)
+	} else {
+		req := dynamicpb.NewMessage(md.Input())
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			problem.Write(w, r, status.Errorf(codes.InvalidArgument, "reading request: %v", err))
+			return
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := unmarshal.Unmarshal(body, req); err != nil {
+				problem.Write(w, r, status.Errorf(codes.InvalidArgument, "invalid %s: %v", md.Input().FullName(), err))
+				return
+			}
+		}
+		next = single(req)
+	}
+
+	marshal := protojson.MarshalOptions{Resolver: types}
+	if !md.IsStreamingServer() {
+		var resp proto.Message
+		err := Call(ctx, p.conn, md, next, func(m proto.Message) error {
+			resp = m
+			return nil
+		})
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		b, err := marshal.Marshal(resp)
+		if err != nil {
+			problem.Write(w, r, status.Errorf(codes.Internal, "encoding response: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	if md.IsStreamingClient() {
+		// Responses of a bidirectional method are written while the body
+		// is still being read, which HTTP/1.1 does not allow by default.
+		rc.EnableFullDuplex()
+	}
+	started := false
+	err = Call(ctx, p.conn, md, next, func(m proto.Message) error {
+		b, err := marshal.Marshal(m)
+		if err != nil {
+			return status.Errorf(codes.Internal, "encoding response: %v", err)
+		}
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	switch {
+	case err != nil && !started:
+		problem.Write(w, r, err)
+	case err != nil:
+		pr := describeRequest(r, problem.FromStatus(status.Convert(err)))
+		b, _ := json.Marshal(map[string]*problem.Problem{"error": pr})
+		w.Write(append(b, '\n'))
+	case !started:
+		// No responses: an empty stream.
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// describeRequest fills in the request fields problem.Write would set.
+func describeRequest(r *http.Request, p *problem.Problem) *problem.Problem {
+	p.Instance = r.URL.Path
+	if id, ok := requestid.FromContext(r.Context()); ok {
+		p.RequestID = id
+	}
+	return p
+}
@@ -0,0 +1,133 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/problem"
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+func startProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	conn := dial(t, func(s *grpc.Server) { reflection.Register(s) })
+	srv := httptest.NewServer(requestid.Handler(NewProxy(conn, "Authorization")))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func post(t *testing.T, srv *httptest.Server, path, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, strings.ReplaceAll(string(b), " ", "")
+}
+
+func TestProxy(t *testing.T) {
+	srv := startProxy(t)
+
+	for _, tc := range []struct {
+		path, body, wantType, want string
+	}{
+		{"/grpc.testing.TestService/UnaryCall", "{\n  \"payload\": {\"body\": \"aGk=\"}\n}\n",
+			"application/json", `{"payload":{"body":"aGk="}}`},
+		{"/grpc.testing.TestService/UnaryCall", "", "application/json", `{}`},
+		{"/grpc.testing.TestService/StreamingOutputCall", `{"responseParameters":[{"size":1},{"size":2}]}`,
+			ContentTypeNDJSON, `{"payload":{"body":"eA=="}}` + "\n" + `{"payload":{"body":"eHg="}}` + "\n"},
+		{"/grpc.testing.TestService/StreamingInputCall", "{\"payload\":{\"body\":\"aGk=\"}}\n{\"payload\":{\"body\":\"eHh4\"}}\n",
+			"application/json", `{"aggregatedPayloadSize":5}`},
+		{"/grpc.testing.TestService/FullDuplexCall", "{\"payload\":{\"body\":\"YQ==\"}}\n{\"payload\":{\"body\":\"Yg==\"}}\n",
+			ContentTypeNDJSON, `{"payload":{"body":"YQ=="}}` + "\n" + `{"payload":{"body":"Yg=="}}` + "\n"},
+		{"/grpc.testing.TestService/StreamingOutputCall", `{}`, ContentTypeNDJSON, ""},
+	} {
+		resp, got := post(t, srv, tc.path, tc.body)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != tc.wantType || got != tc.want {
+			t.Errorf("POST %s %q = %d %s %q, want 200 %s %q", tc.path, tc.body,
+				resp.StatusCode, resp.Header.Get("Content-Type"), got, tc.wantType, tc.want)
+		}
+	}
+}
+
+func TestProxyForwardsHeaders(t *testing.T) {
+	srv := startProxy(t)
+	_, got := post(t, srv, "/grpc.testing.TestService/UnaryCall", `{"fillUsername":true}`, "Authorization", "Bearer token")
+	if got != `{"username":"Bearertoken"}` {
+		t.Errorf("response = %s, want the forwarded authorization", got)
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	srv := startProxy(t)
+
+	for _, tc := range []struct {
+		method, path, body string
+		wantStatus         int
+		wantCode           string
+	}{
+		{http.MethodGet, "/grpc.testing.TestService/UnaryCall", "", http.StatusMethodNotAllowed, "UNIMPLEMENTED"},
+		{http.MethodPost, "/grpc.testing.TestService", "", http.StatusNotFound, "NOT_FOUND"},
+		{http.MethodPost, "/grpc.testing.TestService/Missing", "", http.StatusNotFound, "NOT_FOUND"},
+		{http.MethodPost, "/grpc.testing.TestService/UnaryCall", `{"unknown":1}`, http.StatusBadRequest, "INVALID_ARGUMENT"},
+		{http.MethodPost, "/grpc.testing.TestService/UnaryCall", `{"responseStatus":{"code":9,"message":"not yet"}}`,
+			http.StatusBadRequest, "FAILED_PRECONDITION"},
+		{http.MethodPost, "/grpc.testing.TestService/StreamingOutputCall", `{"responseStatus":{"code":5}}`,
+			http.StatusNotFound, "NOT_FOUND"},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p problem.Problem
+		err = json.NewDecoder(resp.Body).Decode(&p)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s %s: decoding problem: %v", tc.method, tc.path, err)
+		}
+		if resp.StatusCode != tc.wantStatus || resp.Header.Get("Content-Type") != problem.ContentType ||
+			p.Code != tc.wantCode || p.Instance != tc.path || p.RequestID == "" {
+			t.Errorf("%s %s %s = %d %+v, want %d %s", tc.method, tc.path, tc.body, resp.StatusCode, p, tc.wantStatus, tc.wantCode)
+		}
+	}
+}
+
+func TestProxyStreamError(t *testing.T) {
+	srv := startProxy(t)
+	resp, got := post(t, srv, "/grpc.testing.TestService/StreamingOutputCall",
+		`{"responseParameters":[{"size":1}],"responseStatus":{"code":8,"message":"quota"}}`)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if resp.StatusCode != http.StatusOK || len(lines) != 2 || lines[0] != `{"payload":{"body":"eA=="}}` {
+		t.Fatalf("response = %d %q, want one message and an error line", resp.StatusCode, got)
+	}
+	var last struct{ Error problem.Problem }
+	if err := json.Unmarshal([]byte(lines[1]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Error.Code != "RESOURCE_EXHAUSTED" || last.Error.Detail != "quota" || last.Error.RequestID == "" {
+		t.Errorf("error line = %+v", last.Error)
+	}
+}
@@ -0,0 +1,269 @@
+// Package dynamic calls gRPC methods that are only known at run time. A
+// Resolver fetches service and message descriptors through server
+// reflection, Call invokes any unary or streaming method with dynamicpb
+// messages, Describe prints descriptors in proto syntax and Proxy exposes
+// every method of a backend as a JSON endpoint over HTTP.
+package dynamic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// The v1 and v1alpha reflection services use wire-compatible messages, so
+// both are spoken with the v1 types.
+const (
+	reflectionV1      = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	reflectionV1Alpha = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+)
+
+// Resolver looks up descriptors through the reflection service of a server
+// and caches the files it received. It prefers the v1 reflection API and
+// falls back to v1alpha on servers that only serve the older one.
+type Resolver struct {
+	conn grpc.ClientConnInterface
+
+	mu      sync.Mutex
+	files   *protoregistry.Files
+	v1alpha bool
+}
+
+// NewResolver returns a Resolver asking the server behind conn.
+func NewResolver(conn grpc.ClientConnInterface) *Resolver {
+	return &Resolver{conn: conn, files: new(protoregistry.Files)}
+}
+
+// ListServices returns the sorted full names of the services the server
+// exposes.
+func (r *Resolver) ListServices(ctx context.Context) ([]string, error) {
+	resp, err := r.ask(ctx, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// FindSymbol returns the descriptor of a fully qualified service, method,
+// message, enum or field name.
+func (r *Resolver) FindSymbol(ctx context.Context, name string) (protoreflect.Descriptor, error) {
+	name = strings.TrimPrefix(name, ".")
+	if d, err := r.lookup(name); err == nil {
+		return d, nil
+	}
+	if _, err := r.load(ctx, name); err != nil {
+		// Some servers do not resolve methods and fields as symbols; ask
+		// for the file of the enclosing service or message instead.
+		i := strings.LastIndexByte(name, '.')
+		if status.Code(err) != codes.NotFound || i < 0 {
+			return nil, err
+		}
+		if _, err := r.load(ctx, name[:i]); err != nil {
+			return nil, err
+		}
+	}
+	d, err := r.lookup(name)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "symbol %q not found", name)
+	}
+	return d, nil
+}
+
+// FindMethod returns the descriptor of a method named either
+// "package.Service/Method" or "package.Service.Method".
+func (r *Resolver) FindMethod(ctx context.Context, name string) (protoreflect.MethodDescriptor, error) {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndexByte(name, '/'); i > 0 {
+		name = name[:i] + "." + name[i+1:]
+	}
+	d, err := r.FindSymbol(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not a method", name)
+	}
+	return md, nil
+}
+
+// FindService returns the descriptor of the named service.
+func (r *Resolver) FindService(ctx context.Context, name string) (protoreflect.ServiceDescriptor, error) {
+	d, err := r.FindSymbol(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "%q is not a service", name)
+	}
+	return sd, nil
+}
+
+// Types returns a type resolver over the files loaded so far. It resolves
+// the message types packed in google.protobuf.Any when marshaling JSON.
+func (r *Resolver) Types() *dynamicpb.Types {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return dynamicpb.NewTypes(r.files)
+}
+
+func (r *Resolver) lookup(name string) (protoreflect.Descriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.files.FindDescriptorByName(protoreflect.FullName(name))
+}
+
+// load fetches the file defining symbol together with its dependencies.
+func (r *Resolver) load(ctx context.Context, symbol string) (protoreflect.FileDescriptor, error) {
+	resp, err := r.ask(ctx, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return nil, err
+	}
+	protos, err := fileProtos(resp)
+	if err != nil {
+		return nil, err
+	}
+	// The first file defines the symbol; the server may send the files it
+	// imports along with it.
+	pending := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, fd := range protos {
+		pending[fd.GetName()] = fd
+	}
+	return r.register(ctx, protos[0].GetName(), pending)
+}
+
+// register adds the named file to the cache after its dependencies,
+// fetching the ones the server did not send yet.
+func (r *Resolver) register(ctx context.Context, name string, pending map[string]*descriptorpb.FileDescriptorProto) (protoreflect.FileDescriptor, error) {
+	r.mu.Lock()
+	fd, err := r.files.FindFileByPath(name)
+	r.mu.Unlock()
+	if err == nil {
+		return fd, nil
+	}
+	fdp, ok := pending[name]
+	if !ok {
+		resp, err := r.ask(ctx, &reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+		})
+		if err != nil {
+			return nil, err
+		}
+		protos, err := fileProtos(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range protos {
+			pending[p.GetName()] = p
+		}
+		if fdp, ok = pending[name]; !ok {
+			return nil, status.Errorf(codes.NotFound, "server did not return file %q", name)
+		}
+	}
+	delete(pending, name)
+	for _, dep := range fdp.GetDependency() {
+		if _, err := r.register(ctx, dep, pending); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Concurrent lookups may have registered the file since it was checked.
+	if fd, err := r.files.FindFileByPath(name); err == nil {
+		return fd, nil
+	}
+	fd, err = protodesc.NewFile(fdp, r.files)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor for %s: %w", name, err)
+	}
+	if err := r.files.RegisterFile(fd); err != nil {
+		return nil, fmt.Errorf("registering %s: %w", name, err)
+	}
+	return fd, nil
+}
+
+// ask sends one request on a new reflection stream and returns the
+// response, turning an error response into a status error.
+func (r *Resolver) ask(ctx context.Context, req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	r.mu.Lock()
+	method := reflectionV1
+	if r.v1alpha {
+		method = reflectionV1Alpha
+	}
+	r.mu.Unlock()
+
+	resp, err := r.exchange(ctx, method, req)
+	if status.Code(err) == codes.Unimplemented && method == reflectionV1 {
+		if resp, err = r.exchange(ctx, reflectionV1Alpha, req); err == nil {
+			r.mu.Lock()
+			r.v1alpha = true
+			r.mu.Unlock()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+func (r *Resolver) exchange(ctx context.Context, method string, req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := r.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	resp := new(reflectionpb.ServerReflectionResponse)
+	if err := stream.RecvMsg(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func fileProtos(resp *reflectionpb.ServerReflectionResponse) ([]*descriptorpb.FileDescriptorProto, error) {
+	raw := resp.GetFileDescriptorResponse().GetFileDescriptorProto()
+	if len(raw) == 0 {
+		return nil, status.Error(codes.NotFound, "server returned no file descriptors")
+	}
+	protos := make([]*descriptorpb.FileDescriptorProto, len(raw))
+	for i, b := range raw {
+		protos[i] = new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(b, protos[i]); err != nil {
+			return nil, fmt.Errorf("decoding file descriptor: %w", err)
+		}
+	}
+	return protos, nil
+}
@@ -0,0 +1,113 @@
+package grpcproxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Route sends the calls whose full method name starts with Match to one
+// backend.
+type Route struct {
+	// Match is a prefix of full method names: "/helloworld.Greeter/" for a
+	// service, "/ecommerce.OrderManagement/addOrder" for a method or "/"
+	// for every call. The longest matching prefix wins.
+	Match string `yaml:"match"`
+	// Backends are the addresses of the backend instances. Either Backends
+	// or Target is set.
+	Backends []string `yaml:"backends,omitempty"`
+	// Target is a gRPC target resolved at run time, such as
+	// "dns:///orders:50051" or "file:///etc/proxy/orders.yaml".
+	Target string `yaml:"target,omitempty"`
+	// Balancer is the load-balancing policy between the instances:
+	// round_robin (default), pick_first, least_outstanding or
+	// weighted_locality.
+	Balancer string `yaml:"balancer,omitempty"`
+	// Timeout bounds the calls of the route, streams included. The client
+	// deadline still applies when it is shorter. Zero means none.
+	Timeout Duration `yaml:"timeout,omitempty"`
+	// Auth, when set, rejects calls without one of its credentials before
+	// they reach the backend.
+	Auth *Auth `yaml:"auth,omitempty"`
+}
+
+// Auth lists the credentials accepted on a route, sent by clients in the
+// authorization metadata. The metadata is forwarded to the backend as is.
+type Auth struct {
+	// BearerTokens are accepted as "Bearer <token>".
+	BearerTokens []string `yaml:"bearerTokens,omitempty"`
+	// Basic maps user names to passwords accepted as "Basic <base64>".
+	Basic map[string]string `yaml:"basic,omitempty"`
+}
+
+// Config is the routing table of a Proxy.
+type Config struct {
+	Routes []Route `yaml:"routes"`
+}
+
+var balancers = map[string]bool{
+	"round_robin": true, "pick_first": true, "least_outstanding": true, "weighted_locality": true,
+}
+
+// Validate reports the first invalid route of c.
+func (c Config) Validate() error {
+	seen := make(map[string]bool)
+	for i, r := range c.Routes {
+		switch {
+		case !strings.HasPrefix(r.Match, "/"):
+			return fmt.Errorf("route %d: match %q must start with /", i, r.Match)
+		case seen[r.Match]:
+			return fmt.Errorf("route %d: duplicate match %q", i, r.Match)
+		case (len(r.Backends) == 0) == (r.Target == ""):
+			return fmt.Errorf("route %d: set either backends or target", i)
+		case r.Balancer != "" && !balancers[r.Balancer]:
+			return fmt.Errorf("route %d: unknown balancer %q", i, r.Balancer)
+		case r.Timeout < 0:
+			return fmt.Errorf("route %d: negative timeout", i)
+		case r.Auth != nil && len(r.Auth.BearerTokens) == 0 && len(r.Auth.Basic) == 0:
+			return fmt.Errorf("route %d: auth accepts no credentials", i)
+		}
+		seen[r.Match] = true
+	}
+	return nil
+}
+
+// Parse parses and validates a Config in JSON or YAML.
+func Parse(b []byte) (Config, error) {
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+// Load reads and validates a Config file in JSON or YAML.
+func Load(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Duration is a time.Duration written as a string such as "2s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	v, err := time.ParseDuration(n.Value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
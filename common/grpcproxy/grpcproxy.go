@@ -0,0 +1,332 @@
+// Package grpcproxy is a transparent gRPC reverse proxy. It routes each call
+// by its full method name to a backend and forwards the messages as raw
+// bytes, so it needs no generated code for the services behind it. Clients
+// keep a single address while services are split into separate processes.
+//
+//	routes:
+//	  - match: /helloworld.Greeter/
+//	    backends: [localhost:50061]
+//	  - match: /ecommerce.OrderManagement/
+//	    backends: [localhost:50062, localhost:50063]
+//	    balancer: least_outstanding
+//	    timeout: 10s
+//	    auth:
+//	      bearerTokens: [some-secret-token]
+//
+// Request metadata is forwarded with x-forwarded-for added; response
+// headers, trailers and statuses, error details included, come back
+// untouched. Services registered on the proxy's own server, such as health
+// and reflection, are served by the proxy; calls matching no route fail
+// with codes.Unimplemented.
+package grpcproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/rawcodec"
+
+	// Registers the least_outstanding and weighted_locality balancers, and
+	// through discovery the file: and dnssrv: resolvers.
+	_ "github.com/cuongpiger/grpc-up-and-running/common/lb"
+)
+
+// Proxy forwards calls to the backends of its routes.
+type Proxy struct {
+	// routes are sorted by decreasing length of Match, so the first match
+	// is the most specific.
+	routes []*route
+}
+
+type route struct {
+	Route
+	conn *grpc.ClientConn
+}
+
+// New connects to the backends of every route of c. opts are added to the
+// dial options of every backend; connections are plaintext unless opts set
+// transport credentials.
+func New(c Config, opts ...grpc.DialOption) (*Proxy, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Proxy{}
+	for i, r := range c.Routes {
+		conn, err := dial(i, r, opts)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("route %s: %w", r.Match, err)
+		}
+		p.routes = append(p.routes, &route{Route: r, conn: conn})
+	}
+	sort.SliceStable(p.routes, func(i, j int) bool { return len(p.routes[i].Match) > len(p.routes[j].Match) })
+	return p, nil
+}
+
+func dial(i int, r Route, opts []grpc.DialOption) (*grpc.ClientConn, error) {
+	balancer := r.Balancer
+	if balancer == "" {
+		balancer = "round_robin"
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, balancer)),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawcodec.Codec{})),
+	}
+	target := r.Target
+	if target == "" {
+		// A fixed list of instances is served by a resolver of its own.
+		res := manual.NewBuilderWithScheme(fmt.Sprintf("grpcproxy-route-%d", i))
+		state := resolver.State{}
+		for _, addr := range r.Backends {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		res.InitialState(state)
+		target = res.Scheme() + ":///backends"
+		dialOpts = append(dialOpts, grpc.WithResolvers(res))
+	}
+	return grpc.NewClient(target, append(dialOpts, opts...)...)
+}
+
+// ServerOptions returns the options making a gRPC server forward every call
+// of a service it does not implement itself through p.
+func (p *Proxy) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ForceServerCodec(rawcodec.Codec{}),
+		grpc.UnknownServiceHandler(p.handle),
+	}
+}
+
+// Close closes the backend connections.
+func (p *Proxy) Close() error {
+	var errs []error
+	for _, r := range p.routes {
+		errs = append(errs, r.conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// WatchHealth reports the state of the backend connections in h until ctx
+// is done: the server ("") is SERVING while every route has a ready
+// connection, and a route matching a whole service, such as
+// "/helloworld.Greeter/", sets the status of that service. A route is
+// NOT_SERVING until its first connection is ready and while its backends
+// are failing; it keeps its status while reconnecting.
+func (p *Proxy) WatchHealth(ctx context.Context, h *health.Server) {
+	var mu sync.Mutex
+	ready := make([]bool, len(p.routes))
+	set := func(i int, ok bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		ready[i] = ok
+		if svc := p.routes[i].service(); svc != "" {
+			h.SetServingStatus(svc, servingStatus(ok))
+		}
+		all := true
+		for _, ok := range ready {
+			all = all && ok
+		}
+		h.SetServingStatus("", servingStatus(all))
+	}
+	for i, r := range p.routes {
+		set(i, false)
+		go func() {
+			state := r.conn.GetState()
+			for {
+				switch state {
+				case connectivity.Ready:
+					set(i, true)
+				case connectivity.TransientFailure:
+					set(i, false)
+				case connectivity.Idle:
+					// Keep a connection so the status stays current.
+					r.conn.Connect()
+				case connectivity.Shutdown:
+					return
+				}
+				if !r.conn.WaitForStateChange(ctx, state) {
+					return
+				}
+				state = r.conn.GetState()
+			}
+		}()
+	}
+}
+
+func servingStatus(ok bool) healthpb.HealthCheckResponse_ServingStatus {
+	if ok {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// service returns the service whose methods r matches, or "" if r matches
+// some methods of a service or several services.
+func (r *route) service() string {
+	svc, ok := strings.CutPrefix(r.Match, "/")
+	if !ok {
+		return ""
+	}
+	svc, ok = strings.CutSuffix(svc, "/")
+	if !ok || svc == "" || strings.Contains(svc, "/") {
+		return ""
+	}
+	return svc
+}
+
+func (p *Proxy) match(method string) *route {
+	for _, r := range p.routes {
+		if strings.HasPrefix(method, r.Match) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (p *Proxy) handle(_ any, ss grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(ss)
+	r := p.match(method)
+	if r == nil {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	ctx := ss.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	if r.Auth != nil && !r.Auth.accepts(md.Get("authorization")) {
+		return status.Error(codes.Unauthenticated, "missing or invalid credentials")
+	}
+	delete(md, ":authority")
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		if host, _, err := net.SplitHostPort(pr.Addr.String()); err == nil {
+			md.Append("x-forwarded-for", host)
+		}
+	}
+
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	var cancel context.CancelFunc
+	if r.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(r.Timeout))
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	cs, err := r.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method)
+	if err != nil {
+		return err
+	}
+
+	requests := make(chan error, 1)
+	go func() { requests <- forwardRequests(ss, cs) }()
+	responses := make(chan error, 1)
+	go func() { responses <- forwardResponses(cs, ss) }()
+	for {
+		select {
+		case err := <-requests:
+			if err != nil {
+				// The client went away or sent garbage; abandon the call.
+				cancel()
+				return err
+			}
+			requests = nil
+		case err := <-responses:
+			ss.SetTrailer(cs.Trailer())
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// forwardRequests copies the client's messages to the backend and half
+// closes the backend stream after the last one.
+func forwardRequests(ss grpc.ServerStream, cs grpc.ClientStream) error {
+	for {
+		f := &rawcodec.Frame{}
+		if err := ss.RecvMsg(f); err != nil {
+			if errors.Is(err, io.EOF) {
+				return cs.CloseSend()
+			}
+			return err
+		}
+		if err := cs.SendMsg(f); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The backend ended the call; forwardResponses reports how.
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// forwardResponses copies the backend's headers and messages to the client
+// and returns io.EOF when the call succeeded, or the backend's status.
+func forwardResponses(cs grpc.ClientStream, ss grpc.ServerStream) error {
+	for first := true; ; first = false {
+		f := &rawcodec.Frame{}
+		err := cs.RecvMsg(f)
+		if first {
+			// Headers arrive before the first message, or with the status
+			// of a call that sends none.
+			if h, herr := cs.Header(); herr == nil {
+				if err == nil {
+					if serr := ss.SendHeader(h); serr != nil {
+						return serr
+					}
+				} else {
+					ss.SetHeader(h)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := ss.SendMsg(f); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *Auth) accepts(values []string) bool {
+	for _, v := range values {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+			for _, t := range a.BearerTokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					return true
+				}
+			}
+		}
+		if enc, ok := strings.CutPrefix(v, "Basic "); ok {
+			b, err := base64.StdEncoding.DecodeString(enc)
+			if err != nil {
+				continue
+			}
+			user, password, _ := strings.Cut(string(b), ":")
+			if want, ok := a.Basic[user]; ok && subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,385 @@
+package grpcproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// backend answers with its name, echoes the request metadata it cares about
+// and marks its responses with a header and a trailer.
+type backend struct {
+	testpb.UnimplementedTestServiceServer
+	name string
+}
+
+func (b *backend) UnaryCall(ctx context.Context, in *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	grpc.SetHeader(ctx, metadata.Pairs("backend", b.name))
+	grpc.SetTrailer(ctx, metadata.Pairs("trailer-backend", b.name))
+	if s := in.GetResponseStatus(); s != nil {
+		st, _ := status.New(codes.Code(s.GetCode()), s.GetMessage()).WithDetails(
+			&errdetails.ErrorInfo{Reason: "TEST", Domain: b.name})
+		return nil, st.Err()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return &testpb.SimpleResponse{
+		Hostname: b.name,
+		Username: strings.Join(md.Get("x-forwarded-for"), ",") + "|" + strings.Join(md.Get("x-user"), ","),
+		Payload:  in.GetPayload(),
+	}, nil
+}
+
+func (b *backend) StreamingOutputCall(in *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	for _, p := range in.GetResponseParameters() {
+		body := []byte(strings.Repeat("x", int(p.GetSize())))
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: body}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *backend) StreamingInputCall(stream testpb.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(in.GetPayload().GetBody()))
+	}
+}
+
+func (b *backend) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d := in.GetResponseParameters(); len(d) > 0 {
+			// Stall the stream, for the timeout test.
+			select {
+			case <-time.After(time.Duration(d[0].GetIntervalUs()) * time.Microsecond):
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: in.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+func listen(t *testing.T, s *grpc.Server) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func startBackend(t *testing.T, name string) string {
+	t.Helper()
+	s := grpc.NewServer()
+	testpb.RegisterTestServiceServer(s, &backend{name: name})
+	return listen(t, s)
+}
+
+// startProxy serves c on a proxy that also implements health itself and
+// returns a client connection to it.
+func startProxy(t *testing.T, c Config) *grpc.ClientConn {
+	t.Helper()
+	p, err := New(c)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	s := grpc.NewServer(p.ServerOptions()...)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	conn, err := grpc.NewClient(listen(t, s), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRoutesByMethod(t *testing.T) {
+	a, b := startBackend(t, "a"), startBackend(t, "b")
+	conn := startProxy(t, Config{Routes: []Route{
+		{Match: "/grpc.testing.TestService/", Backends: []string{a}},
+		{Match: "/grpc.testing.TestService/UnaryCall", Backends: []string{b}},
+	}})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user", "alice")
+
+	var header, trailer metadata.MD
+	resp, err := testpb.NewTestServiceClient(conn).UnaryCall(ctx,
+		&testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("hi")}},
+		grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatalf("UnaryCall: %v", err)
+	}
+	if resp.GetHostname() != "b" || string(resp.GetPayload().GetBody()) != "hi" {
+		t.Errorf("UnaryCall = %v, want the payload back from b", resp)
+	}
+	if resp.GetUsername() != "127.0.0.1|alice" {
+		t.Errorf("backend metadata = %q, want x-forwarded-for and x-user", resp.GetUsername())
+	}
+	if header.Get("backend")[0] != "b" || trailer.Get("trailer-backend")[0] != "b" {
+		t.Errorf("header = %v, trailer = %v", header, trailer)
+	}
+
+	// The proxy's own services are not forwarded.
+	hc, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || hc.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health = %v, %v", hc, err)
+	}
+	_, err = testpb.NewUnimplementedServiceClient(conn).UnimplementedCall(ctx, &testpb.Empty{})
+	if st := status.Convert(err); st.Code() != codes.Unimplemented || !strings.Contains(st.Message(), "unknown method") {
+		t.Errorf("unrouted call = %v, want UNIMPLEMENTED", err)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	conn := startProxy(t, Config{Routes: []Route{{Match: "/", Backends: []string{startBackend(t, "a")}}}})
+	client := testpb.NewTestServiceClient(conn)
+	ctx := context.Background()
+
+	out, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1}, {Size: 2}, {Size: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for {
+		resp, err := out.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("StreamingOutputCall: %v", err)
+		}
+		sizes = append(sizes, len(resp.GetPayload().GetBody()))
+	}
+	if len(sizes) != 3 || sizes[2] != 3 {
+		t.Errorf("server stream sizes = %v", sizes)
+	}
+
+	in, err := client.StreamingInputCall(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"ab", "cde"} {
+		if err := in.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, err := in.CloseAndRecv(); err != nil || resp.GetAggregatedPayloadSize() != 5 {
+		t.Errorf("client stream = %v, %v, want 5", resp, err)
+	}
+
+	bidi, err := client.FullDuplexCall(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"x", "y"} {
+		if err := bidi.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}); err != nil {
+			t.Fatal(err)
+		}
+		// Each response comes back before the next request is sent.
+		resp, err := bidi.Recv()
+		if err != nil || string(resp.GetPayload().GetBody()) != body {
+			t.Fatalf("bidi echo = %v, %v, want %q", resp, err, body)
+		}
+	}
+	bidi.CloseSend()
+	if _, err := bidi.Recv(); err != io.EOF {
+		t.Errorf("bidi end = %v, want EOF", err)
+	}
+}
+
+func TestBackendErrors(t *testing.T) {
+	conn := startProxy(t, Config{Routes: []Route{{Match: "/", Backends: []string{startBackend(t, "a")}}}})
+	var header metadata.MD
+	_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), &testpb.SimpleRequest{
+		ResponseStatus: &testpb.EchoStatus{Code: int32(codes.FailedPrecondition), Message: "not yet"},
+	}, grpc.Header(&header))
+	st := status.Convert(err)
+	if st.Code() != codes.FailedPrecondition || st.Message() != "not yet" {
+		t.Fatalf("error = %v, want FAILED_PRECONDITION not yet", err)
+	}
+	if d := st.Details(); len(d) != 1 || d[0].(*errdetails.ErrorInfo).GetDomain() != "a" {
+		t.Errorf("details = %v, want the backend's ErrorInfo", d)
+	}
+	if got := header.Get("backend"); len(got) != 1 || got[0] != "a" {
+		t.Errorf("header = %v, want the backend header with the error", header)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	conn := startProxy(t, Config{Routes: []Route{{
+		Match:    "/",
+		Backends: []string{startBackend(t, "a")},
+		Auth:     &Auth{BearerTokens: []string{"secret"}, Basic: map[string]string{"admin": "admin"}},
+	}}})
+	client := testpb.NewTestServiceClient(conn)
+
+	for authorization, want := range map[string]codes.Code{
+		"":                       codes.Unauthenticated,
+		"Bearer wrong":           codes.Unauthenticated,
+		"Bearer secret":          codes.OK,
+		"Basic YWRtaW46YWRtaW4=": codes.OK,              // admin:admin
+		"Basic YWRtaW46eA==":     codes.Unauthenticated, // admin:x
+	} {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+		}
+		if _, err := client.UnaryCall(ctx, &testpb.SimpleRequest{}); status.Code(err) != want {
+			t.Errorf("authorization %q: %v, want %v", authorization, err, want)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	conn := startProxy(t, Config{Routes: []Route{{
+		Match:    "/",
+		Backends: []string{startBackend(t, "a")},
+		Timeout:  Duration(100 * time.Millisecond),
+	}}})
+	stream, err := testpb.NewTestServiceClient(conn).FullDuplexCall(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{IntervalUs: int32(time.Minute / time.Microsecond)}},
+	})
+	start := time.Now()
+	if _, err := stream.Recv(); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("stalled stream = %v, want DEADLINE_EXCEEDED", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("timeout took %v", d)
+	}
+}
+
+func TestLoadBalancing(t *testing.T) {
+	conn := startProxy(t, Config{Routes: []Route{{
+		Match:    "/",
+		Backends: []string{startBackend(t, "a"), startBackend(t, "b")},
+	}}})
+	client := testpb.NewTestServiceClient(conn)
+	seen := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		resp, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{}, grpc.WaitForReady(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[resp.GetHostname()]++
+	}
+	if seen["a"] == 0 || seen["b"] == 0 {
+		t.Errorf("calls per backend = %v, want both used", seen)
+	}
+}
+
+func TestWatchHealth(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := lis.Addr().String()
+	lis.Close()
+	p, err := New(Config{Routes: []Route{
+		{Match: "/grpc.testing.TestService/", Backends: []string{startBackend(t, "a")}},
+		{Match: "/grpc.testing.UnimplementedService/", Backends: []string{down}},
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := health.NewServer()
+	p.WatchHealth(ctx, h)
+
+	want := map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"grpc.testing.TestService":          healthpb.HealthCheckResponse_SERVING,
+		"grpc.testing.UnimplementedService": healthpb.HealthCheckResponse_NOT_SERVING,
+		"":                                  healthpb.HealthCheckResponse_NOT_SERVING,
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		got := make(map[string]healthpb.HealthCheckResponse_ServingStatus)
+		for svc := range want {
+			res, err := h.Check(ctx, &healthpb.HealthCheckRequest{Service: svc})
+			if err != nil {
+				t.Fatalf("Check(%q): %v", svc, err)
+			}
+			got[svc] = res.GetStatus()
+		}
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`
+routes:
+  - match: /helloworld.Greeter/
+    backends: [localhost:50061]
+  - match: /ecommerce.OrderManagement/
+    target: dns:///orders:50051
+    balancer: least_outstanding
+    timeout: 2s
+    auth:
+      bearerTokens: [some-secret-token]
+      basic: {admin: admin}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if r := c.Routes[1]; r.Timeout != Duration(2*time.Second) || r.Auth.Basic["admin"] != "admin" || r.Balancer != "least_outstanding" {
+		t.Errorf("route = %+v", r)
+	}
+
+	for doc, want := range map[string]string{
+		"routes: [{match: greeter, backends: [a]}]":                      "must start with /",
+		"routes: [{match: /, backends: [a]}, {match: /, backends: [b]}]": "duplicate match",
+		"routes: [{match: /}]":                                           "either backends or target",
+		"routes: [{match: /, backends: [a], target: dns:///b}]":          "either backends or target",
+		"routes: [{match: /, backends: [a], balancer: random}]":          "unknown balancer",
+		"routes: [{match: /, backends: [a], auth: {}}]":                  "accepts no credentials",
+		"routes: [{match: /, backends: [a], timeot: 1s}]":                "not found",
+	} {
+		if _, err := Parse([]byte(doc)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%s) = %v, want %q", doc, err, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package lb registers two client-side load-balancing policies, selected by
+// name in the service config:
+//
+//	{"loadBalancingConfig": [{"weighted_locality": {"localZone": "zone-a"}}]}
+//	{"loadBalancingConfig": [{"least_outstanding": {}}]}
+//
+// weighted_locality spreads calls over the READY backends in proportion to
+// their weight (smooth weighted round-robin). When localZone is set it only
+// uses backends in that zone while at least one of them is READY, and fails
+// over to all backends otherwise.
+//
+// least_outstanding sends each call to the READY backend with the fewest
+// calls in flight from this channel, rotating between equally loaded ones.
+//
+// Weights and zones are the address attributes set by the discovery
+// resolvers; addresses without them have weight 1 and no zone. Both policies
+// honour healthCheckConfig.
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/discovery"
+)
+
+const (
+	// WeightedLocality is the name of the weighted, locality-aware policy.
+	WeightedLocality = "weighted_locality"
+	// LeastOutstanding is the name of the least-outstanding-requests policy.
+	LeastOutstanding = "least_outstanding"
+)
+
+func init() {
+	balancer.Register(builder{name: WeightedLocality, newPicker: newWeightedPickerBuilder})
+	balancer.Register(builder{name: LeastOutstanding, newPicker: newLeastOutstandingPickerBuilder})
+}
+
+// Config is the configuration of both policies in the service config.
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// LocalZone is the zone of the client; weighted_locality prefers the
+	// backends of this zone.
+	LocalZone string `json:"localZone,omitempty"`
+}
+
+// endpointInfo is the latest weight and zone of an address.
+type endpointInfo struct {
+	weight uint32
+	zone   string
+}
+
+// channelState is shared by a balancer and the pickers it builds: the base
+// balancer keeps the attributes an address had when its SubConn was created,
+// so the latest ones are taken from every resolver update instead.
+type channelState struct {
+	mu        sync.Mutex
+	config    Config
+	endpoints map[string]endpointInfo
+}
+
+func (s *channelState) update(ccs balancer.ClientConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg, ok := ccs.BalancerConfig.(*Config); ok && cfg != nil {
+		s.config = *cfg
+	}
+	s.endpoints = make(map[string]endpointInfo, len(ccs.ResolverState.Addresses))
+	for _, a := range ccs.ResolverState.Addresses {
+		s.endpoints[a.Addr] = endpointInfo{weight: discovery.Weight(a.BalancerAttributes), zone: discovery.Zone(a.BalancerAttributes)}
+	}
+}
+
+func (s *channelState) lookup(a resolver.Address) endpointInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.endpoints[a.Addr]; ok {
+		return info
+	}
+	return endpointInfo{weight: discovery.Weight(a.BalancerAttributes), zone: discovery.Zone(a.BalancerAttributes)}
+}
+
+func (s *channelState) localZone() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.LocalZone
+}
+
+// builder builds a base balancer, which manages one SubConn per address,
+// with a picker builder of its own per channel.
+type builder struct {
+	name      string
+	newPicker func(*channelState) base.PickerBuilder
+}
+
+func (b builder) Name() string { return b.name }
+
+func (b builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	state := &channelState{}
+	bb := base.NewBalancerBuilder(b.name, b.newPicker(state), base.Config{HealthCheck: true})
+	return &stateBalancer{Balancer: bb.Build(cc, opts), state: state}
+}
+
+func (b builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &Config{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config %s: %v", b.name, js, err)
+		}
+	}
+	return cfg, nil
+}
+
+// stateBalancer records every resolver update in state before handing it to
+// the base balancer, which then rebuilds the picker.
+type stateBalancer struct {
+	balancer.Balancer
+	state *channelState
+}
+
+func (b *stateBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.state.update(s)
+	return b.Balancer.UpdateClientConnState(s)
+}
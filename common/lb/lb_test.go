@@ -0,0 +1,173 @@
+package lb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver/manual"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/discovery"
+)
+
+// startBackend starts a health server on a local port, like the ecServer
+// instances of the load balancing example.
+func startBackend(t *testing.T) (string, *grpc.Server) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String(), s
+}
+
+func dial(t *testing.T, policy string, cfg string, endpoints []discovery.Endpoint) healthpb.HealthClient {
+	t.Helper()
+	r := manual.NewBuilderWithScheme("lbtest")
+	r.InitialState(discovery.State(endpoints))
+	conn, err := grpc.NewClient(r.Scheme()+":///backends",
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: %s}]}`, policy, cfg)))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+// tryCheck makes one call and returns the address of the backend that
+// served it.
+func tryCheck(client healthpb.HealthClient) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var p peer.Peer
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p), grpc.WaitForReady(true)); err != nil {
+		return "", err
+	}
+	return p.Addr.String(), nil
+}
+
+func check(t *testing.T, client healthpb.HealthClient) string {
+	t.Helper()
+	addr, err := tryCheck(client)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return addr
+}
+
+// waitFor calls until pred holds for the serving backend. Failed calls are
+// retried, as calls in flight on a backend that goes away fail.
+func waitFor(t *testing.T, client healthpb.HealthClient, pred func(addr string) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if addr, err := tryCheck(client); err == nil && pred(addr) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the expected backend")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	a, _ := startBackend(t)
+	b, _ := startBackend(t)
+	client := dial(t, WeightedLocality, `{}`, []discovery.Endpoint{
+		{Address: a, Weight: 3, Zone: "zone-a"},
+		{Address: b, Weight: 1, Zone: "zone-b"},
+	})
+	// Wait for both SubConns to be READY.
+	waitFor(t, client, func(addr string) bool { return addr == b })
+
+	counts := map[string]int{}
+	for i := 0; i < 40; i++ {
+		counts[check(t, client)]++
+	}
+	if counts[a] != 30 || counts[b] != 10 {
+		t.Errorf("calls per backend = %v, want %s:30 %s:10", counts, a, b)
+	}
+}
+
+func TestLocalZoneFailover(t *testing.T) {
+	a, _ := startBackend(t)
+	b, sb := startBackend(t)
+	client := dial(t, WeightedLocality, `{"localZone": "zone-b"}`, []discovery.Endpoint{
+		{Address: a, Weight: 3, Zone: "zone-a"},
+		{Address: b, Weight: 1, Zone: "zone-b"},
+	})
+	waitFor(t, client, func(addr string) bool { return addr == b })
+	for i := 0; i < 20; i++ {
+		if addr := check(t, client); addr != b {
+			t.Fatalf("call %d served by %s, want the local backend %s", i, addr, b)
+		}
+	}
+
+	// With no READY backend left in zone-b, calls fail over to zone-a.
+	sb.Stop()
+	waitFor(t, client, func(addr string) bool { return addr == a })
+	for i := 0; i < 10; i++ {
+		if addr := check(t, client); addr != a {
+			t.Fatalf("call %d after failover served by %s, want %s", i, addr, a)
+		}
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	a, _ := startBackend(t)
+	b, _ := startBackend(t)
+	client := dial(t, LeastOutstanding, `{}`, []discovery.Endpoint{{Address: a}, {Address: b}})
+	seen := map[string]bool{}
+	waitFor(t, client, func(addr string) bool { seen[addr] = true; return len(seen) == 2 })
+
+	// A Watch stream stays outstanding until cancelled, so every call made
+	// meanwhile goes to the other backend.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Watch.Recv: %v", err)
+	}
+	p, _ := peer.FromContext(stream.Context())
+	busy := p.Addr.String()
+	for i := 0; i < 10; i++ {
+		if addr := check(t, client); addr == busy {
+			t.Fatalf("call %d sent to %s, which has a call in flight", i, addr)
+		}
+	}
+
+	// Once the stream ends, calls are spread over both backends again.
+	cancel()
+	seen = map[string]bool{}
+	waitFor(t, client, func(addr string) bool { seen[addr] = true; return len(seen) == 2 })
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := builder{name: WeightedLocality}.ParseConfig([]byte(`{"localZone": "zone-a"}`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if got := cfg.(*Config).LocalZone; got != "zone-a" {
+		t.Errorf("LocalZone = %q, want zone-a", got)
+	}
+	if _, err := (builder{name: WeightedLocality}).ParseConfig([]byte(`{"localZone": 1}`)); err == nil {
+		t.Error("ParseConfig accepted an invalid config")
+	}
+}
@@ -0,0 +1,68 @@
+package lb
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type leastOutstandingPickerBuilder struct {
+	// inflight counts the calls in flight per SubConn. It outlives pickers
+	// so counts survive picker rebuilds.
+	mu       sync.Mutex
+	inflight map[balancer.SubConn]*atomic.Int64
+}
+
+func newLeastOutstandingPickerBuilder(*channelState) base.PickerBuilder {
+	return &leastOutstandingPickerBuilder{inflight: make(map[balancer.SubConn]*atomic.Int64)}
+}
+
+func (b *leastOutstandingPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := &leastOutstandingPicker{}
+	live := make(map[balancer.SubConn]*atomic.Int64, len(info.ReadySCs))
+	for sc := range info.ReadySCs {
+		n, ok := b.inflight[sc]
+		if !ok {
+			n = new(atomic.Int64)
+		}
+		live[sc] = n
+		p.backends = append(p.backends, outstanding{sc: sc, inflight: n})
+	}
+	b.inflight = live
+	return p
+}
+
+type outstanding struct {
+	sc       balancer.SubConn
+	inflight *atomic.Int64
+}
+
+type leastOutstandingPicker struct {
+	backends []outstanding
+	next     atomic.Uint32
+}
+
+func (p *leastOutstandingPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	// Start the scan at a rotating offset so ties are spread evenly.
+	start := int(p.next.Add(1) % uint32(len(p.backends)))
+	best := p.backends[start]
+	for i := 1; i < len(p.backends); i++ {
+		b := p.backends[(start+i)%len(p.backends)]
+		if b.inflight.Load() < best.inflight.Load() {
+			best = b
+		}
+	}
+	best.inflight.Add(1)
+	return balancer.PickResult{
+		SubConn: best.sc,
+		Done:    func(balancer.DoneInfo) { best.inflight.Add(-1) },
+	}, nil
+}
@@ -0,0 +1,67 @@
+package lb
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type weightedPickerBuilder struct {
+	state *channelState
+}
+
+func newWeightedPickerBuilder(state *channelState) base.PickerBuilder {
+	return &weightedPickerBuilder{state: state}
+}
+
+func (b *weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	zone := b.state.localZone()
+	var all, local []*weightedItem
+	for sc, scInfo := range info.ReadySCs {
+		ep := b.state.lookup(scInfo.Address)
+		item := &weightedItem{sc: sc, weight: int64(ep.weight)}
+		all = append(all, item)
+		if zone != "" && ep.zone == zone {
+			local = append(local, item)
+		}
+	}
+	// Stay in the local zone while it has a READY backend.
+	if len(local) > 0 {
+		return &weightedPicker{items: local}
+	}
+	return &weightedPicker{items: all}
+}
+
+type weightedItem struct {
+	sc      balancer.SubConn
+	weight  int64
+	current int64
+}
+
+// weightedPicker implements smooth weighted round-robin: backends are picked
+// in proportion to their weight, interleaved rather than in bursts.
+type weightedPicker struct {
+	mu    sync.Mutex
+	items []*weightedItem
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var total int64
+	var best *weightedItem
+	for _, it := range p.items {
+		it.current += it.weight
+		total += it.weight
+		if best == nil || it.current > best.current {
+			best = it
+		}
+	}
+	best.current -= total
+	return balancer.PickResult{SubConn: best.sc}, nil
+}
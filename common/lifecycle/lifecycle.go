@@ -0,0 +1,270 @@
+// Package lifecycle runs a gRPC server until the process is asked to stop and
+// then shuts it down without failing in-flight calls:
+//
+//  1. on SIGINT or SIGTERM every service is reported NOT_SERVING through the
+//     health service, so load balancers and health-checking clients stop
+//     sending new calls;
+//  2. the server keeps serving for the drain period while they react;
+//  3. GracefulStop waits for the running calls, falling back to Stop (which
+//     cancels them) after the stop timeout;
+//  4. the shutdown hooks run in registration order, to flush telemetry
+//     exporters and close stores.
+//
+// A second signal skips whatever is left of the drain period and the graceful
+// stop. ServeHTTP runs the same sequence for a gRPC server sharing an HTTP
+// server's port.
+//
+// The package does not depend on a particular health implementation, so it
+// can be used by servers bringing their own grpc.health.v1 code; stdhealth
+// registers the standard one.
+//
+//	s := grpc.NewServer()
+//	pb.RegisterProductInfoServer(s, &server{})
+//	runner := lifecycle.New(s, lifecycle.Options{Health: stdhealth.Register(s)})
+//	runner.OnShutdown("tracer provider", tp.Shutdown)
+//	if err := runner.Serve(lis); err != nil {
+//		log.Fatalf("failed to serve: %v", err)
+//	}
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// DefaultDrainPeriod is used when Options.DrainPeriod is zero.
+	DefaultDrainPeriod = 5 * time.Second
+	// DefaultStopTimeout is used when Options.StopTimeout is zero.
+	DefaultStopTimeout = 10 * time.Second
+	// DefaultHookTimeout is used when Options.HookTimeout is zero.
+	DefaultHookTimeout = 5 * time.Second
+)
+
+// HealthShutdowner marks every service NOT_SERVING. The standard
+// google.golang.org/grpc/health server implements it.
+type HealthShutdowner interface {
+	Shutdown()
+}
+
+// Options tunes a Runner. The zero value uses the defaults above.
+type Options struct {
+	// Health is flipped to NOT_SERVING when shutdown starts. It may be nil
+	// for a server without health service.
+	Health HealthShutdowner
+
+	// DrainPeriod is how long the server keeps serving after reporting
+	// NOT_SERVING. A negative value disables draining.
+	DrainPeriod time.Duration
+
+	// StopTimeout bounds GracefulStop before in-flight calls are cancelled.
+	StopTimeout time.Duration
+
+	// HookTimeout bounds each shutdown hook.
+	HookTimeout time.Duration
+
+	// Signals start the shutdown. Defaults to SIGINT and SIGTERM.
+	Signals []os.Signal
+}
+
+type hook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Runner serves a gRPC server and shuts it down in order. Create it with New.
+type Runner struct {
+	server *grpc.Server
+	opts   Options
+	hooks  []hook
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// New returns a Runner for s.
+func New(s *grpc.Server, opts Options) *Runner {
+	if opts.DrainPeriod == 0 {
+		opts.DrainPeriod = DefaultDrainPeriod
+	}
+	if opts.StopTimeout == 0 {
+		opts.StopTimeout = DefaultStopTimeout
+	}
+	if opts.HookTimeout == 0 {
+		opts.HookTimeout = DefaultHookTimeout
+	}
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return &Runner{server: s, opts: opts, stop: make(chan struct{})}
+}
+
+// OnShutdown registers fn to run once the server has stopped, e.g. to flush a
+// telemetry exporter or close a store. Hooks run in registration order; an
+// error is logged and does not prevent the next hooks from running.
+func (r *Runner) OnShutdown(name string, fn func(context.Context) error) {
+	r.hooks = append(r.hooks, hook{name: name, fn: fn})
+}
+
+// Shutdown starts the shutdown sequence as if a signal had been received.
+func (r *Runner) Shutdown() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// Serve serves lis until a signal or Shutdown, then runs the shutdown
+// sequence and returns nil. If the server fails on its own, Serve runs the
+// hooks and returns that error.
+func (r *Runner) Serve(lis net.Listener) error {
+	return r.run(
+		func() error { return r.server.Serve(lis) },
+		r.server.GracefulStop,
+		r.server.Stop)
+}
+
+// ServeHTTP is Serve for a gRPC server mounted in an HTTP server through
+// grpc.Server.ServeHTTP, e.g. to share its port with a REST gateway. srv
+// serves lis and its handler is wrapped to track in-flight requests,
+// including hijacked connections such as h2c and WebSocket ones. The
+// graceful stop shuts srv down, answers new requests with 503 Service
+// Unavailable and waits for the in-flight ones; the gRPC server is then
+// stopped with Stop, since GracefulStop is not supported for ServeHTTP.
+// portmux.NewServer builds a suitable srv.
+func (r *Runner) ServeHTTP(srv *http.Server, lis net.Listener) error {
+	t := &tracker{next: srv.Handler, done: make(chan struct{})}
+	if t.next == nil {
+		t.next = http.DefaultServeMux
+	}
+	srv.Handler = t
+	err := r.run(
+		func() error {
+			if err := srv.Serve(lis); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+		func() {
+			srv.Shutdown(context.Background())
+			t.wait()
+		},
+		func() {
+			srv.Close()
+			r.server.Stop()
+		})
+	r.server.Stop()
+	return err
+}
+
+func (r *Runner) run(serve func() error, gracefulStop, stop func()) error {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, r.opts.Signals...)
+	defer signal.Stop(sig)
+
+	served := make(chan error, 1)
+	go func() { served <- serve() }()
+
+	select {
+	case err := <-served:
+		r.runHooks()
+		return err
+	case s := <-sig:
+		log.Printf("received %v, shutting down", s)
+	case <-r.stop:
+		log.Printf("shutting down")
+	}
+
+	if r.opts.Health != nil {
+		r.opts.Health.Shutdown()
+	}
+	if r.opts.DrainPeriod > 0 {
+		log.Printf("draining for %v", r.opts.DrainPeriod)
+		select {
+		case <-time.After(r.opts.DrainPeriod):
+		case s := <-sig:
+			log.Printf("received %v, skipping drain", s)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		gracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(r.opts.StopTimeout):
+		log.Printf("graceful stop timed out after %v, cancelling in-flight calls", r.opts.StopTimeout)
+		stop()
+	case s := <-sig:
+		log.Printf("received %v, cancelling in-flight calls", s)
+		stop()
+	}
+	<-stopped
+	<-served
+
+	r.runHooks()
+	log.Printf("server stopped")
+	return nil
+}
+
+func (r *Runner) runHooks() {
+	for _, h := range r.hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), r.opts.HookTimeout)
+		if err := h.fn(ctx); err != nil {
+			log.Printf("shutdown hook %s failed: %v", h.name, err)
+		}
+		cancel()
+	}
+}
+
+// tracker counts the requests being served so a graceful stop can wait for
+// those running on connections http.Server.Shutdown does not track, like
+// hijacked ones.
+type tracker struct {
+	next http.Handler
+
+	mu       sync.Mutex
+	inflight int
+	closing  bool
+	done     chan struct{}
+}
+
+func (t *tracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	t.mu.Lock()
+	if t.closing {
+		t.mu.Unlock()
+		w.Header().Set("Connection", "close")
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	t.inflight++
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.inflight--
+		if t.closing && t.inflight == 0 {
+			close(t.done)
+		}
+		t.mu.Unlock()
+	}()
+	t.next.ServeHTTP(w, req)
+}
+
+// wait refuses new requests and returns once the running ones are done.
+func (t *tracker) wait() {
+	t.mu.Lock()
+	t.closing = true
+	idle := t.inflight == 0
+	t.mu.Unlock()
+	if !idle {
+		<-t.done
+	}
+}
@@ -0,0 +1,131 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/lifecycle/stdhealth"
+	"github.com/cuongpiger/grpc-up-and-running/common/portmux"
+)
+
+func dial(t *testing.T, lis *bufconn.Listener) healthpb.HealthClient {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough://bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestShutdownSequence(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	r := New(s, Options{Health: stdhealth.Register(s), DrainPeriod: 200 * time.Millisecond, StopTimeout: 100 * time.Millisecond})
+	var order []string
+	r.OnShutdown("exporter", func(context.Context) error { order = append(order, "exporter"); return nil })
+	r.OnShutdown("store", func(context.Context) error { order = append(order, "store"); return errors.New("already closed") })
+
+	served := make(chan error, 1)
+	go func() { served <- r.Serve(lis) }()
+
+	client := dial(t, lis)
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Watch = %v, %v; want SERVING", resp, err)
+	}
+
+	start := time.Now()
+	r.Shutdown()
+	if resp, err := stream.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Watch = %v, %v; want NOT_SERVING", resp, err)
+	}
+	// New calls still succeed while draining.
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check during drain: %v", err)
+	}
+
+	// The open Watch stream keeps GracefulStop waiting until the stop
+	// timeout cancels it.
+	if err := <-served; err != nil {
+		t.Fatalf("Serve = %v, want nil", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("shutdown took %v, want drain + stop timeout", elapsed)
+	}
+	if want := []string{"exporter", "store"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("hooks ran as %v, want %v", order, want)
+	}
+}
+
+func TestServeErrorRunsHooks(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	lis.Close()
+	r := New(grpc.NewServer(), Options{})
+	ran := false
+	r.OnShutdown("store", func(context.Context) error { ran = true; return nil })
+	if err := r.Serve(lis); err == nil {
+		t.Fatal("Serve on a closed listener succeeded")
+	}
+	if !ran {
+		t.Error("shutdown hook did not run")
+	}
+}
+
+func TestServeHTTPShutdown(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	r := New(s, Options{Health: stdhealth.Register(s), DrainPeriod: -1, StopTimeout: 200 * time.Millisecond})
+	ran := false
+	r.OnShutdown("gateway", func(context.Context) error { ran = true; return nil })
+	srv := portmux.NewServer(s, http.NotFoundHandler())
+	served := make(chan error, 1)
+	go func() { served <- r.ServeHTTP(srv, lis) }()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Watch = %v, %v; want SERVING", resp, err)
+	}
+
+	// The open Watch stream is cancelled once the stop timeout expires,
+	// rather than making GracefulStop panic on the ServeHTTP transport.
+	r.Shutdown()
+	if resp, err := stream.Recv(); err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Watch = %v, %v; want NOT_SERVING", resp, err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("ServeHTTP = %v, want nil", err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Error("Watch stream survived the shutdown")
+	}
+	if !ran {
+		t.Error("shutdown hook did not run")
+	}
+}
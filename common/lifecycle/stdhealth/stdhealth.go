@@ -0,0 +1,20 @@
+// Package stdhealth registers the standard google.golang.org/grpc/health
+// server for use with a lifecycle.Runner.
+package stdhealth
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Register adds a health service to s reporting SERVING for the server and
+// for every service registered so far, so call it after registering them.
+func Register(s *grpc.Server) *health.Server {
+	h := health.NewServer()
+	for name := range s.GetServiceInfo() {
+		h.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s, h)
+	return h
+}
@@ -0,0 +1,311 @@
+// Package logging provides gRPC server interceptors that emit one structured
+// zap record per RPC. Each record carries the method, peer, duration, status
+// code and request ID, and optionally the incoming metadata and the protobuf
+// payloads rendered as JSON, with sensitive fields masked.
+//
+// The request ID is taken from the context set up by the requestid
+// interceptors, or from the "x-request-id" metadata when they are not
+// installed.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+// Redacted replaces the value of every redacted field or metadata key.
+const Redacted = "[REDACTED]"
+
+// Config controls what the interceptors write to the log.
+type Config struct {
+	// LogPayloads renders request and response messages as JSON. Streaming
+	// messages are logged one by one at debug level.
+	LogPayloads bool
+
+	// LogMetadata adds the incoming metadata to every record.
+	LogMetadata bool
+
+	// RedactFields lists message fields whose values are masked, written as
+	// "<Message>.<field>" (e.g. "Product.price") or fully qualified
+	// (e.g. "ecommerce.Product.price"). They apply inside Any messages too.
+	// The keys of a google.protobuf.Struct are not fields: mask a Struct
+	// by naming the field holding it (e.g. "Auth.claims").
+	RedactFields []string
+
+	// RedactMetadata lists metadata keys whose values are masked
+	// (e.g. "authorization"). Keys are matched case-insensitively.
+	RedactMetadata []string
+}
+
+// Interceptor holds the logger and the compiled redaction rules.
+type Interceptor struct {
+	logger   *zap.Logger
+	cfg      Config
+	fields   map[string]bool
+	metadata map[string]bool
+}
+
+// New creates an Interceptor that writes to logger according to cfg.
+func New(logger *zap.Logger, cfg Config) *Interceptor {
+	i := &Interceptor{
+		logger:   logger,
+		cfg:      cfg,
+		fields:   make(map[string]bool, len(cfg.RedactFields)),
+		metadata: make(map[string]bool, len(cfg.RedactMetadata)),
+	}
+	for _, f := range cfg.RedactFields {
+		i.fields[f] = true
+	}
+	for _, k := range cfg.RedactMetadata {
+		i.metadata[strings.ToLower(k)] = true
+	}
+	return i
+}
+
+// UnaryServerInterceptor logs every unary RPC once it has completed.
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		fields := i.commonFields(ctx, info.FullMethod, start, err)
+		if i.cfg.LogPayloads {
+			fields = append(fields, zap.Any("grpc.request", i.Render(req)))
+			if err == nil {
+				fields = append(fields, zap.Any("grpc.response", i.Render(resp)))
+			}
+		}
+		i.logger.Check(codeToLevel(status.Code(err)), "finished unary call").Write(fields...)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs every streaming RPC once it has completed,
+// together with the number of messages exchanged.
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ws := &wrappedStream{ServerStream: ss, interceptor: i, method: info.FullMethod}
+		err := handler(srv, ws)
+
+		fields := i.commonFields(ss.Context(), info.FullMethod, start, err)
+		fields = append(fields,
+			zap.Int("grpc.msgs_received", ws.received),
+			zap.Int("grpc.msgs_sent", ws.sent))
+		i.logger.Check(codeToLevel(status.Code(err)), "finished streaming call").Write(fields...)
+		return err
+	}
+}
+
+// Render returns m as a JSON-compatible value with the configured fields
+// masked. Values that are not protobuf messages are formatted with %v.
+func (i *Interceptor) Render(m interface{}) interface{} {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("%v", m)
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Sprintf("<unrenderable %T: %v>", m, err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	i.redact(msg.ProtoReflect().Descriptor(), v)
+	return v
+}
+
+// redact walks the JSON value v alongside its descriptor and masks redacted
+// fields in place, descending into nested messages, lists, maps and Any
+// messages.
+func (i *Interceptor) redact(md protoreflect.MessageDescriptor, v interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		// Well-known types such as wrappers render as JSON scalars.
+		return
+	}
+	if md.FullName() == anyName {
+		i.redactAny(obj)
+		return
+	}
+	fields := md.Fields()
+	for n := 0; n < fields.Len(); n++ {
+		fd := fields.Get(n)
+		val, ok := obj[fd.JSONName()]
+		if !ok {
+			continue
+		}
+		if i.isRedactedField(fd) {
+			obj[fd.JSONName()] = Redacted
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if vd := fd.MapValue().Message(); vd != nil {
+				if entries, ok := val.(map[string]interface{}); ok {
+					for _, e := range entries {
+						i.redact(vd, e)
+					}
+				}
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			if elems, ok := val.([]interface{}); ok {
+				for _, e := range elems {
+					i.redact(fd.Message(), e)
+				}
+			}
+		default:
+			i.redact(fd.Message(), val)
+		}
+	}
+}
+
+const anyName protoreflect.FullName = "google.protobuf.Any"
+
+// redactAny redacts the message packed in the Any rendered as obj, whose
+// fields are next to "@type", or under "value" for an Any in an Any. Its
+// type is resolved through the registry protojson rendered it with.
+func (i *Interceptor) redactAny(obj map[string]interface{}) {
+	url, _ := obj["@type"].(string)
+	mt, err := protoregistry.GlobalTypes.FindMessageByURL(url)
+	if err != nil {
+		return
+	}
+	if md := mt.Descriptor(); md.FullName() == anyName {
+		i.redact(md, obj["value"])
+	} else {
+		i.redact(md, obj)
+	}
+}
+
+func (i *Interceptor) isRedactedField(fd protoreflect.FieldDescriptor) bool {
+	if len(i.fields) == 0 {
+		return false
+	}
+	if i.fields[string(fd.FullName())] {
+		return true
+	}
+	return i.fields[string(fd.ContainingMessage().Name())+"."+string(fd.Name())]
+}
+
+// redactMetadata copies md, masking the values of redacted keys.
+func (i *Interceptor) redactMetadata(md metadata.MD) map[string][]string {
+	out := make(map[string][]string, len(md))
+	for k, vs := range md {
+		if i.metadata[k] {
+			out[k] = []string{Redacted}
+			continue
+		}
+		out[k] = vs
+	}
+	return out
+}
+
+func (i *Interceptor) commonFields(ctx context.Context, fullMethod string, start time.Time, err error) []zap.Field {
+	service, method := splitMethod(fullMethod)
+	fields := []zap.Field{
+		zap.String("grpc.service", service),
+		zap.String("grpc.method", method),
+		zap.String("grpc.code", status.Code(err).String()),
+		zap.Duration("grpc.duration", time.Since(start)),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields = append(fields, zap.String("peer.address", p.Addr.String()))
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if id, ok := requestid.FromContext(ctx); ok {
+		fields = append(fields, zap.String("request_id", id))
+	} else if ids := md.Get(requestid.HeaderKey); len(ids) > 0 {
+		fields = append(fields, zap.String("request_id", ids[0]))
+	}
+	if i.cfg.LogMetadata && len(md) > 0 {
+		fields = append(fields, zap.Any("grpc.metadata", i.redactMetadata(md)))
+	}
+	if err != nil {
+		fields = append(fields, zap.String("grpc.error", status.Convert(err).Message()))
+	}
+	return fields
+}
+
+// wrappedStream counts the messages of a stream and, when payload logging is
+// enabled, logs each of them at debug level.
+type wrappedStream struct {
+	grpc.ServerStream
+	interceptor *Interceptor
+	method      string
+	received    int
+	sent        int
+}
+
+func (w *wrappedStream) RecvMsg(m interface{}) error {
+	err := w.ServerStream.RecvMsg(m)
+	if err == nil {
+		w.received++
+		w.logMessage("received stream message", m)
+	}
+	return err
+}
+
+func (w *wrappedStream) SendMsg(m interface{}) error {
+	err := w.ServerStream.SendMsg(m)
+	if err == nil {
+		w.sent++
+		w.logMessage("sent stream message", m)
+	}
+	return err
+}
+
+func (w *wrappedStream) logMessage(msg string, m interface{}) {
+	if !w.interceptor.cfg.LogPayloads {
+		return
+	}
+	if ce := w.interceptor.logger.Check(zapcore.DebugLevel, msg); ce != nil {
+		ce.Write(
+			zap.String("grpc.method", w.method),
+			zap.Any("grpc.message", w.interceptor.Render(m)))
+	}
+}
+
+// splitMethod splits "/package.Service/Method" into its service and method.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", path.Base(fullMethod)
+}
+
+// codeToLevel maps a status code to the level of its log record: client-side
+// problems are warnings, server-side problems are errors.
+func codeToLevel(code codes.Code) zapcore.Level {
+	switch code {
+	case codes.OK:
+		return zapcore.InfoLevel
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.DeadlineExceeded:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
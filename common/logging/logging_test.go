@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/genproto/googleapis/rpc/context/attribute_context"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+func TestRenderRedactsNestedFields(t *testing.T) {
+	i := New(zap.NewNop(), Config{RedactFields: []string{"FieldDescriptorProto.name", "google.protobuf.DescriptorProto.reserved_name"}})
+	msg := &descriptorpb.DescriptorProto{
+		Name:         proto.String("Product"),
+		ReservedName: []string{"secret"},
+		Field: []*descriptorpb.FieldDescriptorProto{
+			{Name: proto.String("price"), Number: proto.Int32(4)},
+		},
+	}
+
+	got := i.Render(msg).(map[string]interface{})
+	if got["name"] != "Product" {
+		t.Errorf("name = %v, want it to be kept", got["name"])
+	}
+	if got["reservedName"] != Redacted {
+		t.Errorf("reservedName = %v, want %q", got["reservedName"], Redacted)
+	}
+	field := got["field"].([]interface{})[0].(map[string]interface{})
+	if field["name"] != Redacted {
+		t.Errorf("field[0].name = %v, want %q", field["name"], Redacted)
+	}
+	if field["number"] != float64(4) {
+		t.Errorf("field[0].number = %v, want 4", field["number"])
+	}
+}
+
+func TestRenderRedactsAnyAndStruct(t *testing.T) {
+	i := New(zap.NewNop(), Config{RedactFields: []string{"FieldDescriptorProto.name", "Auth.claims"}})
+	field, err := anypb.New(&descriptorpb.FieldDescriptorProto{Name: proto.String("secret"), Number: proto.Int32(4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := anypb.New(field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := i.Render(&spb.Status{Code: 3, Details: []*anypb.Any{field, nested}}).(map[string]interface{})
+	details := got["details"].([]interface{})
+	if d := details[0].(map[string]interface{}); d["name"] != Redacted || d["number"] != float64(4) {
+		t.Errorf("details[0] = %v, want the name redacted", d)
+	}
+	if d := details[1].(map[string]interface{})["value"].(map[string]interface{}); d["name"] != Redacted {
+		t.Errorf("details[1].value = %v, want the name redacted", d)
+	}
+
+	claims, err := structpb.NewStruct(map[string]interface{}{"email": "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = i.Render(&attribute_context.AttributeContext_Auth{Principal: "alice", Claims: claims}).(map[string]interface{})
+	if got["claims"] != Redacted || got["principal"] != "alice" {
+		t.Errorf("auth = %v, want only the claims redacted", got)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	i := New(zap.New(core), Config{
+		LogPayloads:    true,
+		LogMetadata:    true,
+		RedactMetadata: []string{"Authorization"},
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer some-secret-token",
+		requestid.HeaderKey, "req-42",
+	))
+	info := &grpc.UnaryServerInfo{FullMethod: "/ecommerce.ProductInfo/getProduct"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "product not found")
+	}
+
+	_, err := i.UnaryServerInterceptor()(ctx, &descriptorpb.DescriptorProto{Name: proto.String("x")}, info, handler)
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("err = %v, want NotFound", err)
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Level != zapcore.WarnLevel {
+		t.Errorf("level = %v, want warn", e.Level)
+	}
+	fields := e.ContextMap()
+	for key, want := range map[string]interface{}{
+		"grpc.service": "ecommerce.ProductInfo",
+		"grpc.method":  "getProduct",
+		"grpc.code":    "NotFound",
+		"request_id":   "req-42",
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %v, want %v", key, fields[key], want)
+		}
+	}
+	md := fields["grpc.metadata"].(map[string][]string)
+	if md["authorization"][0] != Redacted {
+		t.Errorf("authorization = %v, want it redacted", md["authorization"])
+	}
+	if _, ok := fields["grpc.response"]; ok {
+		t.Error("failed call should not log a response")
+	}
+}
@@ -0,0 +1,150 @@
+package portmux
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+)
+
+// IsGRPCWeb reports whether r is a gRPC-Web call, over any HTTP version.
+func IsGRPCWeb(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// serveGRPCWeb translates a gRPC-Web call into a gRPC one served by s, as
+// described in https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md:
+// the request is presented as an HTTP/2 application/grpc request, and the
+// trailers gRPC writes after the messages are sent as a final length-prefixed
+// frame flagged 0x80 in the body, since HTTP/1.1 and browsers cannot read
+// trailers. The -text variant base64-encodes both bodies.
+func serveGRPCWeb(s *grpc.Server, w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2"
+	if text {
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, grpcWebTextContentType))
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{base64.NewDecoder(base64.StdEncoding, r.Body), r.Body}
+		req.ContentLength = -1
+		req.Header.Del("Content-Length")
+	} else {
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, grpcWebContentType))
+	}
+
+	gw := &grpcWebResponse{w: w, header: make(http.Header), contentType: contentType, text: text}
+	s.ServeHTTP(gw, req)
+	gw.finish()
+}
+
+// grpcWebResponse is the http.ResponseWriter given to the gRPC server for a
+// gRPC-Web call.
+type grpcWebResponse struct {
+	w           http.ResponseWriter
+	header      http.Header
+	contentType string
+	text        bool
+	wroteHeader bool
+}
+
+func (g *grpcWebResponse) Header() http.Header { return g.header }
+
+func (g *grpcWebResponse) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	h := g.w.Header()
+	trailers := g.declaredTrailers()
+	for k, vv := range g.header {
+		if k == "Trailer" || trailers[k] || strings.HasPrefix(k, http2.TrailerPrefix) {
+			continue
+		}
+		h[k] = vv
+	}
+	if strings.HasPrefix(g.header.Get("Content-Type"), "application/grpc") {
+		h.Set("Content-Type", g.contentType)
+	}
+	g.w.WriteHeader(code)
+}
+
+func (g *grpcWebResponse) Write(b []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	if g.text {
+		// Every chunk is encoded on its own, with padding, which gRPC-Web
+		// clients decode one after the other.
+		if _, err := io.WriteString(g.w, base64.StdEncoding.EncodeToString(b)); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return g.w.Write(b)
+}
+
+func (g *grpcWebResponse) Flush() {
+	g.WriteHeader(http.StatusOK)
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// declaredTrailers returns the canonical names announced in the Trailer
+// header.
+func (g *grpcWebResponse) declaredTrailers() map[string]bool {
+	declared := make(map[string]bool)
+	for _, v := range g.header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			declared[http.CanonicalHeaderKey(strings.TrimSpace(k))] = true
+		}
+	}
+	return declared
+}
+
+// finish writes the trailers as the final frame of the body.
+func (g *grpcWebResponse) finish() {
+	if !g.wroteHeader {
+		// The request was rejected before reaching a handler.
+		g.WriteHeader(http.StatusOK)
+	}
+	declared := g.declaredTrailers()
+	var lines []string
+	for k, vv := range g.header {
+		name := k
+		switch {
+		case strings.HasPrefix(k, http2.TrailerPrefix):
+			name = strings.TrimPrefix(k, http2.TrailerPrefix)
+		case declared[k]:
+		default:
+			continue
+		}
+		for _, v := range vv {
+			lines = append(lines, strings.ToLower(name)+": "+v+"\r\n")
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+	var frame bytes.Buffer
+	frame.WriteByte(0x80)
+	body := strings.Join(lines, "")
+	binary.Write(&frame, binary.BigEndian, uint32(len(body)))
+	frame.WriteString(body)
+	g.Write(frame.Bytes())
+	g.Flush()
+}
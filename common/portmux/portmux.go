@@ -0,0 +1,80 @@
+// Package portmux serves a gRPC server, to native gRPC and gRPC-Web clients,
+// and plain HTTP handlers, such as a REST gateway, on one port.
+//
+// Requests are told apart by content type: HTTP/2 requests with an
+// application/grpc content type go to the gRPC server through
+// grpc.Server.ServeHTTP, application/grpc-web and application/grpc-web-text
+// requests, which browsers send over any HTTP version, are translated to gRPC
+// for the same server, and every other request goes to the HTTP handler.
+// Cleartext HTTP/2 (h2c) is accepted with prior knowledge, which is how gRPC
+// clients connect without TLS, next to HTTP/1.1. Serving TLSListener instead
+// negotiates h2 or http/1.1 by ALPN.
+//
+// Shutting the returned server down sends GOAWAY on its HTTP/2 connections so
+// they close once their running calls are done; lifecycle.Runner.ServeHTTP
+// waits for them.
+//
+//	srv := portmux.NewServer(s, gateway)
+//	if err := runner.ServeHTTP(srv, lis); err != nil {
+//		log.Fatalf("failed to serve: %v", err)
+//	}
+package portmux
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// IsGRPC reports whether r is a native gRPC call: HTTP/2 with an
+// application/grpc, application/grpc+<codec> or application/grpc;<params>
+// content type. application/grpc-web is not one.
+func IsGRPC(r *http.Request) bool {
+	if r.ProtoMajor != 2 {
+		return false
+	}
+	rest, ok := strings.CutPrefix(r.Header.Get("Content-Type"), "application/grpc")
+	return ok && (rest == "" || rest[0] == '+' || rest[0] == ';')
+}
+
+// NewServer returns an HTTP server routing gRPC and gRPC-Web calls to s and
+// every other request to h, over HTTP/1.1 and cleartext HTTP/2. The wrap
+// middlewares, e.g. a CORS policy, see every request, whatever its protocol,
+// the first one outermost.
+func NewServer(s *grpc.Server, h http.Handler, wrap ...func(http.Handler) http.Handler) *http.Server {
+	srv := &http.Server{}
+	h2s := &http2.Server{}
+	// Registers the graceful shutdown of the HTTP/2 connections, including
+	// the h2c ones, with srv.Shutdown. It only fails on a TLS configuration.
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		panic(err)
+	}
+	var route http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case IsGRPCWeb(r):
+			serveGRPCWeb(s, w, r)
+		case IsGRPC(r):
+			s.ServeHTTP(w, r)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+	for i := len(wrap) - 1; i >= 0; i-- {
+		route = wrap[i](route)
+	}
+	srv.Handler = h2c.NewHandler(route, h2s)
+	return srv
+}
+
+// TLSListener returns lis terminating TLS with cert for srv, a server
+// returned by NewServer, which then serves HTTP/2 to the clients offering h2
+// by ALPN, as gRPC clients do, and HTTP/1.1 to the others.
+func TLSListener(srv *http.Server, lis net.Listener, cert tls.Certificate) net.Listener {
+	srv.TLSConfig.Certificates = append(srv.TLSConfig.Certificates, cert)
+	return tls.NewListener(lis, srv.TLSConfig)
+}
@@ -0,0 +1,248 @@
+package portmux
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSharesPort(t *testing.T) {
+	addr := startServer(t, nil)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Check = %v, %v; want SERVING", resp, err)
+	}
+
+	res, err := http.Get("http://" + addr + "/hello")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer res.Body.Close()
+	if b, _ := io.ReadAll(res.Body); string(b) != "hello HTTP/1.1" {
+		t.Errorf("GET /hello = %q, want %q", b, "hello HTTP/1.1")
+	}
+}
+
+func startServer(t *testing.T, tlsCert *tls.Certificate) string {
+	t.Helper()
+	s := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("ecommerce.ProductInfo", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+	t.Cleanup(s.Stop)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "hello "+r.Proto) })
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(s, mux)
+	addr := lis.Addr().String()
+	if tlsCert != nil {
+		lis = TLSListener(srv, lis, *tlsCert)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Close() })
+	return addr
+}
+
+// grpcWebCall makes a gRPC-Web health check with client to base, e.g.
+// "http://localhost:1234", and returns the response message and trailers.
+func grpcWebCall(t *testing.T, client *http.Client, base, contentType, service string) (*healthpb.HealthCheckResponse, map[string]string) {
+	t.Helper()
+	msg, _ := proto.Marshal(&healthpb.HealthCheckRequest{Service: service})
+	body := append([]byte{0, 0, 0, 0, 0}, msg...)
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	var reqBody io.Reader = bytes.NewReader(body)
+	text := contentType == "application/grpc-web-text"
+	if text {
+		reqBody = strings.NewReader(base64.StdEncoding.EncodeToString(body))
+	}
+	res, err := client.Post(base+"/grpc.health.v1.Health/Check", contentType, reqBody)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(res.Body)
+		t.Fatalf("POST %s over %s: %s %s", contentType, res.Proto, res.Status, b)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != contentType {
+		t.Errorf("Content-Type = %q, want %q", ct, contentType)
+	}
+	raw, _ := io.ReadAll(res.Body)
+	if text {
+		// Every chunk is padded on its own.
+		var decoded []byte
+		for len(raw) > 0 {
+			n := strings.IndexByte(string(raw), '=')
+			end := len(raw)
+			if n >= 0 {
+				end = n
+				for end < len(raw) && raw[end] == '=' {
+					end++
+				}
+			}
+			b, err := base64.StdEncoding.DecodeString(string(raw[:end]))
+			if err != nil {
+				t.Fatalf("decoding %q: %v", raw[:end], err)
+			}
+			decoded, raw = append(decoded, b...), raw[end:]
+		}
+		raw = decoded
+	}
+
+	var resp *healthpb.HealthCheckResponse
+	trailers := make(map[string]string)
+	for len(raw) >= 5 {
+		flag, n := raw[0], binary.BigEndian.Uint32(raw[1:5])
+		frame := raw[5 : 5+n]
+		raw = raw[5+n:]
+		if flag&0x80 == 0 {
+			resp = &healthpb.HealthCheckResponse{}
+			if err := proto.Unmarshal(frame, resp); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(frame)), "\r\n") {
+			k, v, _ := strings.Cut(line, ": ")
+			trailers[k] = v
+		}
+	}
+	return resp, trailers
+}
+
+func TestGRPCWeb(t *testing.T) {
+	addr := startServer(t, nil)
+	for _, ct := range []string{"application/grpc-web", "application/grpc-web+proto", "application/grpc-web-text"} {
+		resp, trailers := grpcWebCall(t, http.DefaultClient, "http://"+addr, ct, "ecommerce.ProductInfo")
+		if resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING || trailers["grpc-status"] != "0" {
+			t.Errorf("%s: Check = %v, trailers %v", ct, resp, trailers)
+		}
+		resp, trailers = grpcWebCall(t, http.DefaultClient, "http://"+addr, ct, "missing")
+		if resp != nil || trailers["grpc-status"] != fmt.Sprint(int(codes.NotFound)) || trailers["grpc-message"] == "" {
+			t.Errorf("%s: Check(missing) = %v, trailers %v; want NOT_FOUND", ct, resp, trailers)
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	cert, pool := selfSigned(t)
+	addr := startServer(t, &cert)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(pool, "localhost")))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Check over TLS = %v, %v; want SERVING", resp, err)
+	}
+
+	for _, h2 := range []bool{false, true} {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: h2}
+		client := &http.Client{Transport: transport}
+		res, err := client.Get("https://" + addr + "/hello")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		want := "hello HTTP/1.1"
+		if h2 {
+			want = "hello HTTP/2.0"
+		}
+		if string(b) != want {
+			t.Errorf("GET /hello = %q, want %q", b, want)
+		}
+
+		// Browsers on HTTPS send gRPC-Web over h2, which must not be taken
+		// for native gRPC.
+		for _, ct := range []string{"application/grpc-web", "application/grpc-web+proto", "application/grpc-web-text"} {
+			resp, trailers := grpcWebCall(t, client, "https://"+addr, ct, "ecommerce.ProductInfo")
+			if resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING || trailers["grpc-status"] != "0" {
+				t.Errorf("%s over %s: Check = %v, trailers %v", ct, want[len("hello "):], resp, trailers)
+			}
+		}
+	}
+}
+
+func TestIsGRPC(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"application/grpc":               true,
+		"application/grpc+proto":         true,
+		"application/grpc;charset=utf-8": true,
+		"application/grpc-web":           false,
+		"application/grpc-web-text":      false,
+		"application/grpcx":              false,
+		"application/json":               false,
+	} {
+		r := &http.Request{ProtoMajor: 2, Header: http.Header{"Content-Type": {ct}}}
+		if got := IsGRPC(r); got != want {
+			t.Errorf("IsGRPC(%s) = %v, want %v", ct, got, want)
+		}
+	}
+}
+
+// selfSigned returns a certificate for localhost and a pool trusting it.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
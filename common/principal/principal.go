@@ -0,0 +1,66 @@
+// Package principal identifies the caller of an RPC from its credentials,
+// for interceptors that record or limit calls per caller such as audit and
+// ratelimit.
+//
+// The identity is, in order of preference, the common name of the verified
+// client certificate, the user name of the basic authorization header or a
+// fingerprint of the bearer token. The user name and token are not checked,
+// so they are labelled as claims, e.g. "claimed-basic:admin": a call rejected
+// for bad credentials, or made to a server without authentication, names
+// whoever the client says. Servers that authenticate callers should use a
+// Func returning the identity their authentication established instead.
+package principal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Func identifies the caller of an RPC.
+type Func func(ctx context.Context) string
+
+// FromContext returns the identity presented by the caller of the RPC of
+// ctx, such as "cert:alice" or "claimed-bearer:3f2a...", or false if it
+// presented none.
+func FromContext(ctx context.Context) (string, bool) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 && len(info.State.VerifiedChains[0]) > 0 {
+			return "cert:" + info.State.VerifiedChains[0][0].Subject.CommonName, true
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if auth := md.Get("authorization"); len(auth) > 0 {
+			scheme, value, _ := strings.Cut(auth[0], " ")
+			switch strings.ToLower(scheme) {
+			case "basic":
+				if b, err := base64.StdEncoding.DecodeString(value); err == nil {
+					user, _, _ := strings.Cut(string(b), ":")
+					return "claimed-basic:" + user, true
+				}
+			case "bearer":
+				sum := sha256.Sum256([]byte(value))
+				return "claimed-bearer:" + hex.EncodeToString(sum[:8]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Default is FromContext falling back to the peer address, e.g.
+// "peer:192.0.2.1:53124", or "unknown" without one.
+func Default(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return "peer:" + p.Addr.String()
+	}
+	return "unknown"
+}
@@ -0,0 +1,46 @@
+package principal
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestDefault(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53124}
+	withAuth := func(ctx context.Context, auth string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", auth))
+	}
+	cert := peer.NewContext(context.Background(), &peer.Peer{Addr: addr, AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "alice"}}}},
+	}}})
+	anon := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	sum := sha256.Sum256([]byte("token"))
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"certificate", withAuth(cert, "Bearer token"), "cert:alice"},
+		{"basic", withAuth(anon, "Basic "+base64.StdEncoding.EncodeToString([]byte("bob:secret"))), "claimed-basic:bob"},
+		{"bearer", withAuth(anon, "Bearer token"), "claimed-bearer:" + hex.EncodeToString(sum[:8])},
+		{"peer", anon, "peer:192.0.2.1:53124"},
+		{"no address", peer.NewContext(context.Background(), &peer.Peer{}), "unknown"},
+		{"no peer", context.Background(), "unknown"},
+	} {
+		if got := Default(tc.ctx); got != tc.want {
+			t.Errorf("%s: Default = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
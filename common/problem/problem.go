@@ -0,0 +1,182 @@
+// Package problem renders gRPC statuses as HTTP problem details (RFC 9457,
+// formerly RFC 7807) for REST front ends of gRPC services.
+//
+// The gRPC code picks the HTTP status (NOT_FOUND is 404, INVALID_ARGUMENT
+// 400, UNAVAILABLE 503, ...) and the status details are flattened into the
+// body: BadRequest field violations, RetryInfo, which also sets the
+// Retry-After header, and ErrorInfo. Other details are kept as JSON Any
+// messages. The request ID of the context is included so a failure reported
+// by a client can be found in the server logs:
+//
+//	{
+//	  "title": "Bad Request",
+//	  "status": 400,
+//	  "detail": "invalid product",
+//	  "code": "INVALID_ARGUMENT",
+//	  "instance": "/v1/product",
+//	  "request_id": "2f4c7d9e-...",
+//	  "field_violations": [{"field": "name", "description": "must not be empty"}]
+//	}
+package problem
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// StatusClientClosedRequest is the non-standard status used for CANCELLED,
+// as the client is gone anyway.
+const StatusClientClosedRequest = 499
+
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           StatusClientClosedRequest,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the HTTP status for c, following the mapping of
+// google.rpc.Code.
+func HTTPStatus(c codes.Code) int {
+	if s, ok := httpStatus[c]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldViolation is a google.rpc.BadRequest field violation.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// ErrorInfo is a google.rpc.ErrorInfo.
+type ErrorInfo struct {
+	Reason   string            `json:"reason"`
+	Domain   string            `json:"domain,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Problem is the body written for a failed call.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Code is the gRPC code name, e.g. NOT_FOUND.
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+
+	FieldViolations []FieldViolation `json:"field_violations,omitempty"`
+	// RetryAfter is the RetryInfo delay, e.g. "1.5s".
+	RetryAfter string          `json:"retry_after,omitempty"`
+	ErrorInfo  *ErrorInfo      `json:"error_info,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+
+	retryAfterSeconds int
+}
+
+// FromStatus returns the problem describing st.
+func FromStatus(st *status.Status) *Problem {
+	s := HTTPStatus(st.Code())
+	p := &Problem{
+		Title:  http.StatusText(s),
+		Status: s,
+		Detail: st.Message(),
+		Code:   code.Code(st.Code()).String(),
+	}
+	if p.Title == "" {
+		p.Title = "Client Closed Request"
+	}
+	var others []json.RawMessage
+	for _, a := range st.Proto().GetDetails() {
+		m, err := a.UnmarshalNew()
+		if err != nil {
+			others = append(others, marshalAny(a))
+			continue
+		}
+		switch d := m.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				p.FieldViolations = append(p.FieldViolations, FieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			delay := d.GetRetryDelay().AsDuration()
+			p.RetryAfter = delay.String()
+			p.retryAfterSeconds = int(math.Ceil(delay.Seconds()))
+		case *errdetails.ErrorInfo:
+			p.ErrorInfo = &ErrorInfo{Reason: d.GetReason(), Domain: d.GetDomain(), Metadata: d.GetMetadata()}
+		default:
+			others = append(others, marshalAny(a))
+		}
+	}
+	if len(others) > 0 {
+		p.Details, _ = json.Marshal(others)
+	}
+	return p
+}
+
+func marshalAny(a *anypb.Any) json.RawMessage {
+	b, err := protojson.Marshal(a)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"@type": a.GetTypeUrl()})
+	}
+	return b
+}
+
+// Write writes the problem describing err in response to r, with the
+// request ID of r's context, if any, and a Retry-After header for a
+// RetryInfo detail.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := FromStatus(status.Convert(err))
+	p.Instance = r.URL.Path
+	if id, ok := requestid.FromContext(r.Context()); ok {
+		p.RequestID = id
+	}
+	p.Write(w)
+}
+
+// Write writes p as the response.
+func (p *Problem) Write(w http.ResponseWriter) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	if p.retryAfterSeconds > 0 {
+		h.Set("Retry-After", strconv.Itoa(p.retryAfterSeconds))
+	}
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
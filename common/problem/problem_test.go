@@ -0,0 +1,90 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/requestid"
+)
+
+func TestWrite(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid product").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "must not be empty"},
+		}},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)},
+		&errdetails.ErrorInfo{Reason: "INVALID_PRODUCT", Domain: "ecommerce"},
+		&errdetails.Help{Links: []*errdetails.Help_Link{{Url: "https://example.com"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/v1/product", nil)
+	req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+	Write(rec, req, st.Err())
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if ra := rec.Header().Get("Retry-After"); ra != "2" {
+		t.Errorf("Retry-After = %q, want 2", ra)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("body %s: %v", rec.Body, err)
+	}
+	want := Problem{
+		Title:           "Bad Request",
+		Status:          400,
+		Detail:          "invalid product",
+		Instance:        "/v1/product",
+		Code:            "INVALID_ARGUMENT",
+		RequestID:       "req-1",
+		FieldViolations: []FieldViolation{{Field: "name", Description: "must not be empty"}},
+		RetryAfter:      "1.5s",
+		ErrorInfo:       &ErrorInfo{Reason: "INVALID_PRODUCT", Domain: "ecommerce"},
+	}
+	details := p.Details
+	p.Details = nil
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("problem = %+v, want %+v", p, want)
+	}
+	var others []map[string]interface{}
+	if err := json.Unmarshal(details, &others); err != nil || len(others) != 1 || others[0]["@type"] != "type.googleapis.com/google.rpc.Help" {
+		t.Errorf("details = %s, want the Help detail", details)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for c, want := range map[codes.Code]int{
+		codes.NotFound:          404,
+		codes.Unauthenticated:   401,
+		codes.PermissionDenied:  403,
+		codes.ResourceExhausted: 429,
+		codes.Unavailable:       503,
+		codes.DeadlineExceeded:  504,
+		codes.Canceled:          499,
+		codes.Unknown:           500,
+		codes.Code(99):          500,
+	} {
+		if got := HTTPStatus(c); got != want {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", c, got, want)
+		}
+	}
+	if p := FromStatus(status.New(codes.Canceled, "")); p.Title != "Client Closed Request" {
+		t.Errorf("title for CANCELLED = %q", p.Title)
+	}
+}
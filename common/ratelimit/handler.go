@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Handler serves the rules of l: GET returns them as JSON and PUT or POST
+// replaces them with a JSON or YAML Config.
+func (l *Limiter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			b, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			c, err := Parse(b)
+			if err == nil {
+				err = l.Update(c)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("rate limits updated: %d rules", len(c.Rules))
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(l.Config())
+	})
+}
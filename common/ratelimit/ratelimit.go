@@ -0,0 +1,431 @@
+// Package ratelimit bounds the load a gRPC server accepts, with token bucket
+// rate limits and concurrency limits declared per method.
+//
+// Each Rule applies to one method, or to every method, and keeps a separate
+// token bucket and in-flight count per key: the method itself, the caller
+// principal or the peer IP. A call is accepted only if every matching rule
+// accepts it; otherwise it fails with codes.ResourceExhausted and an
+// errdetails.RetryInfo telling the client when to retry. Buckets that have
+// refilled are forgotten, so keys only cost memory while they are limited.
+//
+// Rules can be replaced while the server runs with Update, or through the
+// HTTP handler returned by Handler:
+//
+//	curl localhost:7778/ratelimit
+//	curl -X PUT --data-binary @ratelimit.yaml localhost:7778/ratelimit
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/principal"
+)
+
+// KeyBy selects what a rule counts calls by.
+type KeyBy string
+
+const (
+	// ByMethod shares one limit between every caller of the method.
+	ByMethod KeyBy = "method"
+	// ByPrincipal gives each caller its own limit. The limit is only as
+	// good as the PrincipalFunc: a principal the caller merely claims lets
+	// it pick a fresh key for every call.
+	ByPrincipal KeyBy = "principal"
+	// ByPeer gives each client IP address its own limit.
+	ByPeer KeyBy = "peer"
+)
+
+// Rule limits the calls to a method.
+type Rule struct {
+	// Method is the method name, matched case-insensitively whatever its
+	// service like in the audit package, or a full method name such as
+	// "/ecommerce.OrderManagement/processOrders". Empty or "*" matches every
+	// method.
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// By selects the key of the limit. Default ByMethod.
+	By KeyBy `json:"by,omitempty" yaml:"by,omitempty"`
+	// Rate is the sustained number of calls per second per key. Zero
+	// disables the rate limit.
+	Rate float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	// Burst is the number of calls accepted at once above Rate. Default
+	// Rate rounded up, at least 1.
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// MaxConcurrent is the number of calls, or streams, in flight per key.
+	// Zero disables the concurrency limit.
+	MaxConcurrent int `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty"`
+	// RetryDelay is the retry delay suggested to calls rejected by the
+	// concurrency limit. Default 1s.
+	RetryDelay Duration `json:"retryDelay,omitempty" yaml:"retryDelay,omitempty"`
+}
+
+// Config is the set of rules of a Limiter.
+type Config struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Validate reports the first invalid rule of c.
+func (c Config) Validate() error {
+	for i, r := range c.Rules {
+		switch r.By {
+		case "", ByMethod, ByPrincipal, ByPeer:
+		default:
+			return fmt.Errorf("rule %d: unknown key %q, want method, principal or peer", i, r.By)
+		}
+		if r.Rate < 0 || r.Burst < 0 || r.MaxConcurrent < 0 || r.RetryDelay < 0 {
+			return fmt.Errorf("rule %d: negative limit", i)
+		}
+		if r.Rate == 0 && r.MaxConcurrent == 0 {
+			return fmt.Errorf("rule %d: neither rate nor maxConcurrent is set", i)
+		}
+	}
+	return nil
+}
+
+// Parse parses and validates a Config in JSON or YAML.
+func Parse(b []byte) (Config, error) {
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+// Load reads and validates a Config file in JSON or YAML.
+func Load(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// PrincipalFunc identifies the caller of an RPC. For ByPrincipal limits to
+// hold it must return identities the server authenticated, such as the
+// subject of a verified client certificate, not names the client sends.
+type PrincipalFunc = principal.Func
+
+// DefaultPrincipal is principal.FromContext falling back to the peer IP,
+// without the port, as every connection of a client has its own. The basic
+// user names and bearer tokens it accepts are not verified: use it only
+// behind interceptors rejecting invalid credentials.
+func DefaultPrincipal(ctx context.Context) string {
+	if id, ok := principal.FromContext(ctx); ok {
+		return id
+	}
+	return peerKey(ctx)
+}
+
+// peerKey returns "peer:" and the IP of the caller.
+func peerKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "peer:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "peer:" + host
+}
+
+// sweepInterval is how often buckets that have refilled are dropped.
+const sweepInterval = time.Minute
+
+// Limiter enforces a Config.
+type Limiter struct {
+	principal PrincipalFunc
+	now       func() time.Time
+
+	mu      sync.Mutex
+	config  Config
+	buckets map[limitKey]*bucket
+	swept   time.Time
+	// inflight counts calls in flight by rule, method and key. It is kept
+	// across Update so calls accepted under rules that did not change are
+	// still counted.
+	inflight map[limitKey]int
+}
+
+// limitKey identifies a bucket or in-flight count by the content of its
+// rule, so Update keeps the state of the rules it does not change.
+type limitKey struct {
+	rule   Rule
+	method string
+	key    string
+}
+
+// New returns a Limiter enforcing c. A nil identify uses DefaultPrincipal.
+func New(c Config, identify PrincipalFunc) (*Limiter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if identify == nil {
+		identify = DefaultPrincipal
+	}
+	return &Limiter{
+		principal: identify,
+		now:       time.Now,
+		config:    c,
+		buckets:   make(map[limitKey]*bucket),
+		inflight:  make(map[limitKey]int),
+	}, nil
+}
+
+// Config returns the rules in force.
+func (l *Limiter) Config() Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Config{Rules: append([]Rule(nil), l.config.Rules...)}
+}
+
+// Update replaces the rules. Rules present before keep their token buckets
+// and in-flight counts; new and changed ones start with full buckets.
+func (l *Limiter) Update(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = c
+	kept := make(map[Rule]bool)
+	for _, r := range c.Rules {
+		kept[r] = true
+	}
+	for k := range l.buckets {
+		if !kept[k.rule] {
+			delete(l.buckets, k)
+		}
+	}
+	return nil
+}
+
+func (r Rule) matches(fullMethod string) bool {
+	switch {
+	case r.Method == "" || r.Method == "*":
+		return true
+	case strings.HasPrefix(r.Method, "/"):
+		return r.Method == fullMethod
+	}
+	return strings.EqualFold(r.Method, path.Base(fullMethod))
+}
+
+func (l *Limiter) key(ctx context.Context, by KeyBy) string {
+	switch by {
+	case ByPrincipal:
+		return "principal:" + l.principal(ctx)
+	case ByPeer:
+		return peerKey(ctx)
+	}
+	return "method"
+}
+
+// acquire admits a call, returning the function to call once it is done, or
+// rejects it with a ResourceExhausted error.
+func (l *Limiter) acquire(ctx context.Context, fullMethod string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Identical rules share their state and are applied once.
+	var matches []limitKey
+	seen := make(map[limitKey]bool)
+	for _, r := range l.config.Rules {
+		if !r.matches(fullMethod) {
+			continue
+		}
+		k := limitKey{rule: r, method: fullMethod, key: l.key(ctx, r.By)}
+		if !seen[k] {
+			seen[k] = true
+			matches = append(matches, k)
+		}
+	}
+
+	// Check every limit before taking anything, so a rejected call does not
+	// consume tokens of the rules that would have accepted it.
+	now := l.now()
+	l.sweep(now)
+	for _, m := range matches {
+		if m.rule.MaxConcurrent > 0 && l.inflight[m] >= m.rule.MaxConcurrent {
+			delay := time.Duration(m.rule.RetryDelay)
+			if delay == 0 {
+				delay = time.Second
+			}
+			return nil, exhausted(delay, "too many concurrent calls to %s (limit %d per %s)", fullMethod, m.rule.MaxConcurrent, by(m.rule))
+		}
+		if m.rule.Rate > 0 {
+			if wait := l.bucket(m, now).wait(now); wait > 0 {
+				return nil, exhausted(wait, "rate limit of %s exceeded (%g calls/s per %s)", fullMethod, m.rule.Rate, by(m.rule))
+			}
+		}
+	}
+	var keys []limitKey
+	for _, m := range matches {
+		if m.rule.Rate > 0 {
+			l.bucket(m, now).take()
+		}
+		if m.rule.MaxConcurrent > 0 {
+			l.inflight[m]++
+			keys = append(keys, m)
+		}
+	}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, k := range keys {
+			if l.inflight[k]--; l.inflight[k] <= 0 {
+				delete(l.inflight, k)
+			}
+		}
+	}, nil
+}
+
+func by(r Rule) KeyBy {
+	if r.By == "" {
+		return ByMethod
+	}
+	return r.By
+}
+
+func exhausted(retryDelay time.Duration, format string, args ...interface{}) error {
+	st := status.Newf(codes.ResourceExhausted, format, args...)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func (l *Limiter) bucket(k limitKey, now time.Time) *bucket {
+	b, ok := l.buckets[k]
+	if !ok {
+		burst := k.rule.Burst
+		if burst == 0 {
+			burst = int(math.Max(1, math.Ceil(k.rule.Rate)))
+		}
+		b = &bucket{rate: k.rule.Rate, burst: float64(burst), tokens: float64(burst), last: now}
+		l.buckets[k] = b
+	}
+	return b
+}
+
+// sweep drops, at most once per sweepInterval, the buckets that are full
+// again: a new bucket would behave the same. This bounds the buckets to the
+// keys seen while they refill, however many keys callers make up.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for k, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// bucket is a token bucket holding up to burst tokens, refilled at rate
+// tokens per second.
+type bucket struct {
+	rate, burst, tokens float64
+	last                time.Time
+}
+
+// wait refills the bucket and returns how long until it holds a token.
+func (b *bucket) wait(now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled by now.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+func (b *bucket) take() {
+	b.tokens--
+}
+
+// UnaryServerInterceptor rejects the unary calls exceeding a limit.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		release, err := l.acquire(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects the streams exceeding a limit. A stream
+// counts against MaxConcurrent until it ends.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := l.acquire(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, ss)
+	}
+}
+
+// Duration is a time.Duration written as a string such as "500ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"500ms\": %s", b)
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	return d.parse(n.Value)
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,279 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func setup(t *testing.T, c Config) (*Limiter, *fakeClock, healthpb.HealthClient) {
+	t.Helper()
+	l, err := New(c, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l.now = clock.Now
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(l.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(l.StreamServerInterceptor()))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return l, clock, healthpb.NewHealthClient(conn)
+}
+
+func check(client healthpb.HealthClient, token string) error {
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+// retryDelay returns the RetryInfo delay of a ResourceExhausted error.
+func retryDelay(t *testing.T, err error) time.Duration {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("error = %v, want ResourceExhausted", err)
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	t.Fatalf("error %v has no RetryInfo", err)
+	return 0
+}
+
+func TestRateLimitByMethod(t *testing.T) {
+	_, clock, client := setup(t, Config{Rules: []Rule{{Method: "check", Rate: 1, Burst: 2}}})
+	for i := 0; i < 2; i++ {
+		if err := check(client, ""); err != nil {
+			t.Fatalf("call %d within the burst: %v", i, err)
+		}
+	}
+	err := check(client, "")
+	if d := retryDelay(t, err); d != time.Second {
+		t.Errorf("retry delay = %v, want 1s", d)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if d := retryDelay(t, check(client, "")); d != 500*time.Millisecond {
+		t.Errorf("retry delay = %v, want 500ms", d)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if err := check(client, ""); err != nil {
+		t.Fatalf("call after the refill: %v", err)
+	}
+}
+
+func TestRateLimitByPrincipal(t *testing.T) {
+	_, _, client := setup(t, Config{Rules: []Rule{{By: ByPrincipal, Rate: 1}}})
+	if err := check(client, "alice"); err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	if err := check(client, "bob"); err != nil {
+		t.Fatalf("bob has his own bucket: %v", err)
+	}
+	retryDelay(t, check(client, "alice"))
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	_, _, client := setup(t, Config{Rules: []Rule{
+		{Method: "/grpc.health.v1.Health/Watch", MaxConcurrent: 2, RetryDelay: Duration(200 * time.Millisecond)},
+	}})
+	watch := func() (context.CancelFunc, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		return cancel, err
+	}
+
+	var cancels []context.CancelFunc
+	for i := 0; i < 2; i++ {
+		cancel, err := watch()
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		defer cancel()
+		cancels = append(cancels, cancel)
+	}
+	_, err := watch()
+	if d := retryDelay(t, err); d != 200*time.Millisecond {
+		t.Errorf("retry delay = %v, want 200ms", d)
+	}
+	// Unary calls are not limited by the rule.
+	if err := check(client, ""); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	// Ending a stream frees its slot.
+	cancels[0]()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cancel, err := watch()
+		if err == nil {
+			cancel()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream still rejected after another ended: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpdateAtRuntime(t *testing.T) {
+	l, _, client := setup(t, Config{})
+	for i := 0; i < 5; i++ {
+		if err := check(client, ""); err != nil {
+			t.Fatalf("unlimited call %d: %v", i, err)
+		}
+	}
+
+	srv := httptest.NewServer(l.Handler())
+	defer srv.Close()
+	put := func(body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := put("rules:\n  - method: check\n    rate: 1\n"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT = %s", resp.Status)
+	}
+	if err := check(client, ""); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	retryDelay(t, check(client, ""))
+
+	for _, bad := range []string{"rules:\n  - method: check\n", "rules:\n  - rate: 1\n    by: country\n", "rules:\n  - rate: 1\n    burts: 3\n"} {
+		if resp := put(bad); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("PUT %q = %s, want 400", bad, resp.Status)
+		}
+	}
+	if got := l.Config(); len(got.Rules) != 1 || got.Rules[0].Rate != 1 {
+		t.Errorf("Config after rejected updates = %+v", got)
+	}
+}
+
+func TestUpdateKeepsState(t *testing.T) {
+	unchanged := Rule{Method: "check", Rate: 1}
+	l, clock, client := setup(t, Config{Rules: []Rule{unchanged}})
+	if err := check(client, ""); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if err := l.Update(Config{Rules: []Rule{{Method: "watch", MaxConcurrent: 1}, unchanged}}); err != nil {
+		t.Fatal(err)
+	}
+	// The rule moved but did not change: its bucket is still empty.
+	retryDelay(t, check(client, ""))
+
+	if err := l.Update(Config{Rules: []Rule{{Method: "check", Rate: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := check(client, ""); err != nil {
+			t.Fatalf("call %d under the changed rule: %v", i, err)
+		}
+	}
+	retryDelay(t, check(client, ""))
+
+	clock.Advance(time.Second)
+	if err := check(client, ""); err != nil {
+		t.Fatalf("call after the refill: %v", err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l, clock, client := setup(t, Config{Rules: []Rule{{By: ByPrincipal, Rate: 1, Burst: 2}}})
+	for i := 0; i < 50; i++ {
+		if err := check(client, fmt.Sprint("token-", i)); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	clock.Advance(sweepInterval - time.Second)
+	check(client, "kept")
+	check(client, "kept")
+	clock.Advance(time.Second)
+	// The first buckets have refilled, the kept one holds a single token.
+	if err := check(client, "kept"); err != nil {
+		t.Fatalf("kept: %v", err)
+	}
+	retryDelay(t, check(client, "kept"))
+	l.mu.Lock()
+	n := len(l.buckets)
+	l.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d buckets after the sweep, want 1", n)
+	}
+}
+
+func TestDefaultPrincipal(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	if got := DefaultPrincipal(ctx); got != "peer:192.0.2.1" {
+		t.Errorf("DefaultPrincipal = %q, want peer:192.0.2.1", got)
+	}
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Basic YWxpY2U6c2VjcmV0"))
+	if got := DefaultPrincipal(ctx); got != "claimed-basic:alice" {
+		t.Errorf("DefaultPrincipal = %q, want claimed-basic:alice", got)
+	}
+	ctx = peer.NewContext(context.Background(), &peer.Peer{})
+	if got := DefaultPrincipal(ctx); got != "peer:unknown" {
+		t.Errorf("DefaultPrincipal without an address = %q, want peer:unknown", got)
+	}
+}
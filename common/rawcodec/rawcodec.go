@@ -0,0 +1,56 @@
+// Package rawcodec sends and receives gRPC messages as bytes, without
+// knowing their type, for proxies forwarding calls and for replaying
+// recorded ones.
+//
+// Pass Codec with grpc.ForceCodec on the client, or grpc.ForceServerCodec
+// on the server, and send and receive *Frame values:
+//
+//	cs, err := conn.NewStream(ctx, desc, method, grpc.ForceCodec(rawcodec.Codec{}))
+//	err = cs.SendMsg(&rawcodec.Frame{Payload: b})
+package rawcodec
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// Frame is a message sent or received as is.
+type Frame struct {
+	Payload []byte
+}
+
+// Codec passes frames through untouched and encodes every other message,
+// e.g. of the health and reflection services a proxy serves itself, as
+// protobuf. It keeps the "proto" name so that the content type on the wire
+// stays application/grpc.
+type Codec struct{}
+
+var _ encoding.Codec = Codec{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case *Frame:
+		return m.Payload, nil
+	case proto.Message:
+		return proto.Marshal(m)
+	default:
+		return nil, fmt.Errorf("rawcodec: cannot marshal %T", v)
+	}
+}
+
+func (Codec) Unmarshal(data []byte, v any) error {
+	switch m := v.(type) {
+	case *Frame:
+		// data is only valid until Unmarshal returns.
+		m.Payload = append([]byte(nil), data...)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	default:
+		return fmt.Errorf("rawcodec: cannot unmarshal into %T", v)
+	}
+}
+
+func (Codec) Name() string { return "proto" }
@@ -0,0 +1,36 @@
+package rawcodec
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	msg := wrapperspb.String("102")
+	b, err := (Codec{}).Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal(message): %v", err)
+	}
+
+	// A frame keeps a copy of the received bytes and sends them as is.
+	var f Frame
+	if err := (Codec{}).Unmarshal(b, &f); err != nil {
+		t.Fatalf("Unmarshal(frame): %v", err)
+	}
+	want := bytes.Clone(b)
+	clear(b)
+	if out, err := (Codec{}).Marshal(&f); err != nil || !bytes.Equal(out, want) {
+		t.Fatalf("Marshal(frame) = %x, %v; want %x", out, err, want)
+	}
+	var got wrapperspb.StringValue
+	if err := (Codec{}).Unmarshal(f.Payload, &got); err != nil || !proto.Equal(&got, msg) {
+		t.Errorf("Unmarshal(message) = %v, %v; want %v", &got, err, msg)
+	}
+
+	if _, err := (Codec{}).Marshal("102"); err == nil {
+		t.Error("Marshal(string) succeeded")
+	}
+}
@@ -0,0 +1,192 @@
+package recording
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultRedact are the metadata keys whose values are not recorded.
+var DefaultRedact = []string{"authorization", "cookie"}
+
+// DefaultExclude are the services of gRPC itself, not worth replaying.
+var DefaultExclude = []string{"/grpc.reflection.", "/grpc.health.", "/grpc.channelz."}
+
+// Options select the calls a Recorder records.
+type Options struct {
+	// Methods are prefixes of the full method names recorded, such as
+	// "/ecommerce.OrderManagement/". Empty records every method.
+	Methods []string
+	// Exclude are prefixes of full method names never recorded. Nil uses
+	// DefaultExclude.
+	Exclude []string
+	// Every records one call in Every of the selected ones; 0 or 1 records
+	// them all.
+	Every int
+	// Redact are metadata keys whose values are replaced by REDACTED. Nil
+	// uses DefaultRedact; an empty, non-nil slice records every value.
+	Redact []string
+}
+
+// Recorder records calls to a File.
+type Recorder struct {
+	file   *File
+	opts   Options
+	redact map[string]bool
+	seen   atomic.Uint64
+}
+
+// NewRecorder returns a Recorder writing the calls selected by opts to f.
+func NewRecorder(f *File, opts Options) *Recorder {
+	if opts.Redact == nil {
+		opts.Redact = DefaultRedact
+	}
+	if opts.Exclude == nil {
+		opts.Exclude = DefaultExclude
+	}
+	r := &Recorder{file: f, opts: opts, redact: make(map[string]bool)}
+	for _, k := range opts.Redact {
+		r.redact[strings.ToLower(k)] = true
+	}
+	return r
+}
+
+func (r *Recorder) selected(method string) bool {
+	if hasPrefix(method, r.opts.Exclude) || len(r.opts.Methods) > 0 && !hasPrefix(method, r.opts.Methods) {
+		return false
+	}
+	return r.opts.Every <= 1 || (r.seen.Add(1)-1)%uint64(r.opts.Every) == 0
+}
+
+func hasPrefix(method string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(method, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor records the selected unary calls once they
+// complete.
+func (r *Recorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !r.selected(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		c := r.begin(ctx, info.FullMethod)
+		c.add(&c.Requests, req)
+		resp, err := handler(ctx, req)
+		if err == nil {
+			c.add(&c.Responses, resp)
+		}
+		r.end(c, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records the selected streaming calls once they
+// complete, with every message received and sent.
+func (r *Recorder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !r.selected(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		c := r.begin(ss.Context(), info.FullMethod)
+		c.ClientStreams, c.ServerStreams = info.IsClientStream, info.IsServerStream
+		err := handler(srv, &recordingStream{ServerStream: ss, call: c})
+		r.end(c, err)
+		return err
+	}
+}
+
+// recordingCall is a Call being recorded. Handlers may send and receive
+// from different goroutines, hence the lock.
+type recordingCall struct {
+	mu sync.Mutex
+	// began keeps the monotonic clock reading that Start, in UTC, lost.
+	began time.Time
+	Call
+}
+
+func (r *Recorder) begin(ctx context.Context, method string) *recordingCall {
+	now := time.Now()
+	c := &recordingCall{began: now, Call: Call{Method: method, Start: now.UTC()}}
+	if d, ok := ctx.Deadline(); ok {
+		c.Timeout = time.Until(d)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		if strings.HasPrefix(k, ":") || k == "content-type" {
+			continue
+		}
+		if c.Metadata == nil {
+			c.Metadata = make(map[string][]string)
+		}
+		for _, v := range vs {
+			switch {
+			case r.redact[k]:
+				v = "REDACTED"
+			case strings.HasSuffix(k, "-bin"):
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			c.Metadata[k] = append(c.Metadata[k], v)
+		}
+	}
+	return c
+}
+
+func (c *recordingCall) add(to *[]Message, m interface{}) {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(pm)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*to = append(*to, Message{Offset: time.Since(c.began), Data: b})
+}
+
+func (r *Recorder) end(c *recordingCall, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Duration = time.Since(c.began)
+	st := status.Convert(err)
+	c.Code, c.Error = st.Code().String(), st.Message()
+	if err := r.file.Write(&c.Call); err != nil {
+		log.Printf("recording: failed to record %s: %v", c.Method, err)
+	}
+}
+
+type recordingStream struct {
+	grpc.ServerStream
+	call *recordingCall
+}
+
+func (s *recordingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.call.add(&s.call.Requests, m)
+	}
+	return err
+}
+
+func (s *recordingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.call.add(&s.call.Responses, m)
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+// Package recording captures the RPCs served by a server into a file and
+// replays them against another one, for checking a new server version
+// against production traffic.
+//
+// A recording holds one JSON line per completed call:
+//
+//	{
+//	  "method": "/ecommerce.OrderManagement/searchOrders",
+//	  "server_streams": true,
+//	  "start": "2026-10-19T09:12:03.211Z",
+//	  "duration_ns": 1830000,
+//	  "timeout_ns": 10000000000,
+//	  "metadata": {"x-request-id": ["4f6c..."], "authorization": ["REDACTED"]},
+//	  "requests": [{"offset_ns": 0, "data": "CgZHb29nbGU="}],
+//	  "responses": [{"offset_ns": 910000, "data": "CgMxMDIS..."}, ...],
+//	  "code": "OK"
+//	}
+//
+// client_streams and server_streams give the kind of the method and are
+// omitted when false, like requests and responses when there are none.
+// Messages are stored in their protobuf binary encoding, base64 in JSON,
+// with offset_ns counted from start; duration_ns is the time the handler
+// took and timeout_ns the deadline left to the call when it arrived, omitted
+// when it had none. Pseudo headers and content-type are not recorded, values
+// of binary (-bin) metadata are base64 and the values of redacted keys are
+// replaced by REDACTED. code is the status code name and error its message,
+// omitted when empty.
+//
+// The Recorder interceptors write recordings; Read reads them and a Replayer
+// sends the calls again and reports how the responses differ.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Call is one recorded RPC.
+type Call struct {
+	Method        string              `json:"method"`
+	ClientStreams bool                `json:"client_streams,omitempty"`
+	ServerStreams bool                `json:"server_streams,omitempty"`
+	Start         time.Time           `json:"start"`
+	Duration      time.Duration       `json:"duration_ns"`
+	Timeout       time.Duration       `json:"timeout_ns,omitempty"`
+	Metadata      map[string][]string `json:"metadata,omitempty"`
+	Requests      []Message           `json:"requests,omitempty"`
+	Responses     []Message           `json:"responses,omitempty"`
+	Code          string              `json:"code"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// Message is a request or response message of a Call.
+type Message struct {
+	Offset time.Duration `json:"offset_ns"`
+	Data   []byte        `json:"data"`
+}
+
+// maxLine bounds the size of a recorded call.
+const maxLine = 64 << 20
+
+// File appends recorded calls to a file.
+type File struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Create opens the recording at path for appending, creating it if needed.
+func Create(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f}, nil
+}
+
+// Write appends c to the file at once, so a server that stops without
+// closing the recording loses none of the calls it completed.
+func (f *File) Write(c *Call) error {
+	line, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.f.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// Read calls fn with each call of the recording in r, in the order they
+// completed, and stops at the first error.
+func Read(r io.Reader, fn func(*Call) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		c := &Call{}
+		if err := json.Unmarshal(scanner.Bytes(), c); err != nil {
+			return fmt.Errorf("line %d: malformed call: %w", line, err)
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
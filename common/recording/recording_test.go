@@ -0,0 +1,331 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/dynamic"
+)
+
+// testServer answers as version; version 2 changes the unary response and
+// sends stream responses in reverse order.
+type testServer struct {
+	testpb.UnimplementedTestServiceServer
+	version int
+}
+
+func (s *testServer) UnaryCall(ctx context.Context, in *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	if st := in.GetResponseStatus(); st != nil {
+		return nil, status.Error(codes.Code(st.GetCode()), st.GetMessage())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	resp := &testpb.SimpleResponse{Payload: in.GetPayload(), Username: strings.Join(md.Get("x-user"), ",")}
+	if s.version == 2 {
+		resp.Hostname = "v2"
+	}
+	return resp, nil
+}
+
+func (s *testServer) StreamingOutputCall(in *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	params := in.GetResponseParameters()
+	for i := range params {
+		p := params[i]
+		if s.version == 2 {
+			p = params[len(params)-1-i]
+		}
+		body := []byte(strings.Repeat("x", int(p.GetSize())))
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: body}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testServer) StreamingInputCall(stream testpb.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(in.GetPayload().GetBody()))
+	}
+}
+
+func (s *testServer) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: in.GetPayload()}); err != nil {
+			return err
+		}
+	}
+}
+
+// serve starts a test server of the given version, recording into rec when
+// it is not nil, and returns a connection to it.
+func serve(t *testing.T, version int, rec *Recorder) *grpc.ClientConn {
+	t.Helper()
+	var opts []grpc.ServerOption
+	if rec != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(rec.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(rec.StreamServerInterceptor()))
+	}
+	s := grpc.NewServer(opts...)
+	testpb.RegisterTestServiceServer(s, &testServer{version: version})
+	reflection.Register(s)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// record makes one call of every kind through a recording server and
+// returns the recorded calls.
+func record(t *testing.T) []*Call {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	f, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := testpb.NewTestServiceClient(serve(t, 1, NewRecorder(f, Options{})))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret", "x-user", "alice", "trace-bin", "\x00\xff")
+
+	if _, err := client.UnaryCall(ctx, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("hi")}}); err != nil {
+		t.Fatal(err)
+	}
+	client.UnaryCall(ctx, &testpb.SimpleRequest{ResponseStatus: &testpb.EchoStatus{Code: int32(codes.NotFound), Message: "no such order"}})
+	out, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{Size: 1}, {Size: 2}, {Size: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := out.Recv(); err == nil; _, err = out.Recv() {
+	}
+	in, err := client.StreamingInputCall(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte("ab")}})
+	in.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte("cde")}})
+	if _, err := in.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	bidi, err := client.FullDuplexCall(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bidi.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte("x")}})
+	bidi.Recv()
+	bidi.CloseSend()
+	for _, err := bidi.Recv(); err == nil; _, err = bidi.Recv() {
+	}
+
+	// Calls are written when their handler returns; wait for the last one.
+	// The file is read while still open, as after a crash.
+	time.Sleep(100 * time.Millisecond)
+	defer f.Close()
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var calls []*Call
+	if err := Read(r, func(c *Call) error { calls = append(calls, c); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	return calls
+}
+
+func TestRecord(t *testing.T) {
+	calls := record(t)
+	if len(calls) != 5 {
+		t.Fatalf("recorded %d calls, want 5", len(calls))
+	}
+
+	unary := calls[0]
+	if unary.Method != "/grpc.testing.TestService/UnaryCall" || unary.ClientStreams || unary.ServerStreams || unary.Code != "OK" {
+		t.Errorf("unary call = %+v", unary)
+	}
+	if unary.Timeout <= 0 || unary.Timeout > time.Minute || unary.Duration <= 0 {
+		t.Errorf("timing = timeout %v, duration %v", unary.Timeout, unary.Duration)
+	}
+	md := unary.Metadata
+	if md["authorization"][0] != "REDACTED" || md["x-user"][0] != "alice" || md["trace-bin"][0] != "AP8=" {
+		t.Errorf("metadata = %v, want authorization redacted and trace-bin in base64", md)
+	}
+	if _, ok := md[":authority"]; ok {
+		t.Errorf("metadata = %v, want no pseudo headers", md)
+	}
+	req := &testpb.SimpleRequest{}
+	if len(unary.Requests) != 1 || proto.Unmarshal(unary.Requests[0].Data, req) != nil || string(req.GetPayload().GetBody()) != "hi" {
+		t.Errorf("requests = %v", unary.Requests)
+	}
+	if len(unary.Responses) != 1 {
+		t.Errorf("responses = %v", unary.Responses)
+	}
+
+	if failed := calls[1]; failed.Code != "NotFound" || failed.Error != "no such order" || len(failed.Responses) != 0 {
+		t.Errorf("failed call = %+v", failed)
+	}
+	if s := calls[2]; !s.ServerStreams || s.ClientStreams || len(s.Responses) != 3 {
+		t.Errorf("server stream = %+v", s)
+	}
+	if s := calls[3]; !s.ClientStreams || s.ServerStreams || len(s.Requests) != 2 || len(s.Responses) != 1 {
+		t.Errorf("client stream = %+v", s)
+	}
+	if s := calls[4]; !s.ClientStreams || !s.ServerStreams || len(s.Requests) != 1 || len(s.Responses) != 1 {
+		t.Errorf("bidi stream = %+v", s)
+	}
+	for _, c := range calls {
+		for _, m := range c.Responses {
+			if m.Offset < 0 || m.Offset > c.Duration {
+				t.Errorf("%s: response offset %v outside the call (%v)", c.Method, m.Offset, c.Duration)
+			}
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	calls := record(t)
+
+	// The same server version answers the same, redacted credentials or not.
+	conn := serve(t, 1, nil)
+	same := NewReplayer(conn, ReplayOptions{Resolver: dynamic.NewResolver(conn)})
+	for _, c := range calls {
+		res, err := same.Replay(context.Background(), c)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Method, err)
+		}
+		if len(res.Mismatches) > 0 {
+			t.Errorf("%s: mismatches against the same version: %v", c.Method, res.Mismatches)
+		}
+	}
+
+	conn = serve(t, 2, nil)
+	v2 := NewReplayer(conn, ReplayOptions{Resolver: dynamic.NewResolver(conn)})
+	res, err := v2.Replay(context.Background(), calls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Mismatches) != 1 || !strings.Contains(res.Mismatches[0], `"hostname":"v2"`) {
+		t.Errorf("unary mismatches = %v, want the new hostname shown as JSON", res.Mismatches)
+	}
+	if res, _ := v2.Replay(context.Background(), calls[2]); len(res.Mismatches) != 2 {
+		t.Errorf("reordered stream mismatches = %v, want 2", res.Mismatches)
+	}
+
+	ignoring := NewReplayer(conn, ReplayOptions{Resolver: dynamic.NewResolver(conn), Ignore: []string{"hostname"}, Unordered: true})
+	for _, c := range calls {
+		if res, _ := ignoring.Replay(context.Background(), c); len(res.Mismatches) > 0 {
+			t.Errorf("%s: mismatches with ignored fields and unordered streams: %v", c.Method, res.Mismatches)
+		}
+	}
+
+	// Without descriptors the encoded responses are compared.
+	raw := NewReplayer(conn, ReplayOptions{})
+	if res, _ := raw.Replay(context.Background(), calls[0]); len(res.Mismatches) != 1 || !strings.Contains(res.Mismatches[0], "bytes") {
+		t.Errorf("raw mismatches = %v", res.Mismatches)
+	}
+}
+
+func TestReplayStatusAndMetadata(t *testing.T) {
+	calls := record(t)
+	conn := serve(t, 1, nil)
+	r := NewReplayer(conn, ReplayOptions{Metadata: metadata.Pairs("x-user", "bob")})
+
+	// The unary call echoes x-user back, now replaced.
+	res, err := r.Replay(context.Background(), calls[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Mismatches) != 1 || !strings.HasPrefix(res.Mismatches[0], "response 0") {
+		t.Errorf("mismatches = %v, want the username to differ", res.Mismatches)
+	}
+
+	c := *calls[1]
+	c.Error = "order missing"
+	if res, _ := r.Replay(context.Background(), &c); len(res.Mismatches) != 1 || !strings.HasPrefix(res.Mismatches[0], "error: ") {
+		t.Errorf("mismatches = %v, want the error message to differ", res.Mismatches)
+	}
+	c.Code = "OK"
+	if res, _ := r.Replay(context.Background(), &c); len(res.Mismatches) != 1 ||
+		res.Mismatches[0] != `status: recorded OK "order missing", replayed NotFound "no such order"` {
+		t.Errorf("mismatches = %v, want the status to differ", res.Mismatches)
+	}
+
+	c = *calls[0]
+	c.Metadata = map[string][]string{"trace-bin": {"not base64!"}}
+	if _, err := r.Replay(context.Background(), &c); err == nil {
+		t.Error("Replay with invalid binary metadata succeeded")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	r := NewRecorder(nil, Options{Methods: []string{"/ecommerce.OrderManagement/"}, Every: 3})
+	var recorded int
+	for i := 0; i < 9; i++ {
+		if r.selected("/ecommerce.OrderManagement/getOrder") {
+			recorded++
+		}
+		if r.selected("/helloworld.Greeter/SayHello") {
+			t.Fatal("recorded a method outside Methods")
+		}
+	}
+	if recorded != 3 {
+		t.Errorf("recorded %d of 9 calls, want 3", recorded)
+	}
+
+	r = NewRecorder(nil, Options{})
+	if r.selected("/grpc.reflection.v1.ServerReflection/ServerReflectionInfo") || !r.selected("/helloworld.Greeter/SayHello") {
+		t.Error("default options should record every call but the gRPC services")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	in := `{"method":"/a.B/C","start":"2026-10-19T09:12:03Z","duration_ns":1,"code":"OK"}
+
+{"method":`
+	var n int
+	err := Read(bytes.NewBufferString(in), func(*Call) error { n++; return nil })
+	if n != 1 || err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Read = %d calls, %v, want 1 and an error on line 3", n, err)
+	}
+}
@@ -0,0 +1,276 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/dynamic"
+	"github.com/cuongpiger/grpc-up-and-running/common/rawcodec"
+)
+
+// ReplayOptions tune how a Replayer sends calls and compares responses.
+type ReplayOptions struct {
+	// Resolver, when set, looks up the response type of each method so
+	// responses are compared as messages, regardless of field order, and
+	// shown as JSON. Without it, or for methods it cannot find, the
+	// encoded bytes are compared.
+	Resolver *dynamic.Resolver
+	// Ignore are names of response fields cleared at any depth before
+	// comparing, such as generated IDs or timestamps. It needs a Resolver.
+	Ignore []string
+	// Unordered compares the responses of a stream as a multiset, for
+	// servers that send them in no particular order.
+	Unordered bool
+	// KeepTiming sends the messages of a call at their recorded offsets
+	// instead of back to back.
+	KeepTiming bool
+	// Metadata is sent with every call, replacing recorded values of the
+	// same keys; redacted values are never sent.
+	Metadata metadata.MD
+}
+
+// Replayer sends recorded calls again.
+type Replayer struct {
+	conn grpc.ClientConnInterface
+	opts ReplayOptions
+}
+
+// NewReplayer returns a Replayer sending calls on conn.
+func NewReplayer(conn grpc.ClientConnInterface, opts ReplayOptions) *Replayer {
+	return &Replayer{conn: conn, opts: opts}
+}
+
+// Result is the outcome of a replayed call.
+type Result struct {
+	Code      string
+	Error     string
+	Responses []Message
+	Duration  time.Duration
+	// Mismatches describe how the replayed call differs from the recorded
+	// one; none means it matched.
+	Mismatches []string
+}
+
+// Replay sends c with its recorded metadata and deadline and compares the
+// responses and status with the recorded ones. A call that fails is a
+// result, not an error; Replay fails only when c cannot be sent.
+func (r *Replayer) Replay(ctx context.Context, c *Call) (*Result, error) {
+	md, err := r.metadata(c)
+	if err != nil {
+		return nil, err
+	}
+	callCtx := metadata.NewOutgoingContext(ctx, md)
+	var cancel context.CancelFunc
+	if c.Timeout > 0 {
+		callCtx, cancel = context.WithTimeout(callCtx, c.Timeout)
+	} else {
+		callCtx, cancel = context.WithCancel(callCtx)
+	}
+	defer cancel()
+
+	start := time.Now()
+	res := &Result{}
+	cs, err := r.conn.NewStream(callCtx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, c.Method, grpc.ForceCodec(rawcodec.Codec{}))
+	if err == nil {
+		go r.send(cs, c.Requests, start)
+		for {
+			f := &rawcodec.Frame{}
+			if err = cs.RecvMsg(f); err != nil {
+				break
+			}
+			res.Responses = append(res.Responses, Message{Offset: time.Since(start), Data: f.Payload})
+		}
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	res.Duration = time.Since(start)
+	st := status.Convert(err)
+	res.Code, res.Error = st.Code().String(), st.Message()
+	res.Mismatches = r.compare(ctx, c, res)
+	return res, nil
+}
+
+func (r *Replayer) metadata(c *Call) (metadata.MD, error) {
+	md := metadata.MD{}
+	for k, vs := range c.Metadata {
+		if _, ok := r.opts.Metadata[k]; ok {
+			continue
+		}
+		for _, v := range vs {
+			if v == "REDACTED" {
+				continue
+			}
+			if strings.HasSuffix(k, "-bin") {
+				b, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid %s metadata: %w", c.Method, k, err)
+				}
+				v = string(b)
+			}
+			md.Append(k, v)
+		}
+	}
+	return metadata.Join(md, r.opts.Metadata), nil
+}
+
+// send writes the requests and half-closes the stream. Errors show up
+// when receiving.
+func (r *Replayer) send(cs grpc.ClientStream, requests []Message, start time.Time) {
+	for _, m := range requests {
+		if r.opts.KeepTiming {
+			time.Sleep(time.Until(start.Add(m.Offset)))
+		}
+		if err := cs.SendMsg(&rawcodec.Frame{Payload: m.Data}); err != nil {
+			return
+		}
+	}
+	cs.CloseSend()
+}
+
+func (r *Replayer) compare(ctx context.Context, c *Call, res *Result) []string {
+	var mismatches []string
+	if c.Code != res.Code {
+		mismatches = append(mismatches, fmt.Sprintf("status: recorded %s, replayed %s", outcome(c.Code, c.Error), outcome(res.Code, res.Error)))
+	} else if c.Error != res.Error {
+		mismatches = append(mismatches, fmt.Sprintf("error: recorded %q, replayed %q", c.Error, res.Error))
+	}
+
+	desc := r.responseType(ctx, c.Method)
+	want, got := r.normalize(desc, c.Responses), r.normalize(desc, res.Responses)
+	if r.opts.Unordered {
+		return append(mismatches, unorderedDiff(want, got)...)
+	}
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			mismatches = append(mismatches, fmt.Sprintf("response %d: missing, recorded %s", i, want[i].text))
+		case i >= len(want):
+			mismatches = append(mismatches, fmt.Sprintf("response %d: unexpected %s", i, got[i].text))
+		case !bytes.Equal(want[i].key, got[i].key):
+			mismatches = append(mismatches, fmt.Sprintf("response %d: recorded %s, replayed %s", i, want[i].text, got[i].text))
+		}
+	}
+	return mismatches
+}
+
+func outcome(code, msg string) string {
+	if msg == "" {
+		return code
+	}
+	return fmt.Sprintf("%s %q", code, msg)
+}
+
+func unorderedDiff(want, got []normalized) []string {
+	left := make(map[string][]normalized)
+	for _, n := range got {
+		left[string(n.key)] = append(left[string(n.key)], n)
+	}
+	var mismatches []string
+	for _, n := range want {
+		if l := left[string(n.key)]; len(l) > 0 {
+			left[string(n.key)] = l[1:]
+			continue
+		}
+		mismatches = append(mismatches, "missing response "+n.text)
+	}
+	var unexpected []string
+	for _, l := range left {
+		for _, n := range l {
+			unexpected = append(unexpected, "unexpected response "+n.text)
+		}
+	}
+	sort.Strings(unexpected)
+	return append(mismatches, unexpected...)
+}
+
+func (r *Replayer) responseType(ctx context.Context, method string) protoreflect.MessageDescriptor {
+	if r.opts.Resolver == nil {
+		return nil
+	}
+	md, err := r.opts.Resolver.FindMethod(ctx, strings.TrimPrefix(method, "/"))
+	if err != nil {
+		return nil
+	}
+	return md.Output()
+}
+
+// normalized is a response in comparable form: key is equal for equal
+// messages and text shows it.
+type normalized struct {
+	key  []byte
+	text string
+}
+
+func (r *Replayer) normalize(desc protoreflect.MessageDescriptor, msgs []Message) []normalized {
+	out := make([]normalized, len(msgs))
+	for i, m := range msgs {
+		out[i] = normalized{key: m.Data, text: fmt.Sprintf("%d bytes %s", len(m.Data), base64.StdEncoding.EncodeToString(m.Data))}
+		if desc == nil {
+			continue
+		}
+		msg := dynamicpb.NewMessage(desc)
+		if err := (proto.UnmarshalOptions{Resolver: r.opts.Resolver.Types()}).Unmarshal(m.Data, msg); err != nil {
+			continue
+		}
+		clearFields(msg, r.opts.Ignore)
+		key, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		text, err := protojson.MarshalOptions{Resolver: r.opts.Resolver.Types()}.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		out[i] = normalized{key: key, text: string(text)}
+	}
+	return out
+}
+
+// clearFields clears the fields named in names anywhere in m.
+func clearFields(m protoreflect.Message, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	var clear []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		for _, n := range names {
+			if string(fd.Name()) == n {
+				clear = append(clear, fd)
+				return true
+			}
+		}
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			for i, l := 0, v.List(); i < l.Len(); i++ {
+				clearFields(l.Get(i).Message(), names)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				clearFields(v.Message(), names)
+				return true
+			})
+		case fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			clearFields(v.Message(), names)
+		}
+		return true
+	})
+	for _, fd := range clear {
+		m.Clear(fd)
+	}
+}
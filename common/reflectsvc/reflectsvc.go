@@ -0,0 +1,185 @@
+// Package reflectsvc registers the gRPC server reflection service with more
+// control than reflection.Register, which only describes the services linked
+// into the binary. Descriptors loaded from FileDescriptorSet files, e.g. of
+// services a process proxies to other backends, are served next to the
+// linked-in ones; internal services can be left out of the service listing;
+// and the deprecated v1alpha API can be dropped in favour of v1.
+//
+// Descriptor sets are written by protoc or buf:
+//
+//	protoc --include_imports --descriptor_set_out=orders.binpb orders.proto
+//	buf build -o orders.binpb
+package reflectsvc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	v1grpc "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	v1alphagrpc "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Internal lists the infrastructure services usually hidden from listings:
+// health checking, channelz and the client status discovery service of the
+// gRPC admin interface.
+var Internal = []string{
+	"grpc.health.v1.Health",
+	"grpc.channelz.v1.Channelz",
+	"envoy.service.status.v3.ClientStatusDiscoveryService",
+}
+
+// Options configures Register.
+type Options struct {
+	// DescriptorSets are FileDescriptorSet files whose services are listed
+	// and described in addition to the ones registered on the server. Files
+	// already linked into the binary are taken from the binary.
+	DescriptorSets []string
+	// Hidden are services left out of the service listing, by full name or
+	// as "package.*" for every service of a package. They can still be
+	// described by name.
+	Hidden []string
+	// V1Only registers only grpc.reflection.v1.ServerReflection, not the
+	// deprecated v1alpha version many older tools still use.
+	V1Only bool
+}
+
+// Register adds the reflection service to s as configured by opts.
+func Register(s reflection.GRPCServer, opts Options) error {
+	extra, err := Load(opts.DescriptorSets...)
+	if err != nil {
+		return err
+	}
+	so := reflection.ServerOptions{
+		Services:           &services{server: s, extra: extra, hidden: opts.Hidden},
+		DescriptorResolver: resolver{extra},
+	}
+	v1grpc.RegisterServerReflectionServer(s, reflection.NewServerV1(so))
+	if !opts.V1Only {
+		v1alphagrpc.RegisterServerReflectionServer(s, reflection.NewServer(so))
+	}
+	return nil
+}
+
+// Load reads FileDescriptorSet files into a registry. Files linked into the
+// binary are left out, and imports missing from a set are resolved against
+// the linked-in files, so sets built without --include_imports work as long
+// as the binary links their imports.
+func Load(paths ...string) (*protoregistry.Files, error) {
+	files := new(protoregistry.Files)
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		set := new(descriptorpb.FileDescriptorSet)
+		if err := proto.Unmarshal(b, set); err != nil {
+			return nil, fmt.Errorf("%s: not a FileDescriptorSet: %w", path, err)
+		}
+		pending := make(map[string]*descriptorpb.FileDescriptorProto)
+		for _, fd := range set.GetFile() {
+			pending[fd.GetName()] = fd
+		}
+		for _, fd := range set.GetFile() {
+			if err := register(files, fd.GetName(), pending); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return files, nil
+}
+
+// register adds the named file to files after its dependencies.
+func register(files *protoregistry.Files, name string, pending map[string]*descriptorpb.FileDescriptorProto) error {
+	if _, err := (resolver{files}).FindFileByPath(name); err == nil {
+		return nil
+	}
+	fd, ok := pending[name]
+	if !ok {
+		return fmt.Errorf("missing import %q; build the set with --include_imports", name)
+	}
+	delete(pending, name)
+	for _, dep := range fd.GetDependency() {
+		if err := register(files, dep, pending); err != nil {
+			return err
+		}
+	}
+	f, err := protodesc.NewFile(fd, resolver{files})
+	if err != nil {
+		return fmt.Errorf("invalid descriptor for %s: %w", name, err)
+	}
+	return files.RegisterFile(f)
+}
+
+// resolver looks descriptors up in the linked-in files first, then in the
+// ones loaded from descriptor sets.
+type resolver struct {
+	extra *protoregistry.Files
+}
+
+func (r resolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return r.extra.FindFileByPath(path)
+}
+
+func (r resolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return r.extra.FindDescriptorByName(name)
+}
+
+// services lists the services registered on the server and those of the
+// descriptor sets, minus the hidden ones. It is asked on every listing, so
+// services registered after Register are included.
+type services struct {
+	server reflection.ServiceInfoProvider
+	extra  *protoregistry.Files
+	hidden []string
+}
+
+func (s *services) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := make(map[string]grpc.ServiceInfo)
+	for name, si := range s.server.GetServiceInfo() {
+		info[name] = si
+	}
+	s.extra.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			name := string(fd.Services().Get(i).FullName())
+			if _, ok := info[name]; !ok {
+				info[name] = grpc.ServiceInfo{}
+			}
+		}
+		return true
+	})
+	for name := range info {
+		if matches(name, s.hidden) {
+			delete(info, name)
+		}
+	}
+	return info
+}
+
+// matches reports whether service matches one of patterns, given as full
+// service names or as "package.*".
+func matches(service string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(service, prefix) {
+				return true
+			}
+		} else if service == p {
+			return true
+		}
+	}
+	return false
+}
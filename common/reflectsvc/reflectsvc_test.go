@@ -0,0 +1,164 @@
+package reflectsvc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/cuongpiger/grpc-up-and-running/common/dynamic"
+)
+
+// echoFile describes a service the test binary does not link, as a proxy
+// would know the services of its backends.
+func echoFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("proxied/echo.proto"),
+		Package:    proto.String("proxied"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Shout"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("text"),
+				JsonName: proto.String("text"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Say"),
+				InputType:  proto.String(".proxied.Shout"),
+				OutputType: proto.String(".google.protobuf.StringValue"),
+			}},
+		}},
+	}
+}
+
+func writeSet(t *testing.T, files ...*descriptorpb.FileDescriptorProto) string {
+	t.Helper()
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: files})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "set.binpb")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func serve(t *testing.T, opts Options) (*grpc.Server, *dynamic.Resolver) {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	if err := Register(s, opts); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, dynamic.NewResolver(conn)
+}
+
+func TestRegister(t *testing.T) {
+	// The set carries wrappers.proto too, which the binary already links.
+	wrappers := protodesc.ToFileDescriptorProto(wrapperspb.File_google_protobuf_wrappers_proto)
+	set := writeSet(t, echoFile(), wrappers)
+	_, r := serve(t, Options{DescriptorSets: []string{set}, Hidden: Internal})
+	ctx := context.Background()
+
+	services, err := r.ListServices(ctx)
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	want := []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection", "proxied.Echo"}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("services = %v, want %v", services, want)
+	}
+
+	md, err := r.FindMethod(ctx, "proxied.Echo/Say")
+	if err != nil {
+		t.Fatalf("FindMethod: %v", err)
+	}
+	if md.Input().FullName() != "proxied.Shout" || md.Output().FullName() != "google.protobuf.StringValue" {
+		t.Errorf("Say = %v", md)
+	}
+	// Hidden services are only left out of the listing.
+	if _, err := r.FindService(ctx, "grpc.health.v1.Health"); err != nil {
+		t.Errorf("FindService(health): %v", err)
+	}
+}
+
+func TestV1Only(t *testing.T) {
+	s, r := serve(t, Options{V1Only: true})
+	if _, ok := s.GetServiceInfo()["grpc.reflection.v1alpha.ServerReflection"]; ok {
+		t.Error("v1alpha registered with V1Only")
+	}
+	services, err := r.ListServices(context.Background())
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	want := []string{"grpc.health.v1.Health", "grpc.reflection.v1.ServerReflection"}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("services = %v, want %v", services, want)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	patterns := []string{"grpc.health.v1.Health", "grpc.reflection.*"}
+	for service, want := range map[string]bool{
+		"grpc.health.v1.Health":                    true,
+		"grpc.health.v1.HealthX":                   false,
+		"grpc.reflection.v1.ServerReflection":      true,
+		"grpc.reflection.v1alpha.ServerReflection": true,
+		"ecommerce.OrderManagement":                false,
+	} {
+		if got := matches(service, patterns); got != want {
+			t.Errorf("matches(%q) = %v, want %v", service, got, want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	orphan := echoFile()
+	orphan.Dependency = []string{"proxied/missing.proto"}
+	garbage := filepath.Join(t.TempDir(), "garbage")
+	if err := os.WriteFile(garbage, []byte("not a descriptor set"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		writeSet(t, orphan): "missing import",
+		garbage:             "not a FileDescriptorSet",
+		filepath.Join(t.TempDir(), "missing.binpb"): "no such file",
+	} {
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load(%s) = %v, want %q", filepath.Base(path), err, want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package requestid
+
+import "net/http"
+
+// Handler is the HTTP counterpart of the server interceptors, for REST
+// front ends of gRPC services: it accepts the ID sent in the X-Request-Id
+// header or generates one, stores it in the request context, where the
+// client interceptors pick it up for the calls made on behalf of the
+// request, and echoes it in the X-Request-Id response header.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderKey)
+		if id == "" {
+			id = New()
+		}
+		w.Header().Set(HeaderKey, id)
+		h.ServeHTTP(w, r.WithContext(annotate(r.Context(), id)))
+	})
+}
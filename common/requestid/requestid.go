@@ -0,0 +1,125 @@
+// Package requestid propagates a correlation ID across gRPC calls.
+//
+// The server interceptors accept the ID sent by the caller in the
+// "x-request-id" metadata or generate a new one, store it in the handler
+// context, echo it back in the response header and trailer and record it on
+// the active span. The client interceptors copy the ID found in the context
+// into the outgoing metadata, so calls made from inside a handler carry the ID
+// of the request that triggered them.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderKey is the metadata key carrying the request ID.
+const HeaderKey = "x-request-id"
+
+// SpanAttribute is the span attribute the request ID is recorded under.
+const SpanAttribute = attribute.Key("request.id")
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx by the server interceptors
+// or NewContext.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
+
+// New generates a fresh request ID.
+func New() string {
+	return uuid.NewString()
+}
+
+// fromIncoming returns the ID sent by the caller, or a new one.
+func fromIncoming(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(HeaderKey); len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+	return New()
+}
+
+// annotate stores id in ctx and on the span started for the RPC, if any.
+func annotate(ctx context.Context, id string) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(SpanAttribute.String(id))
+	return NewContext(ctx, id)
+}
+
+// UnaryServerInterceptor accepts or generates the request ID of every unary
+// call and echoes it in the response header and trailer.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := fromIncoming(ctx)
+		ctx = annotate(ctx, id)
+		md := metadata.Pairs(HeaderKey, id)
+		grpc.SetHeader(ctx, md)
+		defer grpc.SetTrailer(ctx, md)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor accepts or generates the request ID of every
+// streaming call and echoes it in the response header and trailer.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id := fromIncoming(ss.Context())
+		md := metadata.Pairs(HeaderKey, id)
+		ss.SetHeader(md)
+		defer ss.SetTrailer(md)
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: annotate(ss.Context(), id)})
+	}
+}
+
+// wrappedStream overrides the context of the stream so handlers see the ID.
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
+
+// outgoing adds the request ID to the outgoing metadata of ctx unless the
+// caller already set one. Calls without any ID get a new one so the whole
+// call chain can be correlated from its first hop.
+func outgoing(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(HeaderKey)) > 0 {
+		return ctx
+	}
+	id, ok := FromContext(ctx)
+	if !ok {
+		id = New()
+		ctx = NewContext(ctx, id)
+	}
+	return metadata.AppendToOutgoingContext(ctx, HeaderKey, id)
+}
+
+// UnaryClientInterceptor sends the request ID of ctx with every unary call.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends the request ID of ctx with every streaming
+// call.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
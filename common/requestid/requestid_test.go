@@ -0,0 +1,162 @@
+package requestid
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// relayServer answers health checks by calling a downstream health server,
+// recording the request IDs it sees on the way.
+type relayServer struct {
+	healthpb.UnimplementedHealthServer
+	downstream healthpb.HealthClient
+	seen       chan string
+}
+
+func (s *relayServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	id, _ := FromContext(ctx)
+	s.seen <- id
+	if s.downstream == nil {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+	}
+	return s.downstream.Check(ctx, req)
+}
+
+func startServer(t *testing.T, srv healthpb.HealthServer) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor()),
+		grpc.StreamInterceptor(StreamServerInterceptor()))
+	healthpb.RegisterHealthServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough://bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestPropagatesThroughHandlers(t *testing.T) {
+	backend := &relayServer{seen: make(chan string, 1)}
+	frontend := &relayServer{seen: make(chan string, 1)}
+	frontend.downstream = healthpb.NewHealthClient(startServer(t, backend))
+	client := healthpb.NewHealthClient(startServer(t, frontend))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), HeaderKey, "complaint-1234")
+	var header, trailer metadata.MD
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if got := <-frontend.seen; got != "complaint-1234" {
+		t.Errorf("frontend saw %q, want complaint-1234", got)
+	}
+	if got := <-backend.seen; got != "complaint-1234" {
+		t.Errorf("backend saw %q, want complaint-1234", got)
+	}
+	if got := header.Get(HeaderKey); len(got) != 1 || got[0] != "complaint-1234" {
+		t.Errorf("header %s = %v", HeaderKey, got)
+	}
+	if got := trailer.Get(HeaderKey); len(got) != 1 || got[0] != "complaint-1234" {
+		t.Errorf("trailer %s = %v", HeaderKey, got)
+	}
+}
+
+func TestGeneratesMissingID(t *testing.T) {
+	backend := &relayServer{seen: make(chan string, 1)}
+	client := healthpb.NewHealthClient(startServer(t, backend))
+
+	var header metadata.MD
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	got := <-backend.seen
+	if got == "" {
+		t.Fatal("server saw no request ID")
+	}
+	if echoed := header.Get(HeaderKey); len(echoed) != 1 || echoed[0] != got {
+		t.Errorf("header %s = %v, want [%s]", HeaderKey, echoed, got)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	backend := &watchServer{}
+	client := healthpb.NewHealthClient(startServer(t, backend))
+
+	ctx := NewContext(context.Background(), "stream-7")
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", resp.Status)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if got := header.Get(HeaderKey); len(got) != 1 || got[0] != "stream-7" {
+		t.Errorf("header %s = %v, want [stream-7]", HeaderKey, got)
+	}
+}
+
+// watchServer reports SERVING only when the stream context carries a request
+// ID, which proves the wrapped stream exposes it to the handler.
+type watchServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (s *watchServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if id, _ := FromContext(stream.Context()); id == "stream-7" {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	return stream.Send(&healthpb.HealthCheckResponse{Status: st})
+}
+
+func TestHandlerForwardsToCalls(t *testing.T) {
+	backend := &relayServer{seen: make(chan string, 1)}
+	client := healthpb.NewHealthClient(startServer(t, backend))
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := client.Check(r.Context(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Errorf("Check: %v", err)
+		}
+	}))
+
+	for _, sent := range []string{"rest-42", ""} {
+		req := httptest.NewRequest("GET", "/v1/product/1", nil)
+		if sent != "" {
+			req.Header.Set(HeaderKey, sent)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		got := <-backend.seen
+		if got == "" || (sent != "" && got != sent) {
+			t.Errorf("sent %q, server saw %q", sent, got)
+		}
+		if echoed := rec.Header().Get(HeaderKey); echoed != got {
+			t.Errorf("sent %q, response header %s = %q, want %q", sent, HeaderKey, echoed, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package shed
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exports the load shedding of a Shedder to Prometheus.
+type Metrics struct {
+	shedCalls *prometheus.CounterVec
+	limit     prometheus.Gauge
+	inflight  prometheus.Gauge
+	queueWait *prometheus.HistogramVec
+}
+
+// NewMetrics registers the load shedding metrics with reg, reusing the
+// collectors already registered by an earlier call.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		shedCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_shed_total",
+			Help: "Calls rejected by the load shedder, by method and priority.",
+		}, []string{"grpc_method", "priority"}),
+		limit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "grpc_server_concurrency_limit",
+			Help: "Adaptive concurrency limit of the load shedder.",
+		}),
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "grpc_server_concurrency_inflight",
+			Help: "Calls and streams in flight counted by the load shedder.",
+		}),
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_shed_queue_seconds",
+			Help:    "Time admitted calls waited for a slot, by priority.",
+			Buckets: []float64{0, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"priority"}),
+	}
+	var err error
+	if m.shedCalls, err = register(reg, m.shedCalls); err != nil {
+		return nil, err
+	}
+	if m.limit, err = register(reg, m.limit); err != nil {
+		return nil, err
+	}
+	if m.inflight, err = register(reg, m.inflight); err != nil {
+		return nil, err
+	}
+	if m.queueWait, err = register(reg, m.queueWait); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, err
+	}
+	return c, nil
+}
+
+func (m *Metrics) shed(method string, p Priority) {
+	if m != nil {
+		m.shedCalls.WithLabelValues(method, p.String()).Inc()
+	}
+}
+
+func (m *Metrics) setLimit(limit float64) {
+	if m != nil {
+		m.limit.Set(limit)
+	}
+}
+
+func (m *Metrics) setInflight(n int) {
+	if m != nil {
+		m.inflight.Set(float64(n))
+	}
+}
+
+func (m *Metrics) queued(p Priority, wait time.Duration) {
+	if m != nil {
+		m.queueWait.WithLabelValues(p.String()).Observe(wait.Seconds())
+	}
+}
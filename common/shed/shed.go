@@ -0,0 +1,311 @@
+// Package shed protects a gRPC server from overload with an adaptive
+// concurrency limit and priority-based load shedding.
+//
+// The limit follows the latency of the handlers, like the Gradient2 limiter
+// of Netflix's concurrency-limits: it grows while the recent latency stays
+// close to its long-term average and shrinks in proportion when the recent
+// latency rises above it, which is what queueing inside the server looks
+// like. The limit is shared between priorities, each of which may use a
+// fraction of it, so low-priority calls are shed first:
+//
+//	x-priority: low       50% of the limit
+//	x-priority: normal    75% (default)
+//	x-priority: high      90%
+//	x-priority: critical  100%, and may wait up to MaxQueueWait for a slot
+//
+// Any client can send the header, so by default it may only lower the
+// priority of a call: claims above normal are capped. Servers that know
+// their callers grant higher priorities with Options.Priority.
+//
+// Shed calls fail with codes.Unavailable and an errdetails.RetryInfo, so
+// clients retry, preferably on another backend. Shed calls, the limit and
+// queueing times are exported to Prometheus.
+package shed
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// PriorityHeader is the metadata key carrying the priority of a call.
+const PriorityHeader = "x-priority"
+
+// Priority is the importance of a call.
+type Priority int
+
+const (
+	Low Priority = iota
+	Normal
+	High
+	Critical
+	numPriorities
+)
+
+// share is the fraction of the limit each priority may use.
+var share = [numPriorities]float64{Low: 0.5, Normal: 0.75, High: 0.9, Critical: 1}
+
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case Normal:
+		return "normal"
+	case High:
+		return "high"
+	case Critical:
+		return "critical"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// ParsePriority parses a priority name, or its number from 0 (low) to 3
+// (critical). Anything else is Normal.
+func ParsePriority(s string) Priority {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for p := Low; p < numPriorities; p++ {
+		if s == p.String() || s == strconv.Itoa(int(p)) {
+			return p
+		}
+	}
+	return Normal
+}
+
+// PriorityFunc returns the priority of an incoming call.
+type PriorityFunc func(ctx context.Context) Priority
+
+// PriorityFromContext returns the priority an incoming call claims in its
+// x-priority header.
+func PriorityFromContext(ctx context.Context) Priority {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(PriorityHeader); len(v) > 0 {
+			return ParsePriority(v[0])
+		}
+	}
+	return Normal
+}
+
+// ClaimedPriority returns a PriorityFunc trusting the x-priority header up
+// to max, for callers that are not authenticated or not trusted further.
+func ClaimedPriority(max Priority) PriorityFunc {
+	return func(ctx context.Context) Priority {
+		return min(PriorityFromContext(ctx), max)
+	}
+}
+
+// Options configures a Shedder. Zero values select the defaults.
+type Options struct {
+	// InitialLimit is the concurrency limit before any latency is measured.
+	// Default 20.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the limit. Default 1 and 1000.
+	MinLimit, MaxLimit int
+	// Tolerance is how much the recent latency may exceed the long-term
+	// average before the limit shrinks. Default 1.5.
+	Tolerance float64
+	// MaxQueueWait is how long critical calls wait for a slot before being
+	// shed. Default 0, shedding them at once too.
+	MaxQueueWait time.Duration
+	// RetryDelay is the delay suggested to shed calls. Default 100ms.
+	RetryDelay time.Duration
+	// Priority returns the priority of a call, e.g. from the identity the
+	// server authenticated. Default ClaimedPriority(Normal).
+	Priority PriorityFunc
+	// Metrics receives the shed counts, limit and queueing times. Default
+	// none.
+	Metrics *Metrics
+}
+
+func (o *Options) setDefaults() {
+	if o.InitialLimit <= 0 {
+		o.InitialLimit = 20
+	}
+	if o.MinLimit <= 0 {
+		o.MinLimit = 1
+	}
+	if o.MaxLimit <= 0 {
+		o.MaxLimit = 1000
+	}
+	if o.Tolerance <= 0 {
+		o.Tolerance = 1.5
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = 100 * time.Millisecond
+	}
+	if o.Priority == nil {
+		o.Priority = ClaimedPriority(Normal)
+	}
+}
+
+const (
+	// shortAlpha and longAlpha weight new samples in the recent and the
+	// long-term average latency.
+	shortAlpha = 0.2
+	longAlpha  = 0.01
+	// smoothing weights the new limit against the current one.
+	smoothing = 0.2
+)
+
+// Shedder admits calls within an adaptive concurrency limit.
+type Shedder struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	// shortRTT and longRTT are the recent and long-term average handler
+	// latency, in seconds.
+	shortRTT, longRTT float64
+	// queue holds the critical calls waiting for a slot, oldest first.
+	queue []chan struct{}
+}
+
+// New returns a Shedder configured by opts.
+func New(opts Options) *Shedder {
+	opts.setDefaults()
+	s := &Shedder{opts: opts, limit: float64(opts.InitialLimit)}
+	s.opts.Metrics.setLimit(s.limit)
+	return s
+}
+
+// Limit returns the current concurrency limit.
+func (s *Shedder) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.limit)
+}
+
+// capacity returns how many calls in flight p may join.
+func (s *Shedder) capacity(p Priority) int {
+	return max(1, int(math.Floor(s.limit*share[p])))
+}
+
+// acquire admits a call of priority p, waiting for a slot if it is critical,
+// or returns a shed error.
+func (s *Shedder) acquire(ctx context.Context, method string, p Priority) error {
+	start := time.Now()
+	s.mu.Lock()
+	if s.inflight < s.capacity(p) {
+		s.inflight++
+		s.opts.Metrics.setInflight(s.inflight)
+		s.mu.Unlock()
+		s.opts.Metrics.queued(p, 0)
+		return nil
+	}
+	if p != Critical || s.opts.MaxQueueWait <= 0 {
+		s.mu.Unlock()
+		return s.shed(method, p)
+	}
+	granted := make(chan struct{})
+	s.queue = append(s.queue, granted)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.opts.MaxQueueWait)
+	defer timer.Stop()
+	select {
+	case <-granted:
+		s.opts.Metrics.queued(p, time.Since(start))
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	for i, ch := range s.queue {
+		if ch == granted {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.mu.Unlock()
+			return s.shed(method, p)
+		}
+	}
+	// The slot was granted while timing out: keep it.
+	s.mu.Unlock()
+	s.opts.Metrics.queued(p, time.Since(start))
+	return nil
+}
+
+func (s *Shedder) shed(method string, p Priority) error {
+	s.opts.Metrics.shed(method, p)
+	st := status.Newf(codes.Unavailable, "server overloaded, %s priority call to %s shed", p, method)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(s.opts.RetryDelay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// release ends a call and hands its slot to the oldest queued call if the
+// limit allows it. The handler latency rtt of unary calls updates the limit.
+func (s *Shedder) release(rtt time.Duration, unary bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if unary {
+		s.observe(rtt, s.inflight)
+	}
+	s.inflight--
+	for len(s.queue) > 0 && s.inflight < s.capacity(Critical) {
+		s.inflight++
+		close(s.queue[0])
+		s.queue = s.queue[1:]
+	}
+	s.opts.Metrics.setInflight(s.inflight)
+}
+
+// observe updates the latency averages with a sample measured with inflight
+// calls in flight, then the limit.
+func (s *Shedder) observe(rtt time.Duration, inflight int) {
+	sample := rtt.Seconds()
+	if s.longRTT == 0 {
+		s.shortRTT, s.longRTT = sample, sample
+	}
+	s.shortRTT = s.shortRTT*(1-shortAlpha) + sample*shortAlpha
+	s.longRTT = s.longRTT*(1-longAlpha) + sample*longAlpha
+	// Once the load has dropped, let the long-term average follow quickly
+	// instead of keeping the limit low for the whole long window.
+	if s.longRTT/s.shortRTT > 2 {
+		s.longRTT *= 0.95
+	}
+	// With less than half of the limit in use, latency says nothing about
+	// whether a higher limit would be sustained.
+	if float64(inflight) < s.limit/2 {
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, s.opts.Tolerance*s.longRTT/s.shortRTT))
+	next := s.limit*gradient + math.Sqrt(s.limit)
+	next = s.limit*(1-smoothing) + next*smoothing
+	s.limit = math.Max(float64(s.opts.MinLimit), math.Min(float64(s.opts.MaxLimit), next))
+	s.opts.Metrics.setLimit(s.limit)
+}
+
+// UnaryServerInterceptor sheds the unary calls above the limit.
+func (s *Shedder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := s.acquire(ctx, info.FullMethod, s.opts.Priority(ctx)); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		defer func() { s.release(time.Since(start), true) }()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor sheds the streams above the limit. Streams count
+// against the limit while open but their duration, which depends on the
+// client, does not feed the latency averages.
+func (s *Shedder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := s.acquire(ss.Context(), info.FullMethod, s.opts.Priority(ss.Context())); err != nil {
+			return err
+		}
+		defer s.release(0, false)
+		return handler(srv, ss)
+	}
+}
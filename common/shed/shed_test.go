@@ -0,0 +1,192 @@
+package shed
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestParsePriority(t *testing.T) {
+	for in, want := range map[string]Priority{"low": Low, "0": Low, " High ": High, "3": Critical, "critical": Critical, "": Normal, "urgent": Normal} {
+		if got := ParsePriority(in); got != want {
+			t.Errorf("ParsePriority(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestClaimedPriorityIsCapped(t *testing.T) {
+	s := New(Options{})
+	for claim, want := range map[string]Priority{"low": Low, "": Normal, "high": Normal, "critical": Normal} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PriorityHeader, claim))
+		if got := s.opts.Priority(ctx); got != want {
+			t.Errorf("default priority of a call claiming %q = %v, want %v", claim, got, want)
+		}
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PriorityHeader, "critical"))
+	if got := ClaimedPriority(High)(ctx); got != High {
+		t.Errorf("ClaimedPriority(High) of a critical claim = %v, want high", got)
+	}
+}
+
+func fixedLimit(limit int, opts Options) *Shedder {
+	opts.InitialLimit, opts.MinLimit, opts.MaxLimit = limit, limit, limit
+	return New(opts)
+}
+
+func TestLowPriorityShedFirst(t *testing.T) {
+	// With a limit of 10: low may use 5 slots, normal 7, high 9, critical 10.
+	s := fixedLimit(10, Options{})
+	ctx := context.Background()
+	admitted := map[Priority]int{}
+	for _, p := range []Priority{Low, Normal, High, Critical} {
+		for s.acquire(ctx, "/svc/M", p) == nil {
+			admitted[p]++
+		}
+	}
+	want := map[Priority]int{Low: 5, Normal: 2, High: 2, Critical: 1}
+	for p, n := range want {
+		if admitted[p] != n {
+			t.Errorf("%v calls admitted = %d, want %d", p, admitted[p], n)
+		}
+	}
+	err := s.acquire(ctx, "/svc/M", Low)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("acquire = %v, want Unavailable", err)
+	}
+}
+
+func TestCriticalCallsQueue(t *testing.T) {
+	s := fixedLimit(1, Options{MaxQueueWait: time.Second})
+	ctx := context.Background()
+	if err := s.acquire(ctx, "/svc/M", Critical); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- s.acquire(ctx, "/svc/M", Critical) }()
+	time.Sleep(20 * time.Millisecond)
+	// Lower priorities are not queued.
+	if err := s.acquire(ctx, "/svc/M", High); status.Code(err) != codes.Unavailable {
+		t.Fatalf("high priority acquire = %v, want Unavailable", err)
+	}
+	s.release(time.Millisecond, true)
+	if err := <-done; err != nil {
+		t.Fatalf("queued call: %v", err)
+	}
+
+	// A queued call is shed once MaxQueueWait has passed.
+	s.opts.MaxQueueWait = 10 * time.Millisecond
+	if err := s.acquire(ctx, "/svc/M", Critical); status.Code(err) != codes.Unavailable {
+		t.Fatalf("acquire after the queue wait = %v, want Unavailable", err)
+	}
+}
+
+func TestLimitFollowsLatency(t *testing.T) {
+	s := New(Options{InitialLimit: 10, MaxLimit: 100})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Steady latency with the limit in use: the limit grows.
+	for i := 0; i < 200; i++ {
+		s.observe(10*time.Millisecond, int(s.limit))
+	}
+	grown := s.limit
+	if grown <= 10 {
+		t.Fatalf("limit after steady latency = %.1f, want it above 10", grown)
+	}
+	// Latency jumps tenfold: the server is queueing, the limit shrinks.
+	for i := 0; i < 20; i++ {
+		s.observe(100*time.Millisecond, int(s.limit))
+	}
+	if s.limit >= grown/2 {
+		t.Errorf("limit after the latency rise = %.1f, want below %.1f", s.limit, grown/2)
+	}
+	// Samples taken while mostly idle do not move the limit.
+	before := s.limit
+	s.observe(time.Millisecond, 0)
+	if s.limit != before {
+		t.Errorf("limit moved from %.1f to %.1f on an idle sample", before, s.limit)
+	}
+}
+
+// blockingHealth holds Check calls until release is closed.
+type blockingHealth struct {
+	healthpb.UnimplementedHealthServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHealth) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	h.entered <- struct{}{}
+	<-h.release
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func TestInterceptorShedsByPriorityHeader(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fixedLimit(2, Options{Metrics: metrics, Priority: ClaimedPriority(Critical)})
+
+	h := &blockingHealth{entered: make(chan struct{}, 10), release: make(chan struct{})}
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(s.UnaryServerInterceptor()))
+	healthpb.RegisterHealthServer(srv, h)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	check := func(priority string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), PriorityHeader, priority)
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	// One low priority call takes its whole share of the limit of 2.
+	errs := make(chan error, 1)
+	go func() { errs <- check("low") }()
+	<-h.entered
+	if err := check("low"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("second low priority call = %v, want Unavailable", err)
+	}
+	go func() { errs <- check("critical") }()
+	<-h.entered
+	close(h.release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("admitted call: %v", err)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shed float64
+	for _, f := range families {
+		if f.GetName() == "grpc_server_shed_total" {
+			for _, m := range f.GetMetric() {
+				shed += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if shed != 1 {
+		t.Errorf("grpc_server_shed_total = %v, want 1", shed)
+	}
+}
@@ -0,0 +1,93 @@
+package svcconfig
+
+import "time"
+
+// Builder builds a Config method by method.
+type Builder struct {
+	cfg     Config
+	current *MethodConfig
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+// LoadBalancingPolicy sets the load-balancing policy, e.g. "round_robin".
+func (b *Builder) LoadBalancingPolicy(name string) *Builder {
+	b.cfg.LoadBalancingPolicy = name
+	return b
+}
+
+// RetryThrottling sets the retry throttling of the channel.
+func (b *Builder) RetryThrottling(maxTokens int, tokenRatio float64) *Builder {
+	b.cfg.RetryThrottling = &RetryThrottling{MaxTokens: maxTokens, TokenRatio: tokenRatio}
+	return b
+}
+
+// Method starts the configuration of the given methods of service, or of
+// every method of service when none is given. The following Timeout,
+// WaitForReady, Retry and Hedge calls apply to them.
+func (b *Builder) Method(service string, methods ...string) *Builder {
+	mc := MethodConfig{}
+	if len(methods) == 0 {
+		mc.Name = []Name{{Service: service}}
+	}
+	for _, m := range methods {
+		mc.Name = append(mc.Name, Name{Service: service, Method: m})
+	}
+	b.cfg.MethodConfig = append(b.cfg.MethodConfig, mc)
+	b.current = &b.cfg.MethodConfig[len(b.cfg.MethodConfig)-1]
+	return b
+}
+
+// Default starts the configuration of every method without a more specific
+// configuration.
+func (b *Builder) Default() *Builder {
+	b.cfg.MethodConfig = append(b.cfg.MethodConfig, MethodConfig{Name: []Name{{}}})
+	b.current = &b.cfg.MethodConfig[len(b.cfg.MethodConfig)-1]
+	return b
+}
+
+// Timeout sets the deadline of the calls, unless the caller sets an earlier
+// one. It covers all attempts.
+func (b *Builder) Timeout(d time.Duration) *Builder {
+	b.method().Timeout = Duration(d)
+	return b
+}
+
+// WaitForReady makes calls wait for a ready connection instead of failing
+// while the channel is in TRANSIENT_FAILURE.
+func (b *Builder) WaitForReady(wait bool) *Builder {
+	b.method().WaitForReady = &wait
+	return b
+}
+
+// Retry sets the retry policy of the calls.
+func (b *Builder) Retry(p RetryPolicy) *Builder {
+	b.method().RetryPolicy = &p
+	return b
+}
+
+// Hedge sets the hedging policy of the calls.
+func (b *Builder) Hedge(p HedgingPolicy) *Builder {
+	b.method().HedgingPolicy = &p
+	return b
+}
+
+func (b *Builder) method() *MethodConfig {
+	if b.current == nil {
+		b.Default()
+	}
+	return b.current
+}
+
+// Build validates and returns the config.
+func (b *Builder) Build() (*Config, error) {
+	cfg := b.cfg
+	cfg.MethodConfig = append([]MethodConfig(nil), b.cfg.MethodConfig...)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,169 @@
+package svcconfig
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// hedger hedges the unary calls of the methods with a HedgingPolicy.
+type hedger struct {
+	// methods holds the method configs by "service/method", "service/" and
+	// "/", the most specific winning as in gRPC.
+	methods map[string]*MethodConfig
+}
+
+func newHedger(c *Config) *hedger {
+	h := &hedger{methods: make(map[string]*MethodConfig)}
+	hedged := false
+	for i := range c.MethodConfig {
+		mc := &c.MethodConfig[i]
+		for _, n := range mc.Name {
+			h.methods[n.Service+"/"+n.Method] = mc
+		}
+		hedged = hedged || mc.HedgingPolicy != nil
+	}
+	if !hedged {
+		return nil
+	}
+	return h
+}
+
+func (h *hedger) lookup(fullMethod string) *MethodConfig {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	for _, key := range []string{service + "/" + method, service + "/", "/"} {
+		if mc, ok := h.methods[key]; ok {
+			return mc
+		}
+	}
+	return nil
+}
+
+type attempt struct {
+	reply           interface{}
+	err             error
+	header, trailer metadata.MD
+	peer            peer.Peer
+}
+
+// targets are the Header, Trailer and Peer call options of a hedged call.
+// Attempts run concurrently, so each gets its own and only the attempt whose
+// outcome is returned is copied to them.
+type targets struct {
+	headers, trailers []*metadata.MD
+	peers             []*peer.Peer
+}
+
+// splitTargets separates the targets from the other options of a call.
+func splitTargets(opts []grpc.CallOption) ([]grpc.CallOption, targets) {
+	var rest []grpc.CallOption
+	var t targets
+	for _, o := range opts {
+		switch o := o.(type) {
+		case grpc.HeaderCallOption:
+			t.headers = append(t.headers, o.HeaderAddr)
+		case grpc.TrailerCallOption:
+			t.trailers = append(t.trailers, o.TrailerAddr)
+		case grpc.PeerCallOption:
+			t.peers = append(t.peers, o.PeerAddr)
+		default:
+			rest = append(rest, o)
+		}
+	}
+	return rest, t
+}
+
+func (t targets) set(a *attempt) {
+	for _, h := range t.headers {
+		*h = a.header
+	}
+	for _, tr := range t.trailers {
+		*tr = a.trailer
+	}
+	for _, p := range t.peers {
+		*p = a.peer
+	}
+}
+
+// UnaryClientInterceptor sends the attempts of hedged calls and returns the
+// first successful reply, cancelling the other attempts. The headers,
+// trailers and peer the caller asks for are those of the returned attempt.
+func (h *hedger) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		mc := h.lookup(method)
+		replyMsg, ok := reply.(proto.Message)
+		if mc == nil || mc.HedgingPolicy == nil || !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		p := mc.HedgingPolicy
+		if mc.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(mc.Timeout))
+			defer cancel()
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		opts, targets := splitTargets(opts)
+		attempts := min(p.MaxAttempts, maxAttempts)
+		results := make(chan *attempt, attempts)
+		sent, done := 0, 0
+		send := func() {
+			sent++
+			a := &attempt{reply: replyMsg.ProtoReflect().New().Interface()}
+			go func() {
+				a.err = invoker(ctx, method, req, a.reply, cc,
+					append(opts[:len(opts):len(opts)], grpc.Header(&a.header), grpc.Trailer(&a.trailer), grpc.Peer(&a.peer))...)
+				results <- a
+			}()
+		}
+
+		send()
+		timer := time.NewTimer(time.Duration(p.HedgingDelay))
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				if sent < attempts {
+					send()
+					timer.Reset(time.Duration(p.HedgingDelay))
+				}
+			case res := <-results:
+				done++
+				if res.err == nil {
+					proto.Reset(replyMsg)
+					proto.Merge(replyMsg, res.reply.(proto.Message))
+					targets.set(res)
+					return nil
+				}
+				if !nonFatal(p, res.err) {
+					targets.set(res)
+					return res.err
+				}
+				if sent < attempts {
+					send()
+					timer.Reset(time.Duration(p.HedgingDelay))
+				} else if done == sent {
+					targets.set(res)
+					return res.err
+				}
+			}
+		}
+	}
+}
+
+func nonFatal(p *HedgingPolicy, err error) bool {
+	code := status.Code(err)
+	for _, c := range p.NonFatalStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+// Package svcconfig builds and loads gRPC service configs declaring, per
+// method, a timeout and either a retry or a hedging policy:
+//
+//	cfg, err := svcconfig.New().
+//		Method("ecommerce.ProductInfo", "getProduct").
+//		Timeout(time.Second).
+//		Hedge(svcconfig.DefaultHedgingPolicy).
+//		Method("ecommerce.ProductInfo").
+//		Timeout(2 * time.Second).
+//		Retry(svcconfig.DefaultRetryPolicy).
+//		Build()
+//	conn, err := grpc.NewClient(addr, append(cfg.DialOptions(), creds)...)
+//
+// or, from a JSON or YAML file in the service config format,
+//
+//	cfg, err := svcconfig.Load("service_config.yaml")
+//
+// Timeouts and retries are applied by gRPC itself. gRPC-Go ignores
+// hedgingPolicy, so hedging of unary calls is done by the interceptor
+// installed by DialOptions. Hedge idempotent reads only: several attempts of
+// the same call may reach the server.
+package svcconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Config is a service config, as documented in
+// https://github.com/grpc/grpc/blob/master/doc/service_config.md.
+type Config struct {
+	LoadBalancingPolicy string           `json:"loadBalancingPolicy,omitempty"`
+	MethodConfig        []MethodConfig   `json:"methodConfig,omitempty"`
+	RetryThrottling     *RetryThrottling `json:"retryThrottling,omitempty"`
+}
+
+// Name selects the methods a MethodConfig applies to: one method, every
+// method of Service when Method is empty, or every method when both are.
+type Name struct {
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+// MethodConfig configures calls to the methods it names.
+type MethodConfig struct {
+	Name          []Name         `json:"name"`
+	WaitForReady  *bool          `json:"waitForReady,omitempty"`
+	Timeout       Duration       `json:"timeout,omitempty"`
+	RetryPolicy   *RetryPolicy   `json:"retryPolicy,omitempty"`
+	HedgingPolicy *HedgingPolicy `json:"hedgingPolicy,omitempty"`
+}
+
+// RetryPolicy retries a call failing with one of RetryableStatusCodes, after
+// an exponential backoff, as long as no response has been received.
+type RetryPolicy struct {
+	MaxAttempts          int          `json:"maxAttempts"`
+	InitialBackoff       Duration     `json:"initialBackoff"`
+	MaxBackoff           Duration     `json:"maxBackoff"`
+	BackoffMultiplier    float64      `json:"backoffMultiplier"`
+	RetryableStatusCodes []codes.Code `json:"retryableStatusCodes"`
+}
+
+// HedgingPolicy sends a new attempt of a call every HedgingDelay, up to
+// MaxAttempts, until one succeeds. An attempt failing with one of
+// NonFatalStatusCodes sends the next one at once; any other error ends the
+// call.
+type HedgingPolicy struct {
+	MaxAttempts         int          `json:"maxAttempts"`
+	HedgingDelay        Duration     `json:"hedgingDelay,omitempty"`
+	NonFatalStatusCodes []codes.Code `json:"nonFatalStatusCodes,omitempty"`
+}
+
+// RetryThrottling stops retries and hedging while too many calls fail.
+type RetryThrottling struct {
+	MaxTokens  int     `json:"maxTokens"`
+	TokenRatio float64 `json:"tokenRatio"`
+}
+
+// DefaultRetryPolicy retries unavailable backends up to three times.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:          4,
+	InitialBackoff:       Duration(100 * time.Millisecond),
+	MaxBackoff:           Duration(time.Second),
+	BackoffMultiplier:    2,
+	RetryableStatusCodes: []codes.Code{codes.Unavailable},
+}
+
+// DefaultHedgingPolicy sends up to three attempts, 100ms apart.
+var DefaultHedgingPolicy = HedgingPolicy{
+	MaxAttempts:         3,
+	HedgingDelay:        Duration(100 * time.Millisecond),
+	NonFatalStatusCodes: []codes.Code{codes.Unavailable},
+}
+
+// maxAttempts is the largest number of attempts gRPC makes; larger values
+// are lowered to it.
+const maxAttempts = 5
+
+// Validate reports the first invalid setting of c.
+func (c *Config) Validate() error {
+	if c.RetryThrottling != nil {
+		if t := c.RetryThrottling; t.MaxTokens <= 0 || t.MaxTokens > 1000 || t.TokenRatio <= 0 {
+			return fmt.Errorf("retryThrottling: maxTokens must be in (0, 1000] and tokenRatio positive")
+		}
+	}
+	for i, mc := range c.MethodConfig {
+		if err := mc.validate(); err != nil {
+			return fmt.Errorf("methodConfig[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (mc *MethodConfig) validate() error {
+	if len(mc.Name) == 0 {
+		return fmt.Errorf("no name")
+	}
+	for _, n := range mc.Name {
+		if n.Service == "" && n.Method != "" {
+			return fmt.Errorf("method %q without a service", n.Method)
+		}
+	}
+	if mc.Timeout < 0 {
+		return fmt.Errorf("negative timeout")
+	}
+	if mc.RetryPolicy != nil && mc.HedgingPolicy != nil {
+		return fmt.Errorf("both retryPolicy and hedgingPolicy are set")
+	}
+	if p := mc.RetryPolicy; p != nil {
+		switch {
+		case p.MaxAttempts < 2:
+			return fmt.Errorf("retryPolicy: maxAttempts must be at least 2")
+		case p.InitialBackoff <= 0 || p.MaxBackoff <= 0:
+			return fmt.Errorf("retryPolicy: initialBackoff and maxBackoff must be positive")
+		case p.BackoffMultiplier <= 0:
+			return fmt.Errorf("retryPolicy: backoffMultiplier must be positive")
+		case len(p.RetryableStatusCodes) == 0:
+			return fmt.Errorf("retryPolicy: no retryableStatusCodes")
+		}
+	}
+	if p := mc.HedgingPolicy; p != nil {
+		if p.MaxAttempts < 2 {
+			return fmt.Errorf("hedgingPolicy: maxAttempts must be at least 2")
+		}
+		if p.HedgingDelay < 0 {
+			return fmt.Errorf("hedgingPolicy: negative hedgingDelay")
+		}
+	}
+	return nil
+}
+
+// JSON returns c in the service config JSON format.
+func (c *Config) JSON() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		// Every field of Config has a JSON encoding.
+		panic(err)
+	}
+	return string(b)
+}
+
+// DialOptions returns the options making c the default service config of a
+// channel, used unless the name resolver provides one, and hedging its
+// methods that have a HedgingPolicy.
+func (c *Config) DialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithDefaultServiceConfig(c.JSON())}
+	if h := newHedger(c); h != nil {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(h.UnaryClientInterceptor()))
+	}
+	return opts
+}
+
+// Duration is a time.Duration encoded in JSON as seconds with an "s" suffix,
+// e.g. "0.5s". Decoding also accepts Go durations such as "500ms".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatFloat(time.Duration(d).Seconds(), 'f', -1, 64) + "s")
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1.5s\": %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON encodes the status codes by name, e.g. "UNAVAILABLE".
+func (p RetryPolicy) MarshalJSON() ([]byte, error) {
+	type plain RetryPolicy
+	return json.Marshal(struct {
+		plain
+		RetryableStatusCodes codeNames `json:"retryableStatusCodes"`
+	}{plain(p), p.RetryableStatusCodes})
+}
+
+// MarshalJSON encodes the status codes by name, e.g. "UNAVAILABLE".
+func (p HedgingPolicy) MarshalJSON() ([]byte, error) {
+	type plain HedgingPolicy
+	return json.Marshal(struct {
+		plain
+		NonFatalStatusCodes codeNames `json:"nonFatalStatusCodes,omitempty"`
+	}{plain(p), p.NonFatalStatusCodes})
+}
+
+type codeNames []codes.Code
+
+func (cs codeNames) MarshalJSON() ([]byte, error) {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = codeName(c)
+	}
+	return json.Marshal(names)
+}
+
+// codeName turns the name of c, e.g. DeadlineExceeded, into the upper snake
+// case of the service config, DEADLINE_EXCEEDED.
+func codeName(c codes.Code) string {
+	var b strings.Builder
+	for i, r := range c.String() {
+		if i > 0 && r >= 'A' && r <= 'Z' && !(c.String()[i-1] >= 'A' && c.String()[i-1] <= 'Z') {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
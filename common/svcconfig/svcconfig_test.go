@@ -0,0 +1,267 @@
+package svcconfig
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// flakyServer answers Check according to a script: the n-th call (from 0)
+// fails with failures[n] or, when zero, succeeds after delays[n]. Its
+// trailer says which call answered.
+type flakyServer struct {
+	healthpb.UnimplementedHealthServer
+
+	mu       sync.Mutex
+	calls    int
+	failures []codes.Code
+	delays   []time.Duration
+}
+
+func (s *flakyServer) Check(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.mu.Lock()
+	n := s.calls
+	s.calls++
+	s.mu.Unlock()
+	grpc.SetTrailer(ctx, metadata.Pairs("call", strconv.Itoa(n)))
+	if n < len(s.failures) && s.failures[n] != codes.OK {
+		return nil, status.Errorf(s.failures[n], "scripted failure of call %d", n)
+	}
+	if n < len(s.delays) {
+		select {
+		case <-time.After(s.delays[n]):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *flakyServer) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func dial(t *testing.T, srv *flakyServer, cfg *Config) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if cfg != nil {
+		opts = append(opts, cfg.DialOptions()...)
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func build(t *testing.T, b *Builder) *Config {
+	t.Helper()
+	cfg, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return cfg
+}
+
+var fastRetry = RetryPolicy{
+	MaxAttempts:          4,
+	InitialBackoff:       Duration(10 * time.Millisecond),
+	MaxBackoff:           Duration(50 * time.Millisecond),
+	BackoffMultiplier:    2,
+	RetryableStatusCodes: []codes.Code{codes.Unavailable},
+}
+
+func TestRetry(t *testing.T) {
+	failures := []codes.Code{codes.Unavailable, codes.Unavailable}
+
+	srv := &flakyServer{failures: failures}
+	client := dial(t, srv, nil)
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Check without retries = %v, want Unavailable", err)
+	}
+
+	srv = &flakyServer{failures: failures}
+	client = dial(t, srv, build(t, New().Method("grpc.health.v1.Health", "Check").Retry(fastRetry)))
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check with retries: %v", err)
+	}
+	if got := srv.callCount(); got != 3 {
+		t.Errorf("server saw %d attempts, want 3", got)
+	}
+
+	// Non-retryable codes are returned at once.
+	srv = &flakyServer{failures: []codes.Code{codes.InvalidArgument}}
+	client = dial(t, srv, build(t, New().Method("grpc.health.v1.Health").Retry(fastRetry)))
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Check = %v, want InvalidArgument", err)
+	}
+	if got := srv.callCount(); got != 1 {
+		t.Errorf("server saw %d attempts, want 1", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := &flakyServer{delays: []time.Duration{time.Minute}}
+	client := dial(t, srv, build(t, New().Default().Timeout(50*time.Millisecond)))
+	start := time.Now()
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Check = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Check took %v despite a 50ms timeout", elapsed)
+	}
+}
+
+func TestHedging(t *testing.T) {
+	policy := HedgingPolicy{
+		MaxAttempts:         3,
+		HedgingDelay:        Duration(20 * time.Millisecond),
+		NonFatalStatusCodes: []codes.Code{codes.Unavailable},
+	}
+	cfg := build(t, New().Method("grpc.health.v1.Health", "Check").Timeout(5*time.Second).Hedge(policy))
+
+	t.Run("slow first attempt", func(t *testing.T) {
+		srv := &flakyServer{delays: []time.Duration{time.Minute}}
+		client := dial(t, srv, cfg)
+		var trailer metadata.MD
+		var p peer.Peer
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer), grpc.Peer(&p))
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("status = %v, want SERVING", resp.GetStatus())
+		}
+		if got := srv.callCount(); got != 2 {
+			t.Errorf("server saw %d attempts, want 2", got)
+		}
+		// The cancelled first attempt ends after the call returned and
+		// must leave the trailer alone.
+		time.Sleep(50 * time.Millisecond)
+		if got := trailer.Get("call"); len(got) != 1 || got[0] != "1" {
+			t.Errorf("trailer call = %v, want the second attempt's [1]", got)
+		}
+		if p.Addr == nil {
+			t.Error("peer not set")
+		}
+	})
+
+	t.Run("non-fatal failures", func(t *testing.T) {
+		srv := &flakyServer{failures: []codes.Code{codes.Unavailable, codes.Unavailable}}
+		client := dial(t, srv, cfg)
+		if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if got := srv.callCount(); got != 3 {
+			t.Errorf("server saw %d attempts, want 3", got)
+		}
+	})
+
+	t.Run("all attempts fail", func(t *testing.T) {
+		srv := &flakyServer{failures: []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable, codes.OK}}
+		client := dial(t, srv, cfg)
+		if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+			t.Fatalf("Check = %v, want Unavailable", err)
+		}
+		if got := srv.callCount(); got != 3 {
+			t.Errorf("server saw %d attempts, want 3", got)
+		}
+	})
+
+	t.Run("fatal failure", func(t *testing.T) {
+		srv := &flakyServer{failures: []codes.Code{codes.NotFound}}
+		client := dial(t, srv, cfg)
+		if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.NotFound {
+			t.Fatalf("Check = %v, want NotFound", err)
+		}
+		if got := srv.callCount(); got != 1 {
+			t.Errorf("server saw %d attempts, want 1", got)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	cfg := build(t, New().
+		LoadBalancingPolicy("round_robin").
+		Method("ecommerce.ProductInfo", "getProduct").Timeout(time.Second).Hedge(DefaultHedgingPolicy).
+		Method("ecommerce.ProductInfo").Timeout(1500*time.Millisecond).Retry(DefaultRetryPolicy))
+	js := cfg.JSON()
+	for _, want := range []string{`"timeout":"1.5s"`, `"retryableStatusCodes":["UNAVAILABLE"]`, `"hedgingDelay":"0.1s"`} {
+		if !strings.Contains(js, want) {
+			t.Errorf("JSON() = %s, want it to contain %s", js, want)
+		}
+	}
+	parsed, err := Parse([]byte(js))
+	if err != nil {
+		t.Fatalf("Parse(JSON()): %v", err)
+	}
+	if !reflect.DeepEqual(parsed, cfg) {
+		t.Errorf("Parse(JSON()) = %+v, want %+v", parsed, cfg)
+	}
+
+	path := filepath.Join(t.TempDir(), "service_config.yaml")
+	yml := `
+loadBalancingPolicy: round_robin
+methodConfig:
+  - name: [{service: ecommerce.ProductInfo, method: getProduct}]
+    timeout: 1s
+    hedgingPolicy: {maxAttempts: 3, hedgingDelay: 100ms, nonFatalStatusCodes: [UNAVAILABLE]}
+  - name: [{service: ecommerce.ProductInfo}]
+    timeout: 1.5s
+    retryPolicy:
+      maxAttempts: 4
+      initialBackoff: 0.1s
+      maxBackoff: 1s
+      backoffMultiplier: 2
+      retryableStatusCodes: [UNAVAILABLE]
+`
+	if err := os.WriteFile(path, []byte(yml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Load = %+v, want %+v", loaded, cfg)
+	}
+
+	for name, bad := range map[string]string{
+		"unknown field":   `{"methodConfig": [{"name": [{}], "timout": "1s"}]}`,
+		"retry and hedge": `{"methodConfig": [{"name": [{}], "retryPolicy": {}, "hedgingPolicy": {"maxAttempts": 2}}]}`,
+		"one attempt":     `{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 1}}]}`,
+		"bad code":        `{"methodConfig": [{"name": [{}], "hedgingPolicy": {"maxAttempts": 2, "nonFatalStatusCodes": ["FLAKY"]}}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Parse accepted a config with %s", name)
+		}
+	}
+}